@@ -0,0 +1,72 @@
+// Command verify-history walks the hash chain of the change request history
+// and reports the first entry that was changed, inserted or removed. It reads
+// the same environment as the API and exits with status 1 when the chain is
+// broken, so it can run from cron or CI.
+//
+//	go run ./cmd/verify-history            # all history
+//	go run ./cmd/verify-history -cr 42     # one change request
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/services"
+)
+
+func main() {
+	crID := flag.Uint("cr", 0, "verify only the history of this change request")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	cfg := config.Load()
+	if err := database.Connect(cfg); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	var scope *uint
+	if *crID != 0 {
+		id := uint(*crID)
+		scope = &id
+	}
+
+	result, err := services.VerifyHistory(database.DB, scope)
+	if err != nil {
+		log.Fatalf("Failed to verify history: %v", err)
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printResult(result)
+	}
+
+	if !result.Valid {
+		os.Exit(1)
+	}
+}
+
+func printResult(result *services.HistoryVerification) {
+	chain := "all change requests"
+	if result.CRID != nil {
+		chain = fmt.Sprintf("change request %d", *result.CRID)
+	}
+
+	if result.Valid {
+		fmt.Printf("OK: %d history entries of %s verified, last hash %s\n", result.Entries, chain, result.LastHash)
+		return
+	}
+
+	broken := result.FirstBroken
+	fmt.Printf("BROKEN: history of %s, %d entries verified before the break\n", chain, result.Entries)
+	if broken.HistoryID != 0 {
+		fmt.Printf("  first broken entry: %d (CR %d)\n", broken.HistoryID, broken.CRID)
+	}
+	fmt.Printf("  reason: %s\n", broken.Reason)
+}
@@ -2,14 +2,25 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 	"github.com/joho/godotenv"
 	"log"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	JWT      JWTConfig
+	Database   DatabaseConfig
+	Server     ServerConfig
+	JWT        JWTConfig
+	Auth       AuthConfig
+	OIDC       OIDCConfig
+	LDAP       LDAPConfig
+	Kong       KongConfig
+	Automation AutomationConfig
+	Drift      DriftConfig
+	Scheduler  SchedulerConfig
+	Jobs       JobsConfig
 }
 
 type DatabaseConfig struct {
@@ -26,8 +37,102 @@ type ServerConfig struct {
 	Host string
 }
 
+// JWTConfig holds the keys of access tokens. New tokens are signed with
+// SecretKey under KeyID; tokens signed with a key in VerificationKeys (by kid)
+// are still accepted, so keys can be rotated without logging everyone out.
 type JWTConfig struct {
-	SecretKey string
+	SecretKey        string
+	KeyID            string
+	VerificationKeys map[string]string
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+}
+
+// AuthConfig controls local username/password accounts
+type AuthConfig struct {
+	LocalLogin bool // false disables register and password login, e.g. when only SSO is allowed
+}
+
+// OIDCConfig enables single sign-on with an OpenID Connect provider.
+// Leaving IssuerURL empty disables it.
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string // Optional for public clients; PKCE is always used
+	RedirectURL   string // This API's /api/v1/auth/oidc/callback as registered with the provider
+	PostLoginURL  string // Frontend page the callback redirects to with the tokens; empty returns them as JSON
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	GroupMapping  GroupMappingConfig
+}
+
+// GroupMappingConfig maps identity provider groups to teams and roles.
+// Memberships and roles are only synced for the parts that are configured.
+type GroupMappingConfig struct {
+	Teams               map[string]string // Group -> team name
+	SuperManagerGroups  []string
+	GatewayEditorGroups []string
+}
+
+// LDAPConfig makes Login bind against a directory and mirrors its groups into
+// teams and roles. Leaving URL empty disables it.
+type LDAPConfig struct {
+	URL                string // e.g. ldaps://ldap.example.com:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string // Account used to search the directory
+	BindPassword       string
+
+	UserBaseDN        string
+	UserFilter        string // %s is replaced with the escaped username
+	UsernameAttribute string
+	EmailAttribute    string
+
+	GroupBaseDN          string
+	GroupFilter          string // Groups mirrored into teams of the same name
+	GroupNameAttribute   string
+	GroupMemberAttribute string // Holds member DNs
+
+	SuperManagerGroups  []string
+	GatewayEditorGroups []string
+
+	SyncInterval time.Duration
+}
+
+// KongConfig points the executor at the Kong Admin API.
+// Leaving AdminURL empty disables applying CRs to the gateway.
+type KongConfig struct {
+	AdminURL   string
+	AdminToken string
+}
+
+type AutomationConfig struct {
+	WebhookURL string
+}
+
+// DriftConfig controls the background drift detector.
+// A zero Interval disables it; it also needs KongConfig.AdminURL.
+type DriftConfig struct {
+	Interval time.Duration
+	Notify   bool
+}
+
+// SchedulerConfig controls how often approved CRs are checked for a due
+// schedule or an open change window. A zero Interval disables the scheduler.
+type SchedulerConfig struct {
+	Interval time.Duration
+}
+
+// JobsConfig controls the background job queue. Failed jobs are retried after
+// Backoff, doubling on every attempt, until MaxAttempts moves them to DEAD.
+// Jobs running longer than Lease are assumed lost with their worker and run again.
+type JobsConfig struct {
+	Workers      int
+	PollInterval time.Duration
+	MaxAttempts  int
+	Backoff      time.Duration
+	Lease        time.Duration
 }
 
 func Load() *Config {
@@ -50,7 +155,68 @@ func Load() *Config {
 			Host: getEnv("SERVER_HOST", "0.0.0.0"),
 		},
 		JWT: JWTConfig{
-			SecretKey: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			SecretKey:        getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			KeyID:            getEnv("JWT_KEY_ID", "default"),
+			VerificationKeys: getKeyMap("JWT_VERIFICATION_KEYS"),
+			AccessTokenTTL:   getDuration("JWT_ACCESS_TTL", 15*time.Minute),
+			RefreshTokenTTL:  getDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+		},
+		Auth: AuthConfig{
+			LocalLogin: getEnv("AUTH_LOCAL_LOGIN", "true") == "true",
+		},
+		OIDC: OIDCConfig{
+			IssuerURL:     getEnv("OIDC_ISSUER_URL", ""),
+			ClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+			PostLoginURL:  getEnv("OIDC_POST_LOGIN_URL", ""),
+			Scopes:        getList("OIDC_SCOPES", "openid,profile,email"),
+			UsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+			GroupsClaim:   getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			GroupMapping: GroupMappingConfig{
+				Teams:               getKeyMap("OIDC_GROUP_TEAMS"),
+				SuperManagerGroups:  getList("OIDC_SUPER_MANAGER_GROUPS", ""),
+				GatewayEditorGroups: getList("OIDC_GATEWAY_EDITOR_GROUPS", ""),
+			},
+		},
+		LDAP: LDAPConfig{
+			URL:                  getEnv("LDAP_URL", ""),
+			StartTLS:             getEnv("LDAP_START_TLS", "false") == "true",
+			InsecureSkipVerify:   getEnv("LDAP_INSECURE_SKIP_VERIFY", "false") == "true",
+			BindDN:               getEnv("LDAP_BIND_DN", ""),
+			BindPassword:         getEnv("LDAP_BIND_PASSWORD", ""),
+			UserBaseDN:           getEnv("LDAP_USER_BASE_DN", ""),
+			UserFilter:           getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(uid=%s))"),
+			UsernameAttribute:    getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+			EmailAttribute:       getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			GroupBaseDN:          getEnv("LDAP_GROUP_BASE_DN", ""),
+			GroupFilter:          getEnv("LDAP_GROUP_FILTER", "(objectClass=groupOfNames)"),
+			GroupNameAttribute:   getEnv("LDAP_GROUP_NAME_ATTRIBUTE", "cn"),
+			GroupMemberAttribute: getEnv("LDAP_GROUP_MEMBER_ATTRIBUTE", "member"),
+			SuperManagerGroups:   getList("LDAP_SUPER_MANAGER_GROUPS", ""),
+			GatewayEditorGroups:  getList("LDAP_GATEWAY_EDITOR_GROUPS", ""),
+			SyncInterval:         getDuration("LDAP_SYNC_INTERVAL", time.Hour),
+		},
+		Kong: KongConfig{
+			AdminURL:   getEnv("KONG_ADMIN_URL", ""),
+			AdminToken: getEnv("KONG_ADMIN_TOKEN", ""),
+		},
+		Automation: AutomationConfig{
+			WebhookURL: getEnv("WEBHOOK_URL", ""),
+		},
+		Drift: DriftConfig{
+			Interval: getDuration("DRIFT_CHECK_INTERVAL", 5*time.Minute),
+			Notify:   getEnv("DRIFT_WEBHOOK", "false") == "true",
+		},
+		Scheduler: SchedulerConfig{
+			Interval: getDuration("SCHEDULER_INTERVAL", time.Minute),
+		},
+		Jobs: JobsConfig{
+			Workers:      getInt("JOB_WORKERS", 4),
+			PollInterval: getDuration("JOB_POLL_INTERVAL", 2*time.Second),
+			MaxAttempts:  getInt("JOB_MAX_ATTEMPTS", 5),
+			Backoff:      getDuration("JOB_BACKOFF", 10*time.Second),
+			Lease:        getDuration("JOB_LEASE", 5*time.Minute),
 		},
 	}
 }
@@ -62,6 +228,61 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration %q for %s, using %s", value, key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid integer %q for %s, using %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getList parses a comma separated list
+func getList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getKeyMap parses "key:value,key:value", e.g. "kid:secret" or "group:team"
+func getKeyMap(key string) map[string]string {
+	keys := map[string]string{}
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(entry, ":")
+		if !ok || k == "" || v == "" {
+			log.Printf("Warning: ignoring invalid entry in %s, expected key:value", key)
+			continue
+		}
+		keys[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return keys
+}
+
 // GetEnv is a public function to get environment variables
 func GetEnv(key, defaultValue string) string {
 	return getEnv(key, defaultValue)
@@ -50,12 +50,31 @@ func Migrate() error {
 		&models.User{},
 		&models.Team{},
 		&models.UserTeamMembership{},
+		&models.UserIdentity{},
 		&models.SuperManager{},
 		&models.GatewayEditor{},
+		&models.RoleDefinition{},
+		&models.RoleBinding{},
+		&models.Environment{},
+		&models.CRType{},
+		&models.CRTypeVersion{},
+		&models.ApprovalPolicy{},
+		&models.ChangeWindow{},
+		&models.FreezePeriod{},
 		&models.ChangeRequest{},
 		&models.SuperManagerReview{},
+		&models.PayloadRevision{},
 		&models.Comment{},
 		&models.History{},
+		&models.HistoryChainHead{},
+		&models.AuditEvent{},
+		&models.DriftFinding{},
+		&models.Job{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.ServiceAccount{},
+		&models.APIKey{},
+		&models.RefreshToken{},
 	)
 
 	// Re-enable foreign key checks
@@ -5,6 +5,7 @@ import (
 
 	"alpaka/backend/database"
 	"alpaka/backend/models"
+	"alpaka/backend/services"
 	"alpaka/backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -18,7 +19,7 @@ type AddGatewayEditorRequest struct {
 	UserID uint `json:"user_id" binding:"required"`
 }
 
-// AddSuperManager adds a user to the super managers list
+// AddSuperManager binds the super_manager role to a user everywhere
 func AddSuperManager(c *gin.Context) {
 	var req AddSuperManagerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -26,34 +27,10 @@ func AddSuperManager(c *gin.Context) {
 		return
 	}
 
-	// Check if user exists
-	var user models.User
-	if err := database.DB.First(&user, "user_id = ?", req.UserID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Check if already a super manager
-	var existing models.SuperManager
-	if err := database.DB.Where("user_id = ?", req.UserID).First(&existing).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User is already a super manager"})
-		return
-	}
-
-	superManager := models.SuperManager{
-		UserID: req.UserID,
-	}
-
-	if err := database.DB.Create(&superManager).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add super manager"})
-		return
-	}
-
-	database.DB.Preload("User").First(&superManager, superManager.UserID)
-	c.JSON(http.StatusCreated, superManager)
+	grantBuiltinRole(c, req.UserID, models.RoleNameSuperManager, "User is already a super manager")
 }
 
-// RemoveSuperManager removes a user from super managers
+// RemoveSuperManager removes the super_manager role binding of a user
 func RemoveSuperManager(c *gin.Context) {
 	userIDStr := c.Param("id")
 	userID, ok := utils.ParseUint(userIDStr)
@@ -62,18 +39,22 @@ func RemoveSuperManager(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Where("user_id = ?", userID).Delete(&models.SuperManager{}).Error; err != nil {
+	revoked, err := services.RevokeBuiltinRole(database.DB, userID, models.RoleNameSuperManager)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove super manager"})
 		return
 	}
+	if revoked {
+		recordAudit(c, models.AuditRoleRevoked, "user", userID, gin.H{"role": models.RoleNameSuperManager})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Super manager removed successfully"})
 }
 
-// ListSuperManagers lists all super managers
+// ListSuperManagers lists the users bound to the super_manager role everywhere
 func ListSuperManagers(c *gin.Context) {
-	var superManagers []models.SuperManager
-	if err := database.DB.Preload("User").Find(&superManagers).Error; err != nil {
+	superManagers, err := services.BuiltinRoleBindings(models.RoleNameSuperManager)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch super managers"})
 		return
 	}
@@ -81,7 +62,7 @@ func ListSuperManagers(c *gin.Context) {
 	c.JSON(http.StatusOK, superManagers)
 }
 
-// AddGatewayEditor adds a user to the gateway editors list
+// AddGatewayEditor binds the gateway_editor role to a user everywhere
 func AddGatewayEditor(c *gin.Context) {
 	var req AddGatewayEditorRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -89,34 +70,10 @@ func AddGatewayEditor(c *gin.Context) {
 		return
 	}
 
-	// Check if user exists
-	var user models.User
-	if err := database.DB.First(&user, "user_id = ?", req.UserID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Check if already a gateway editor
-	var existing models.GatewayEditor
-	if err := database.DB.Where("user_id = ?", req.UserID).First(&existing).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User is already a gateway editor"})
-		return
-	}
-
-	gatewayEditor := models.GatewayEditor{
-		UserID: req.UserID,
-	}
-
-	if err := database.DB.Create(&gatewayEditor).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add gateway editor"})
-		return
-	}
-
-	database.DB.Preload("User").First(&gatewayEditor, gatewayEditor.UserID)
-	c.JSON(http.StatusCreated, gatewayEditor)
+	grantBuiltinRole(c, req.UserID, models.RoleNameGatewayEditor, "User is already a gateway editor")
 }
 
-// RemoveGatewayEditor removes a user from gateway editors
+// RemoveGatewayEditor removes the gateway_editor role binding of a user
 func RemoveGatewayEditor(c *gin.Context) {
 	userIDStr := c.Param("id")
 	userID, ok := utils.ParseUint(userIDStr)
@@ -125,18 +82,22 @@ func RemoveGatewayEditor(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Where("user_id = ?", userID).Delete(&models.GatewayEditor{}).Error; err != nil {
+	revoked, err := services.RevokeBuiltinRole(database.DB, userID, models.RoleNameGatewayEditor)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove gateway editor"})
 		return
 	}
+	if revoked {
+		recordAudit(c, models.AuditRoleRevoked, "user", userID, gin.H{"role": models.RoleNameGatewayEditor})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Gateway editor removed successfully"})
 }
 
-// ListGatewayEditors lists all gateway editors
+// ListGatewayEditors lists the users bound to the gateway_editor role everywhere
 func ListGatewayEditors(c *gin.Context) {
-	var gatewayEditors []models.GatewayEditor
-	if err := database.DB.Preload("User").Find(&gatewayEditors).Error; err != nil {
+	gatewayEditors, err := services.BuiltinRoleBindings(models.RoleNameGatewayEditor)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gateway editors"})
 		return
 	}
@@ -144,4 +105,26 @@ func ListGatewayEditors(c *gin.Context) {
 	c.JSON(http.StatusOK, gatewayEditors)
 }
 
+// grantBuiltinRole binds a built-in role to a user and responds with the binding
+func grantBuiltinRole(c *gin.Context, userID uint, roleName, exists string) {
+	// Check if user exists
+	var user models.User
+	if err := database.DB.First(&user, "user_id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	binding, created, err := services.GrantBuiltinRole(database.DB, userID, roleName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{"error": exists})
+		return
+	}
+	recordAudit(c, models.AuditRoleGranted, "user", userID, gin.H{"role": roleName, "binding_id": binding.BindingID})
 
+	database.DB.Preload("Role").Preload("User").First(binding, binding.BindingID)
+	c.JSON(http.StatusCreated, binding)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApprovalPolicyRequest struct {
+	Name                          string `json:"name" binding:"required"`
+	EnvironmentID                 *uint  `json:"environment_id"`
+	CRType                        string `json:"cr_type"`
+	RequiredApprovals             int    `json:"required_approvals" binding:"required,min=1"`
+	RequiredRejections            int    `json:"required_rejections"` // Defaults to 1 (any rejection blocks)
+	ApproversOutsideRequesterTeam bool   `json:"approvers_outside_requester_team"`
+}
+
+// CreateApprovalPolicy creates a new approval policy
+func CreateApprovalPolicy(c *gin.Context) {
+	var req ApprovalPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := models.ApprovalPolicy{}
+	if reqErr := applyApprovalPolicyRequest(&policy, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Create(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create approval policy"})
+		return
+	}
+	recordAudit(c, models.AuditConfigCreated, "approval_policy", policy.PolicyID, gin.H{"value": policy})
+
+	c.JSON(http.StatusCreated, policy)
+}
+
+// ListApprovalPolicies lists all approval policies
+func ListApprovalPolicies(c *gin.Context) {
+	var policies []models.ApprovalPolicy
+	if err := database.DB.Order("name ASC").Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch approval policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetApprovalPolicy retrieves a single approval policy
+func GetApprovalPolicy(c *gin.Context) {
+	policyID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return
+	}
+
+	var policy models.ApprovalPolicy
+	if err := database.DB.First(&policy, "policy_id = ?", policyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approval policy not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateApprovalPolicy updates an approval policy. CRs already decided keep their status.
+func UpdateApprovalPolicy(c *gin.Context) {
+	policyID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return
+	}
+
+	var policy models.ApprovalPolicy
+	if err := database.DB.First(&policy, "policy_id = ?", policyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approval policy not found"})
+		return
+	}
+
+	var req ApprovalPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqErr := applyApprovalPolicyRequest(&policy, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update approval policy"})
+		return
+	}
+	recordAudit(c, models.AuditConfigUpdated, "approval_policy", policy.PolicyID, gin.H{"value": policy})
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteApprovalPolicy deletes an approval policy
+func DeleteApprovalPolicy(c *gin.Context) {
+	policyID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return
+	}
+
+	if err := database.DB.Where("policy_id = ?", policyID).Delete(&models.ApprovalPolicy{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete approval policy"})
+		return
+	}
+	recordAudit(c, models.AuditConfigDeleted, "approval_policy", policyID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Approval policy deleted successfully"})
+}
+
+// applyApprovalPolicyRequest validates a request and copies it onto policy.
+// Only one policy may exist per environment and CR type.
+func applyApprovalPolicyRequest(policy *models.ApprovalPolicy, req ApprovalPolicyRequest) *requestError {
+	if req.RequiredRejections < 0 {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "required_rejections must not be negative"}}
+	}
+	if req.RequiredRejections == 0 {
+		req.RequiredRejections = 1
+	}
+
+	if req.EnvironmentID != nil {
+		var env models.Environment
+		if err := database.DB.First(&env, "environment_id = ?", *req.EnvironmentID).Error; err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Environment not found"}}
+		}
+	}
+	if req.CRType != "" {
+		var crType models.CRType
+		if err := database.DB.Where("name = ?", req.CRType).First(&crType).Error; err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Unknown change request type " + req.CRType}}
+		}
+	}
+
+	var conflicts int64
+	scope := database.DB.Where("cr_type = ?", req.CRType)
+	if req.EnvironmentID != nil {
+		scope = scope.Where("environment_id = ?", *req.EnvironmentID)
+	} else {
+		scope = scope.Where("environment_id IS NULL")
+	}
+	query := database.DB.Model(&models.ApprovalPolicy{}).Where(database.DB.Where("name = ?", req.Name).Or(scope))
+	if policy.PolicyID != 0 {
+		query = query.Where("policy_id <> ?", policy.PolicyID)
+	}
+	query.Count(&conflicts)
+	if conflicts > 0 {
+		return &requestError{http.StatusConflict, gin.H{"error": "An approval policy with this name or scope already exists"}}
+	}
+
+	policy.Name = req.Name
+	policy.EnvironmentID = req.EnvironmentID
+	policy.CRType = req.CRType
+	policy.RequiredApprovals = req.RequiredApprovals
+	policy.RequiredRejections = req.RequiredRejections
+	policy.ApproversOutsideRequesterTeam = req.ApproversOutsideRequesterTeam
+	return nil
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// auditCSVHeader are the columns of the CSV export
+var auditCSVHeader = []string{
+	"event_id", "created_at", "action", "actor_user_id", "actor_service_account_id", "actor_name",
+	"target_type", "target_id", "ip_address", "user_agent", "details",
+}
+
+// ListAuditEvents lists audit events, newest first
+func ListAuditEvents(c *gin.Context) {
+	filter, reqErr := auditFilter(c)
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	query := services.FilterAuditEvents(database.DB, filter).Order("event_id DESC")
+
+	page := c.DefaultQuery("page", "1")
+	limit := c.DefaultQuery("limit", "50")
+	query = query.Offset((parseInt(page) - 1) * parseInt(limit)).Limit(parseInt(limit))
+
+	var events []models.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// ExportAuditEvents streams every matching audit event, oldest first, as a CSV or JSON download
+func ExportAuditEvents(c *gin.Context) {
+	filter, reqErr := auditFilter(c)
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Must be csv or json"})
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	var write func([]models.AuditEvent) error
+	var finish func() error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv")
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(auditCSVHeader); err != nil {
+			return
+		}
+		write = func(events []models.AuditEvent) error {
+			for _, e := range events {
+				if err := w.Write(auditCSVRecord(e)); err != nil {
+					return err
+				}
+			}
+			w.Flush()
+			return w.Error()
+		}
+		finish = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		c.Header("Content-Type", "application/json")
+		enc := json.NewEncoder(c.Writer)
+		first := true
+		c.Writer.WriteString("[")
+		write = func(events []models.AuditEvent) error {
+			for _, e := range events {
+				if !first {
+					c.Writer.WriteString(",")
+				}
+				first = false
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		finish = func() error {
+			_, err := c.Writer.WriteString("]\n")
+			return err
+		}
+	}
+
+	// The response has started, so a failure can only cut the download short
+	var events []models.AuditEvent
+	err := services.FilterAuditEvents(database.DB, filter).Order("event_id ASC").
+		FindInBatches(&events, 500, func(*gorm.DB, int) error { return write(events) }).Error
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		log.Printf("Audit export failed: %v", err)
+	}
+}
+
+// auditFilter reads the filter query parameters
+func auditFilter(c *gin.Context) (services.AuditFilter, *requestError) {
+	filter := services.AuditFilter{
+		ActorName:  c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	var reqErr *requestError
+	if filter.From, reqErr = timeQuery(c, "from"); reqErr != nil {
+		return filter, reqErr
+	}
+	if filter.To, reqErr = timeQuery(c, "to"); reqErr != nil {
+		return filter, reqErr
+	}
+
+	if value := c.Query("actor_user_id"); value != "" {
+		userID, ok := utils.ParseUint(value)
+		if !ok {
+			return filter, &requestError{http.StatusBadRequest, gin.H{"error": "Invalid actor_user_id"}}
+		}
+		filter.ActorUserID = &userID
+	}
+	return filter, nil
+}
+
+// timeQuery parses an optional RFC 3339 query parameter
+func timeQuery(c *gin.Context, param string) (*time.Time, *requestError) {
+	value := c.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected an RFC 3339 timestamp"}}
+	}
+	return &t, nil
+}
+
+func auditCSVRecord(e models.AuditEvent) []string {
+	details := ""
+	if len(e.Details) > 0 {
+		data, _ := json.Marshal(e.Details)
+		details = string(data)
+	}
+	return []string{
+		strconv.FormatUint(uint64(e.EventID), 10),
+		e.CreatedAt.UTC().Format(time.RFC3339),
+		string(e.Action),
+		optionalID(e.ActorUserID),
+		optionalID(e.ActorServiceAccountID),
+		e.ActorName,
+		e.TargetType,
+		e.TargetID,
+		e.IPAddress,
+		e.UserAgent,
+		details,
+	}
+}
+
+func optionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+// recordAudit records an action of the authenticated user. A failure is only
+// logged, since the action already happened.
+func recordAudit(c *gin.Context, action models.AuditAction, targetType string, targetID interface{}, details gin.H) {
+	recordAuditAs(c, c.GetUint("user_id"), c.GetString("username"), action, targetType, targetID, details)
+}
+
+// recordAuditAs records an action of a user who is not authenticated yet, e.g.
+// a login. userID is 0 if the user is unknown.
+func recordAuditAs(c *gin.Context, userID uint, username string, action models.AuditAction, targetType string, targetID interface{}, details gin.H) {
+	event := withClient(c, services.Actor{UserID: userID}).NewAuditEvent(action, targetType, targetID)
+	event.ActorName = username
+	if details != nil {
+		event.Details = details
+	}
+	if err := services.RecordAudit(database.DB, &event); err != nil {
+		log.Printf("Failed to record audit event: %v", err)
+	}
+}
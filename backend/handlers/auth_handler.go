@@ -1,15 +1,34 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
+	"alpaka/backend/config"
 	"alpaka/backend/database"
+	"alpaka/backend/middleware"
 	"alpaka/backend/models"
+	"alpaka/backend/services"
 	"alpaka/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+var (
+	refreshTokenTTL = 30 * 24 * time.Hour
+	localLogin      = true
+)
+
+// InitAuth loads the token keys and lifetimes and whether local accounts may sign in
+func InitAuth(jwtCfg config.JWTConfig, authCfg config.AuthConfig) {
+	middleware.InitJWT(jwtCfg)
+	refreshTokenTTL = jwtCfg.RefreshTokenTTL
+	localLogin = authCfg.LocalLogin
+}
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -21,13 +40,25 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token        string      `json:"token"`
+	ExpiresAt    time.Time   `json:"expires_at"` // Of the access token
+	RefreshToken string      `json:"refresh_token"`
+	User         models.User `json:"user"`
 }
 
 // Register creates a new user
 func Register(c *gin.Context) {
+	// Directory and SSO users are provisioned on their first login
+	if !localLogin || ldapDirectory != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled, accounts come from the identity provider"})
+		return
+	}
+
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -60,63 +91,236 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.UserID, user.Username, "your-secret-key")
+	recordAuditAs(c, user.UserID, user.Username, models.AuditRegister, "user", user.UserID, nil)
+
+	// Start a session
+	resp, _, err := issueTokens(database.DB, c, &user, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Don't return password in response
-	user.Password = ""
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	c.JSON(http.StatusCreated, resp)
 }
 
 // Login authenticates a user
 func Login(c *gin.Context) {
+	if !localLogin && ldapDirectory == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password login is disabled, sign in with single sign-on"})
+		return
+	}
+
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Find user
 	var user models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	method := "password"
+	if ldapDirectory != nil {
+		// The directory checks the password; the user is provisioned and their groups synced
+		method = "ldap"
+		directoryUser, err := ldapDirectory.Authenticate(req.Username, req.Password)
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			recordLoginFailed(c, req.Username, method, "invalid credentials")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+		if err != nil {
+			log.Printf("LDAP login failed for %s: %v", req.Username, err)
+			recordLoginFailed(c, req.Username, method, err.Error())
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Directory login failed"})
+			return
+		}
+		user = *directoryUser
+	} else {
+		// Find user
+		if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+			recordLoginFailed(c, req.Username, method, "unknown user")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+
+		// Check password; users of an identity provider have none
+		if user.Password == "" || !utils.CheckPasswordHash(req.Password, user.Password) {
+			recordLoginFailed(c, req.Username, method, "invalid credentials")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+	}
+
+	// Check if user is super manager or gateway editor
+	loadUserRoles(&user)
+
+	// Start a session
+	resp, _, err := issueTokens(database.DB, c, &user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	recordAuditAs(c, user.UserID, user.Username, models.AuditLogin, "user", user.UserID, gin.H{"method": method})
 
-	// Check password
-	if !utils.CheckPasswordHash(req.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	c.JSON(http.StatusOK, resp)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh token.
+// Presenting a refresh token that was already rotated revokes its whole session,
+// since it means the token was copied.
+func RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if user is super manager
-	var superManager models.SuperManager
-	user.IsSuperManager = database.DB.Where("user_id = ?", user.UserID).First(&superManager).Error == nil
+	var stored models.RefreshToken
+	if err := database.DB.First(&stored, "token_hash = ?", utils.HashToken(req.RefreshToken)).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if stored.RevokedAt != nil {
+		if stored.ReplacedByTokenID != nil {
+			revokeSessions(database.DB.Where("session_id = ?", stored.SessionID))
+			recordAuditAs(c, stored.UserID, "", models.AuditRefreshTokenReused, "user", stored.UserID, gin.H{"session_id": stored.SessionID})
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if !stored.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired"})
+		return
+	}
 
-	// Check if user is gateway editor
-	var gatewayEditor models.GatewayEditor
-	user.IsGatewayEditor = database.DB.Where("user_id = ?", user.UserID).First(&gatewayEditor).Error == nil
+	var user models.User
+	if err := database.DB.First(&user, "user_id = ?", stored.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	loadUserRoles(&user)
 
-	// Generate token
-	token, err := utils.GenerateToken(user.UserID, user.Username, "your-secret-key")
+	tx := database.DB.Begin()
+	resp, next, err := issueTokens(tx, c, &user, stored.SessionID)
 	if err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	// Only one request can rotate a token
+	result := tx.Model(&models.RefreshToken{}).
+		Where("token_id = ? AND revoked_at IS NULL", stored.TokenID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_token_id": next.TokenID})
+	if result.Error != nil || result.RowsAffected != 1 {
+		tx.Rollback()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Logout ends the current session. Its access tokens stop working as well.
+func Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if err := revokeSessions(database.DB.Where("session_id = ?", sessionID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	recordAudit(c, models.AuditLogout, "user", c.GetUint("user_id"), gin.H{"session_id": sessionID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll ends every session of the current user
+func LogoutAll(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var sessions []string
+	database.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Distinct("session_id").Pluck("session_id", &sessions)
+
+	if err := revokeSessions(database.DB.Where("user_id = ?", userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	recordAudit(c, models.AuditLogoutAll, "user", userID, gin.H{"revoked_sessions": len(sessions)})
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked", "revoked_sessions": len(sessions)})
+}
+
+// issueTokens stores a new refresh token for a session (a new one if sessionID
+// is empty) and signs an access token for it
+func issueTokens(db *gorm.DB, c *gin.Context, user *models.User, sessionID string) (*AuthResponse, *models.RefreshToken, error) {
+	if sessionID == "" {
+		id, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			return nil, nil, err
+		}
+		sessionID = id
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	stored := models.RefreshToken{
+		UserID:    user.UserID,
+		SessionID: sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+		UserAgent: userAgent,
+		IPAddress: c.ClientIP(),
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		return nil, nil, err
+	}
+
+	token, expiresAt, err := utils.GenerateToken(user.UserID, user.Username, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Don't return password in response
 	user.Password = ""
-	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	return &AuthResponse{
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         *user,
+	}, &stored, nil
+}
+
+// recordLoginFailed records a refused login. username is what was entered.
+func recordLoginFailed(c *gin.Context, username, method, reason string) {
+	recordAuditAs(c, 0, username, models.AuditLoginFailed, "user", "", gin.H{"method": method, "reason": reason})
+}
+
+// revokeSessions revokes the unrevoked refresh tokens matched by query
+func revokeSessions(query *gorm.DB) error {
+	return query.Model(&models.RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// loadUserRoles fills in the role bindings and role flags of a user
+func loadUserRoles(user *models.User) {
+	grants, err := services.LoadGrants(database.DB, user.UserID)
+	if err != nil {
+		log.Printf("Failed to load role bindings of user %d: %v", user.UserID, err)
+		return
+	}
+	user.RoleBindings = grants
+	user.IsSuperManager = grants.AllowsAnywhere(models.PermCRApprove)
+	user.IsGatewayEditor = grants.AllowsAnywhere(models.PermCRExecute)
 }
 
 // GetCurrentUser returns the current authenticated user
@@ -134,11 +338,7 @@ func GetCurrentUser(c *gin.Context) {
 	}
 
 	// Check roles
-	var superManager models.SuperManager
-	user.IsSuperManager = database.DB.Where("user_id = ?", user.UserID).First(&superManager).Error == nil
-
-	var gatewayEditor models.GatewayEditor
-	user.IsGatewayEditor = database.DB.Where("user_id = ?", user.UserID).First(&gatewayEditor).Error == nil
+	loadUserRoles(&user)
 
 	// Don't return password in response
 	user.Password = ""
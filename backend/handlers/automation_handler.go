@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
 	"alpaka/backend/services"
 	"alpaka/backend/utils"
 
@@ -12,8 +18,12 @@ import (
 var automationService *services.AutomationService
 
 // InitAutomationService initializes the automation service
-func InitAutomationService(webhookURL string) {
-	automationService = services.NewAutomationService(webhookURL)
+func InitAutomationService(kongCfg config.KongConfig) {
+	var kong services.KongClient
+	if kongCfg.AdminURL != "" {
+		kong = services.NewKongAdminClient(kongCfg.AdminURL, kongCfg.AdminToken)
+	}
+	automationService = services.NewAutomationService(kong)
 }
 
 // GetAutomationService returns the automation service instance
@@ -21,6 +31,27 @@ func GetAutomationService() *services.AutomationService {
 	return automationService
 }
 
+// requestActor returns the service account or user that authenticated the request
+func requestActor(c *gin.Context) (services.Actor, error) {
+	if serviceAccountID, ok := c.Get("service_account_id"); ok {
+		return withClient(c, services.ServiceAccountActor(serviceAccountID.(uint))), nil
+	}
+	actor, err := services.LoadActor(c.MustGet("user_id").(uint))
+	return withClient(c, actor), err
+}
+
+// clientActor is the authenticated user, without loading their role bindings
+func clientActor(c *gin.Context) services.Actor {
+	return withClient(c, services.Actor{UserID: c.GetUint("user_id")})
+}
+
+// withClient sets the address and user agent of the request on an actor for its history entries
+func withClient(c *gin.Context, actor services.Actor) services.Actor {
+	actor.IPAddress = c.ClientIP()
+	actor.UserAgent = c.Request.UserAgent()
+	return actor
+}
+
 // GetCRStatusForCI returns CR status for CI/CD integration
 func GetCRStatusForCI(c *gin.Context) {
 	crIDStr := c.Param("id")
@@ -53,11 +84,109 @@ func TriggerAutomation(c *gin.Context) {
 		return
 	}
 
-	if err := automationService.ProcessApprovedCR(crID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	actor, err := requestActor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Users start the CR as themselves, so the transition checks their cr.execute grant
+	if err := automationService.ProcessApprovedCR(crID, actor); err != nil {
+		switch {
+		case errors.Is(err, services.ErrChangeFreeze):
+			// Manual execution during a freeze is refused and recorded
+			var cr models.ChangeRequest
+			if database.DB.First(&cr, "cr_id = ?", crID).Error == nil {
+				services.RecordExecutionRefused(&cr, actor, err.Error())
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrExecutionDeferred), errors.Is(err, services.ErrPayloadNotApproved):
+			// A changed payload was already recorded as refused
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTransitionForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Automation triggered successfully"})
 }
 
+type ExecutionResultRequest struct {
+	Result   string            `json:"result" binding:"required"` // "SUCCESS" or "FAILURE"
+	LogURL   string            `json:"log_url"`
+	Message  string            `json:"message"`  // e.g. why the run failed
+	Pipeline map[string]string `json:"pipeline"` // e.g. {"provider": "gitlab", "name": "deploy", "run_id": "1234"}
+}
+
+// ReportExecutionResult lets a CI/CD pipeline report the outcome of executing a CR.
+// The CR moves from IN_PROGRESS to COMPLETED or FAILED and the run is recorded in its history.
+func ReportExecutionResult(c *gin.Context) {
+	crID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var req ExecutionResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var action models.TransitionAction
+	var target models.ExecutionStatus
+	switch req.Result {
+	case "SUCCESS":
+		action, target = models.ActionComplete, models.ExecutionStatusCompleted
+	case "FAILURE":
+		action, target = models.ActionFail, models.ExecutionStatusFailed
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid result. Must be SUCCESS or FAILURE"})
+		return
+	}
+	if req.LogURL != "" {
+		if parsed, err := url.Parse(req.LogURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "log_url must be an absolute http(s) URL"})
+			return
+		}
+	}
+
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	// Pipelines may resend a callback; reporting the state the CR is already in is a no-op
+	if cr.ExecutionStatus == target {
+		c.JSON(http.StatusOK, cr)
+		return
+	}
+
+	details, err := json.Marshal(gin.H{
+		"result":   req.Result,
+		"log_url":  req.LogURL,
+		"message":  req.Message,
+		"pipeline": req.Pipeline,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode run details"})
+		return
+	}
+
+	actor, err := requestActor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.ApplyTransition(database.DB, &cr, action, actor, string(details)); err != nil {
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	c.JSON(http.StatusOK, cr)
+}
@@ -1,87 +1,301 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 	//"strconv"
-	//"time"
 
 	"alpaka/backend/database"
+	"alpaka/backend/middleware"
 	"alpaka/backend/models"
+	"alpaka/backend/services"
 	"alpaka/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateCRRequest struct {
 	Title               string `json:"title" binding:"required"`
 	ConfigChangesPayload string `json:"config_changes_payload" binding:"required"`
 	RequesterTeamID     uint   `json:"requester_team_id" binding:"required"`
+	EnvironmentID       *uint  `json:"environment_id"`
+	Type                string `json:"type"`           // CR type name, defaults to kong-service
+	SchemaVersion       int    `json:"schema_version"` // Version of the type the payload follows, defaults to the latest
+	ScheduledFor        *time.Time `json:"scheduled_for"` // RFC 3339; executed once approved and due
+
+	parentCRID *uint // Set when the CR is created by promotion
+}
+
+type PromoteCRRequest struct {
+	Title string `json:"title"`
 }
 
 type UpdateCRRequest struct {
 	Title               string `json:"title"`
 	ConfigChangesPayload string `json:"config_changes_payload"`
+	ScheduledFor        *time.Time `json:"scheduled_for"`
 }
 
 type ReviewCRRequest struct {
-	ReviewDecision string `json:"review_decision" binding:"required"` // "APPROVED" or "REJECTED"
+	ReviewDecision string `json:"review_decision" binding:"required"` // "APPROVED", "REJECTED" or "CHANGES_REQUESTED"
+	Reason         string `json:"reason"`                             // Required for "CHANGES_REQUESTED"
+}
+
+type ResubmitCRRequest struct {
+	Comment string `json:"comment"` // Optional note on what was reworked
 }
 
 type UpdateExecutionStatusRequest struct {
 	ExecutionStatus string `json:"execution_status" binding:"required"`
 }
 
+type RollbackCRRequest struct {
+	AutoApprove bool `json:"auto_approve"`
+}
+
 type CommentRequest struct {
 	CommentText string `json:"comment_text" binding:"required"`
 }
 
+// requestError is a failed request with the HTTP status and body to respond with
+type requestError struct {
+	Status int
+	Body   gin.H
+}
+
 // CreateChangeRequest creates a new change request
 func CreateChangeRequest(c *gin.Context) {
-	userID := c.MustGet("user_id").(uint)
-
 	var req CreateCRRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	cr, reqErr := createChangeRequest(clientActor(c), req)
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	c.JSON(http.StatusCreated, cr)
+}
+
+// createChangeRequest validates and stores a new CR on behalf of the actor.
+// It is shared by every path that creates CRs from user input.
+func createChangeRequest(actor services.Actor, req CreateCRRequest) (*models.ChangeRequest, *requestError) {
+	cr, env, reqErr := newChangeRequest(actor, req)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	tx := database.DB.Begin()
+	if reqErr := storeChangeRequest(tx, actor, cr); reqErr != nil {
+		tx.Rollback()
+		return nil, reqErr
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to create change request"}}
+	}
+	finishChangeRequest(cr, env, actor)
+	return cr, nil
+}
+
+// newChangeRequest validates a create request and builds the CR it creates without storing it.
+// It also returns the target environment, nil for CRs without one.
+func newChangeRequest(actor services.Actor, req CreateCRRequest) (*models.ChangeRequest, *models.Environment, *requestError) {
+	userID := actor.UserID
+	if req.Type == "" {
+		req.Type = services.KongServiceCRType
+	}
+	crType, typeVersion, reqErr := resolveCRType(req.Type, req.SchemaVersion)
+	if reqErr != nil {
+		return nil, nil, reqErr
+	}
+	if reqErr := validatePayload(crType, typeVersion, req.ConfigChangesPayload); reqErr != nil {
+		return nil, nil, reqErr
+	}
+	if reqErr := checkScheduledFor(req.ScheduledFor); reqErr != nil {
+		return nil, nil, reqErr
+	}
+
 	// Verify user is member of the requester team
 	var membership models.UserTeamMembership
 	if err := database.DB.Where("user_id = ? AND team_id = ?", userID, req.RequesterTeamID).First(&membership).Error; err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of the specified team"})
-		return
+		return nil, nil, &requestError{http.StatusForbidden, gin.H{"error": "User is not a member of the specified team"}}
 	}
 
-	// Create change request
-	cr := models.ChangeRequest{
+	// Verify the target environment exists
+	var env *models.Environment
+	if req.EnvironmentID != nil {
+		env = &models.Environment{}
+		if err := database.DB.First(env, "environment_id = ?", *req.EnvironmentID).Error; err != nil {
+			return nil, nil, &requestError{http.StatusBadRequest, gin.H{"error": "Environment not found"}}
+		}
+	}
+
+	cr := &models.ChangeRequest{
 		RequesterUserID:      userID,
 		RequesterTeamID:      req.RequesterTeamID,
 		Title:                req.Title,
 		ConfigChangesPayload: req.ConfigChangesPayload,
 		ApprovalStatus:       models.ApprovalStatusPending,
 		ExecutionStatus:      models.ExecutionStatusDraft,
+		EnvironmentID:        req.EnvironmentID,
+		ParentCRID:           req.parentCRID,
+		Type:                 crType.Name,
+		SchemaVersion:        typeVersion.Version,
+		ScheduledFor:         req.ScheduledFor,
+		Revision:             1,
+		Version:              1,
 	}
+	return cr, env, nil
+}
 
-	if err := database.DB.Create(&cr).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create change request"})
-		return
+// storeChangeRequest inserts a CR built by newChangeRequest with its first
+// payload revision, CREATED history entry and CR_CREATED event. Pass a
+// transaction as db and roll it back on error, so no CR is left without them.
+func storeChangeRequest(db *gorm.DB, actor services.Actor, cr *models.ChangeRequest) *requestError {
+	if err := db.Create(cr).Error; err != nil {
+		return &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to create change request"}}
+	}
+	if _, _, err := services.RecordPayloadRevision(db, cr, actor.UserID); err != nil {
+		return &requestError{http.StatusInternalServerError, gin.H{"error": err.Error()}}
 	}
 
 	// Create history entry
-	oldStatus := ""
-	history := models.History{
-		CRID:            cr.CRID,
-		ChangedByUserID: userID,
-		EventType:       "CREATED",
-		OldStatus:       &oldStatus,
-		NewStatus:       string(cr.ApprovalStatus),
+	details := ""
+	if cr.ParentCRID != nil {
+		details = fmt.Sprintf("Promoted from CR %d", *cr.ParentCRID)
+	}
+	history := actor.NewHistory(cr.CRID, "CREATED", "", string(cr.ApprovalStatus), details)
+	if err := services.RecordHistory(db, &history); err != nil {
+		return &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to create history"}}
 	}
-	database.DB.Create(&history)
 
-	// Load relationships
-	database.DB.Preload("RequesterUser").Preload("RequesterTeam").First(&cr, cr.CRID)
+	if err := services.PublishEvent(db, models.WebhookEventCRCreated, cr, nil); err != nil {
+		return &requestError{http.StatusInternalServerError, gin.H{"error": err.Error()}}
+	}
+	return nil
+}
 
-	c.JSON(http.StatusCreated, cr)
+// finishChangeRequest runs the steps that follow storing a new CR and loads its relationships
+func finishChangeRequest(cr *models.ChangeRequest, env *models.Environment, actor services.Actor) {
+	// Environments with auto-approval skip the Super Manager review
+	if env != nil && env.AutoApprove {
+		autoApproveChangeRequest(cr, actor, fmt.Sprintf("Environment %s auto-approves change requests", env.Name))
+	}
+
+	database.DB.Preload("RequesterUser").Preload("RequesterTeam").Preload("Environment").First(cr, cr.CRID)
+}
+
+// resolveCRType loads the CR type version a payload is authored against
+func resolveCRType(typeName string, version int) (*models.CRType, *models.CRTypeVersion, *requestError) {
+	crType, typeVersion, err := services.ResolveCRTypeVersion(typeName, version)
+	switch {
+	case errors.Is(err, services.ErrCRTypeNotFound):
+		return nil, nil, &requestError{http.StatusBadRequest, gin.H{"error": "Unknown change request type " + typeName}}
+	case errors.Is(err, services.ErrCRTypeVersionNotFound):
+		return nil, nil, &requestError{http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Change request type %s has no version %d", typeName, version)}}
+	case err != nil:
+		return nil, nil, &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to load change request type"}}
+	}
+	return crType, typeVersion, nil
+}
+
+// validatePayload checks a config changes payload against the schema of its CR type version.
+// Field-level failures are returned as 422 with their paths in "details".
+func validatePayload(crType *models.CRType, typeVersion *models.CRTypeVersion, payload string) *requestError {
+	err := services.ValidateCRPayload(crType, typeVersion, payload)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *services.PayloadValidationError
+	if errors.As(err, &validationErr) {
+		return &requestError{http.StatusUnprocessableEntity, gin.H{
+			"error":   "Invalid config_changes_payload",
+			"details": validationErr.Errors,
+		}}
+	}
+	return &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to validate config_changes_payload"}}
+}
+
+// checkScheduledFor rejects execution times in the past
+func checkScheduledFor(scheduledFor *time.Time) *requestError {
+	if scheduledFor != nil && scheduledFor.Before(time.Now()) {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "scheduled_for must be in the future"}}
+	}
+	return nil
+}
+
+// transitionError maps a refused transition to its HTTP response
+func transitionError(err error) *requestError {
+	var conflict *services.VersionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		var current models.ChangeRequest
+		database.DB.Select("version").First(&current, "cr_id = ?", conflict.CRID)
+		return versionError(http.StatusConflict, current.Version)
+	case errors.Is(err, services.ErrTransitionForbidden):
+		return &requestError{http.StatusForbidden, gin.H{"error": err.Error()}}
+	case errors.Is(err, services.ErrTransitionNotAllowed), errors.Is(err, services.ErrExecutionDeferred), errors.Is(err, services.ErrPayloadNotApproved):
+		return &requestError{http.StatusConflict, gin.H{"error": err.Error()}}
+	}
+	return &requestError{http.StatusInternalServerError, gin.H{"error": err.Error()}}
+}
+
+// crETag is the entity tag of a version of a CR
+func crETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// setETag sends the CR's version as the ETag, for the client to send back in If-Match
+func setETag(c *gin.Context, cr *models.ChangeRequest) {
+	c.Header("ETag", crETag(cr.Version))
+}
+
+// checkIfMatch refuses a write based on another version of the CR than the
+// current one. Requests without If-Match are not checked.
+func checkIfMatch(c *gin.Context, cr *models.ChangeRequest) *requestError {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == crETag(cr.Version) {
+			return nil
+		}
+	}
+	return versionError(http.StatusPreconditionFailed, cr.Version)
+}
+
+// versionError tells the client that the CR changed since it loaded it, and
+// which version is current
+func versionError(status int, version int) *requestError {
+	return &requestError{status, gin.H{"error": "Change request was changed by someone else; reload it and try again", "version": version}}
+}
+
+// autoApproveChangeRequest approves a pending CR without review and hands it to automation
+func autoApproveChangeRequest(cr *models.ChangeRequest, actor services.Actor, reason string) {
+	actor.System = true
+	tx := database.DB.Begin()
+	if err := services.ApplyTransition(tx, cr, models.ActionAutoApprove, actor, reason); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to auto-approve CR %d: %v", cr.CRID, err)
+		return
+	}
+	if err := services.EnqueueProcessCR(tx, cr.CRID); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to auto-approve CR %d: %v", cr.CRID, err)
+		return
+	}
+	tx.Commit()
 }
 
 // GetChangeRequest retrieves a single change request
@@ -97,21 +311,38 @@ func GetChangeRequest(c *gin.Context) {
 	if err := database.DB.
 		Preload("RequesterUser").
 		Preload("RequesterTeam").
+		Preload("Environment").
 		Preload("Reviews.SuperManager").
 		Preload("Comments.User").
 		Preload("History.ChangedBy").
+		Preload("History.ChangedByServiceAccount").
 		First(&cr, "cr_id = ?", crID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
 		return
 	}
 
+	outcome, err := services.EvaluateApproval(&cr, cr.Reviews)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cr.ApprovalOutcome = outcome
+
+	setETag(c, &cr)
 	c.JSON(http.StatusOK, cr)
 }
 
-// ListChangeRequests lists all change requests with filters
+// ListChangeRequests lists the change requests the user may see, with filters
 func ListChangeRequests(c *gin.Context) {
+	grants, err := middleware.Grants(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var crs []models.ChangeRequest
-	query := database.DB.Preload("RequesterUser").Preload("RequesterTeam")
+	query := database.DB.Preload("RequesterUser").Preload("RequesterTeam").Preload("Environment")
+	query = services.ReadableCRs(query, c.GetUint("user_id"), grants)
 
 	// Filters
 	if approvalStatus := c.Query("approval_status"); approvalStatus != "" {
@@ -130,6 +361,14 @@ func ListChangeRequests(c *gin.Context) {
 			query = query.Where("requester_user_id = ?", userID)
 		}
 	}
+	if envIDStr := c.Query("environment_id"); envIDStr != "" {
+		if envID, ok := utils.ParseUint(envIDStr); ok {
+			query = query.Where("environment_id = ?", envID)
+		}
+	}
+	if crType := c.Query("type"); crType != "" {
+		query = query.Where("type = ?", crType)
+	}
 
 	// Pagination
 	page := c.DefaultQuery("page", "1")
@@ -164,14 +403,16 @@ func UpdateChangeRequest(c *gin.Context) {
 		return
 	}
 
-	// Only requester can update, and only if not approved
-	if cr.RequesterUserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only the requester can update this change request"})
+	if reqErr := checkIfMatch(c, &cr); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
 		return
 	}
 
-	if cr.ApprovalStatus == models.ApprovalStatusApproved {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot update an approved change request"})
+	// Only the requester can update, and only before approval
+	actor := withClient(c, services.Actor{UserID: userID})
+	if _, err := services.CheckTransition(&cr, models.ActionUpdate, actor); err != nil {
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
 		return
 	}
 
@@ -181,36 +422,69 @@ func UpdateChangeRequest(c *gin.Context) {
 		return
 	}
 
-	oldStatus := string(cr.ApprovalStatus)
-
 	// Update fields
 	if req.Title != "" {
 		cr.Title = req.Title
 	}
 	if req.ConfigChangesPayload != "" {
+		// Validate against the version the CR was authored with, not the latest
+		crType, typeVersion, reqErr := resolveCRType(cr.Type, cr.SchemaVersion)
+		if reqErr != nil {
+			c.JSON(reqErr.Status, reqErr.Body)
+			return
+		}
+		if reqErr := validatePayload(crType, typeVersion, req.ConfigChangesPayload); reqErr != nil {
+			c.JSON(reqErr.Status, reqErr.Body)
+			return
+		}
 		cr.ConfigChangesPayload = req.ConfigChangesPayload
 	}
+	if req.ScheduledFor != nil {
+		if reqErr := checkScheduledFor(req.ScheduledFor); reqErr != nil {
+			c.JSON(reqErr.Status, reqErr.Body)
+			return
+		}
+		cr.ScheduledFor = req.ScheduledFor
+	}
 
-	if err := database.DB.Save(&cr).Error; err != nil {
+	// Only the edited columns are written; the transition below fails if the
+	// CR was changed since it was loaded
+	tx := database.DB.Begin()
+	if err := tx.Model(&cr).Select("title", "config_changes_payload", "scheduled_for").Updates(&cr).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update change request"})
 		return
 	}
 
-	// Create history entry
-	history := models.History{
-		CRID:            cr.CRID,
-		ChangedByUserID: userID,
-		EventType:       "UPDATED",
-		OldStatus:       &oldStatus,
-		NewStatus:       string(cr.ApprovalStatus),
+	// Keep the previous payload, so reviewers can see what changed
+	revision, changes, err := services.RecordPayloadRevision(tx, &cr, userID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	details := ""
+	if revision != nil {
+		summary := services.SummarizePayloadChanges(changes)
+		details = fmt.Sprintf("Payload revision %d: %d added, %d removed, %d changed", revision.Number, summary.Added, summary.Removed, summary.Changed)
 	}
-	database.DB.Create(&history)
 
+	if err := services.ApplyTransition(tx, &cr, models.ActionUpdate, actor, details); err != nil {
+		tx.Rollback()
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	tx.Commit()
+
+	setETag(c, &cr)
 	c.JSON(http.StatusOK, cr)
 }
 
-// ReviewChangeRequest allows a super manager to approve/reject a CR
-func ReviewChangeRequest(c *gin.Context) {
+// ResubmitChangeRequest returns a reworked CR to review as a new revision.
+// Reviews of earlier revisions no longer count towards the approval policy.
+func ResubmitChangeRequest(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 	crIDStr := c.Param("id")
 	crID, ok := utils.ParseUint(crIDStr)
@@ -225,8 +499,62 @@ func ReviewChangeRequest(c *gin.Context) {
 		return
 	}
 
-	if cr.ApprovalStatus != models.ApprovalStatusPending {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Change request is not pending approval"})
+	actor := withClient(c, services.Actor{UserID: userID})
+	if _, err := services.CheckTransition(&cr, models.ActionResubmit, actor); err != nil {
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	var req ResubmitCRRequest
+	// Body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	cr.Revision++
+	details := fmt.Sprintf("Revision %d submitted for review", cr.Revision)
+	if req.Comment != "" {
+		details += ": " + req.Comment
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Model(&cr).Update("revision", cr.Revision).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resubmit change request"})
+		return
+	}
+
+	if err := services.ApplyTransition(tx, &cr, models.ActionResubmit, actor, details); err != nil {
+		tx.Rollback()
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	tx.Commit()
+
+	database.DB.Preload("RequesterUser").Preload("RequesterTeam").Preload("Environment").First(&cr, cr.CRID)
+
+	c.JSON(http.StatusOK, cr)
+}
+
+// ReviewChangeRequest allows a super manager to approve/reject a CR
+func ReviewChangeRequest(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
 		return
 	}
 
@@ -236,31 +564,106 @@ func ReviewChangeRequest(c *gin.Context) {
 		return
 	}
 
+	action := models.ActionReview
 	var decision models.ReviewDecision
 	switch req.ReviewDecision {
 	case "APPROVED":
 		decision = models.ReviewDecisionApproved
-		cr.ApprovalStatus = models.ApprovalStatusApproved
 	case "REJECTED":
 		decision = models.ReviewDecisionRejected
-		cr.ApprovalStatus = models.ApprovalStatusRejected
+	case "CHANGES_REQUESTED":
+		decision = models.ReviewDecisionChangesRequested
+		action = models.ActionRequestChanges
+		if strings.TrimSpace(req.Reason) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required when requesting changes"})
+			return
+		}
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review decision. Must be APPROVED or REJECTED"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review decision. Must be APPROVED, REJECTED or CHANGES_REQUESTED"})
+		return
+	}
+
+	actor, err := requestActor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Record the review and evaluate the approval policy in a transaction.
+	// The CR row is locked so concurrent reviews are counted one after another.
+	tx := database.DB.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&cr, "cr_id = ?", crID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load change request"})
+		return
+	}
+
+	// The review is for the payload the reviewer saw
+	if reqErr := checkIfMatch(c, &cr); reqErr != nil {
+		tx.Rollback()
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	// Each Super Manager votes once per revision of a CR
+	if _, err := services.CheckTransition(&cr, action, actor); err != nil {
+		tx.Rollback()
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	// The review applies to the payload as it is now, see checkIfMatch
+	payloadHash, err := services.HashPayload(cr.ConfigChangesPayload)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Create review record
 	review := models.SuperManagerReview{
 		CRID:           cr.CRID,
 		SMUserID:       userID,
 		ReviewDecision: decision,
+		Revision:       cr.Revision,
+		PayloadHash:    payloadHash,
+	}
+	if req.Reason != "" {
+		review.Reason = &req.Reason
 	}
 
-	// Update CR and create review in transaction
-	tx := database.DB.Begin()
-	if err := tx.Save(&cr).Error; err != nil {
+	var reviews []models.SuperManagerReview
+	if err := tx.Where("cr_id = ? AND revision = ?", cr.CRID, cr.Revision).Find(&reviews).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update change request"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reviews"})
+		return
+	}
+	outcome, err := services.EvaluateApproval(&cr, append(reviews, review))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The CR only changes status once the policy is decided.
+	// A single request for changes sends it back to the requester.
+	details := fmt.Sprintf("%s by user %d: %d/%d approvals, %d/%d rejections (policy %s)",
+		decision, userID, outcome.Approvals, outcome.RequiredApprovals, outcome.Rejections, outcome.RequiredRejections, outcome.PolicyName)
+	transitionActor := actor
+	switch {
+	case action == models.ActionRequestChanges:
+		details = req.Reason
+	case outcome.Decision == models.ApprovalStatusApproved:
+		action = models.ActionApprove
+		transitionActor.System = true
+	case outcome.Decision == models.ApprovalStatusRejected:
+		action = models.ActionReject
+		transitionActor.System = true
+	}
+	if err := services.ApplyTransition(tx, &cr, action, transitionActor, details); err != nil {
+		tx.Rollback()
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
 		return
 	}
 
@@ -270,46 +673,37 @@ func ReviewChangeRequest(c *gin.Context) {
 		return
 	}
 
-	// Create history entry
-	oldStatusStr := string(models.ApprovalStatusPending)
-	history := models.History{
-		CRID:            cr.CRID,
-		ChangedByUserID: userID,
-		EventType:       "STATUS_CHANGE",
-		OldStatus:       &oldStatusStr,
-		NewStatus:       string(cr.ApprovalStatus),
-	}
-	if err := tx.Create(&history).Error; err != nil {
+	event := map[string]interface{}{
+		"review":           gin.H{"sm_user_id": userID, "review_decision": decision, "reason": review.Reason, "revision": review.Revision, "payload_hash": review.PayloadHash},
+		"approval_outcome": outcome,
+	}
+	if err := services.PublishEvent(tx, models.WebhookEventReviewed, &cr, event); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create history"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	tx.Commit()
-
 	// Automatically process approved CRs
 	if cr.ApprovalStatus == models.ApprovalStatusApproved {
-		// Trigger automation in background (non-blocking)
-		go func() {
-			svc := GetAutomationService()
-			if svc != nil {
-				if err := svc.ProcessApprovedCR(cr.CRID); err != nil {
-					// Log error but don't fail the request
-					// In production, use proper logging
-				}
-			}
-		}()
+		if err := services.EnqueueProcessCR(tx, cr.CRID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue automation"})
+			return
+		}
 	}
 
+	tx.Commit()
+
 	// Load relationships
 	database.DB.Preload("RequesterUser").Preload("RequesterTeam").Preload("Reviews").First(&cr, cr.CRID)
+	cr.ApprovalOutcome = outcome
 
+	setETag(c, &cr)
 	c.JSON(http.StatusOK, cr)
 }
 
 // UpdateExecutionStatus allows a gateway editor to update execution status
 func UpdateExecutionStatus(c *gin.Context) {
-	userID := c.MustGet("user_id").(uint)
 	crIDStr := c.Param("id")
 	crID, ok := utils.ParseUint(crIDStr)
 	if !ok {
@@ -323,8 +717,8 @@ func UpdateExecutionStatus(c *gin.Context) {
 		return
 	}
 
-	if cr.ApprovalStatus != models.ApprovalStatusApproved {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Change request must be approved before execution"})
+	if reqErr := checkIfMatch(c, &cr); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
 		return
 	}
 
@@ -344,29 +738,35 @@ func UpdateExecutionStatus(c *gin.Context) {
 		newStatus = models.ExecutionStatusCompleted
 	case "CANCELED":
 		newStatus = models.ExecutionStatusCanceled
+	case "FAILED":
+		newStatus = models.ExecutionStatusFailed
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution status"})
 		return
 	}
 
-	oldStatus := string(cr.ExecutionStatus)
-	cr.ExecutionStatus = newStatus
-
-	if err := database.DB.Save(&cr).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update execution status"})
+	action, ok := services.ExecutionActionFor(&cr, newStatus)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot move execution status from %s to %s while %s", cr.ExecutionStatus, newStatus, cr.ApprovalStatus)})
 		return
 	}
 
-	// Create history entry
-	history := models.History{
-		CRID:            cr.CRID,
-		ChangedByUserID: userID,
-		EventType:       "STATUS_CHANGE",
-		OldStatus:       &oldStatus,
-		NewStatus:       string(newStatus),
+	actor, err := requestActor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.ApplyTransition(database.DB, &cr, action, actor, ""); err != nil {
+		// Manual execution during a freeze or of a changed payload is refused and recorded
+		if errors.Is(err, services.ErrChangeFreeze) || errors.Is(err, services.ErrPayloadNotApproved) {
+			services.RecordExecutionRefused(&cr, actor, err.Error())
+		}
+		reqErr := transitionError(err)
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
 	}
-	database.DB.Create(&history)
 
+	setETag(c, &cr)
 	c.JSON(http.StatusOK, cr)
 }
 
@@ -404,13 +804,16 @@ func AddComment(c *gin.Context) {
 	}
 
 	// Create history entry
-	history := models.History{
-		CRID:            crID,
-		ChangedByUserID: userID,
-		EventType:       "COMMENT_ADDED",
-		NewStatus:       "",
+	history := clientActor(c).NewHistory(crID, "COMMENT_ADDED", "", "", "")
+	history.OldStatus = nil
+	if err := services.RecordHistory(database.DB, &history); err != nil {
+		log.Printf("Failed to record COMMENT_ADDED for CR %d: %v", crID, err)
+	}
+
+	event := map[string]interface{}{"comment_id": comment.CommentID, "user_id": userID, "comment_text": comment.CommentText}
+	if err := services.PublishEvent(database.DB, models.WebhookEventCommentAdded, &cr, event); err != nil {
+		log.Printf("Failed to publish COMMENT_ADDED for CR %d: %v", cr.CRID, err)
 	}
-	database.DB.Create(&history)
 
 	// Load user relationship
 	database.DB.Preload("User").First(&comment, comment.CommentID)
@@ -446,7 +849,7 @@ func GetHistory(c *gin.Context) {
 	}
 
 	var history []models.History
-	if err := database.DB.Preload("ChangedBy").Where("cr_id = ?", crID).Order("timestamp ASC").Find(&history).Error; err != nil {
+	if err := database.DB.Preload("ChangedBy").Preload("ChangedByServiceAccount").Where("cr_id = ?", crID).Order("timestamp ASC").Find(&history).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
 		return
 	}
@@ -454,6 +857,413 @@ func GetHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, history)
 }
 
+// ListPayloadRevisions lists every payload a CR has had, oldest first
+func ListPayloadRevisions(c *gin.Context) {
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var revisions []models.PayloadRevision
+	if err := database.DB.Preload("CreatedBy").Where("cr_id = ?", crID).Order("number ASC").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payload revisions"})
+		return
+	}
+	if len(revisions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetPayloadDiff compares two payload revisions of a CR. Without to it compares
+// against the latest revision; without from, against the last revision of the
+// previous review round, i.e. what reviewers saw before the rework.
+func GetPayloadDiff(c *gin.Context) {
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	to, reqErr := loadPayloadRevision(crID, c.Query("to"), nil)
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+	from, reqErr := loadPayloadRevision(crID, c.Query("from"), to)
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	changes, err := services.DiffPayloads(from.ConfigChangesPayload, to.ConfigChangesPayload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cr_id":   crID,
+		"from":    gin.H{"number": from.Number, "revision": from.Revision, "created_at": from.CreatedAt, "created_by_user_id": from.CreatedByUserID},
+		"to":      gin.H{"number": to.Number, "revision": to.Revision, "created_at": to.CreatedAt, "created_by_user_id": to.CreatedByUserID},
+		"changes": changes,
+		"summary": services.SummarizePayloadChanges(changes),
+	})
+}
+
+// loadPayloadRevision loads the revision with the number in param. An empty
+// param picks the latest revision, or with base set, the revision to compare
+// base against.
+func loadPayloadRevision(crID uint, param string, base *models.PayloadRevision) (*models.PayloadRevision, *requestError) {
+	var revision models.PayloadRevision
+	var err error
+	query := database.DB.Where("cr_id = ?", crID)
+	switch {
+	case param != "":
+		number, ok := utils.ParseUint(param)
+		if !ok {
+			return nil, &requestError{http.StatusBadRequest, gin.H{"error": "Invalid revision number " + param}}
+		}
+		err = query.First(&revision, "number = ?", number).Error
+	case base != nil:
+		// What reviewers saw before base's review round, else the revision before base
+		err = query.Where("revision < ?", base.Revision).Order("number DESC").First(&revision).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = database.DB.Where("cr_id = ? AND number < ?", crID, base.Number).Order("number DESC").First(&revision).Error
+		}
+	default:
+		err = query.Order("number DESC").First(&revision).Error
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if param == "" && base != nil {
+			return nil, &requestError{http.StatusNotFound, gin.H{"error": "The change request has no earlier payload revision"}}
+		}
+		return nil, &requestError{http.StatusNotFound, gin.H{"error": "Payload revision not found"}}
+	}
+	if err != nil {
+		return nil, &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to fetch payload revision"}}
+	}
+	return &revision, nil
+}
+
+// VerifyChangeRequestHistory checks the hash chain of a CR's audit trail
+func VerifyChangeRequestHistory(c *gin.Context) {
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	result, err := services.VerifyHistory(database.DB, &crID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// VerifyHistory checks the hash chain over the audit trail of all CRs
+func VerifyHistory(c *gin.Context) {
+	result, err := services.VerifyHistory(database.DB, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetChangeRequestTransitions lists the transitions the caller may perform on a CR next
+func GetChangeRequestTransitions(c *gin.Context) {
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	actor, err := requestActor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cr_id":            cr.CRID,
+		"approval_status":  cr.ApprovalStatus,
+		"execution_status": cr.ExecutionStatus,
+		"roles":            actor.RolesFor(&cr),
+		"transitions":      services.AvailableTransitions(&cr, actor),
+	})
+}
+
+// GetChangeRequestPlan shows what applying a CR would change on the gateway
+func GetChangeRequestPlan(c *gin.Context) {
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	if automationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Automation service not initialized"})
+		return
+	}
+
+	kong, err := automationService.KongClientFor(&cr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if kong == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kong Admin API is not configured"})
+		return
+	}
+
+	plan, err := services.NewPlanner(kong).PlanChangeRequest(&cr)
+	if err != nil {
+		var kongErr *services.KongError
+		if errors.As(err, &kongErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// RollbackChangeRequest creates a CR that restores the gateway state captured
+// before an executed CR was applied
+func RollbackChangeRequest(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var original models.ChangeRequest
+	if err := database.DB.First(&original, "cr_id = ?", crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	if original.ExecutionStatus != models.ExecutionStatusCompleted && original.ExecutionStatus != models.ExecutionStatusFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only completed or failed change requests can be rolled back"})
+		return
+	}
+
+	var req RollbackCRRequest
+	// Body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	payload, err := services.BuildRollbackPayload(&original)
+	if errors.Is(err, services.ErrSnapshotNotRestorable) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Refuse a snapshot the executor could not apply before a rollback CR is created for it
+	if err := services.ValidateConfigChanges(payload); err != nil {
+		var validationErr *services.PayloadValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "The pre-change snapshot cannot be restored by a rollback change request",
+				"details": validationErr.Errors,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate rollback payload"})
+		return
+	}
+
+	rollback := models.ChangeRequest{
+		RequesterUserID:      userID,
+		RequesterTeamID:      original.RequesterTeamID,
+		Title:                fmt.Sprintf("Rollback of CR #%d: %s", original.CRID, original.Title),
+		ConfigChangesPayload: payload,
+		ApprovalStatus:       models.ApprovalStatusPending,
+		ExecutionStatus:      models.ExecutionStatusDraft,
+		RollbackOfCRID:       &original.CRID,
+		EnvironmentID:        original.EnvironmentID,
+		Type:                 services.KongServiceCRType,
+		SchemaVersion:        original.SchemaVersion,
+		Revision:             1,
+		Version:              1,
+	}
+	tx := database.DB.Begin()
+	if err := tx.Create(&rollback).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rollback change request"})
+		return
+	}
+	if _, _, err := services.RecordPayloadRevision(tx, &rollback, userID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := clientActor(c)
+	originalStatus := string(original.ExecutionStatus)
+	entries := []models.History{
+		actor.NewHistory(rollback.CRID, "CREATED", "", string(models.ApprovalStatusPending), ""),
+		actor.NewHistory(original.CRID, "ROLLBACK_REQUESTED", originalStatus, originalStatus, fmt.Sprintf("Rollback CR %d created", rollback.CRID)),
+	}
+	for i := range entries {
+		if err := services.RecordHistory(tx, &entries[i]); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create history"})
+			return
+		}
+	}
+	if err := services.PublishEvent(tx, models.WebhookEventCRCreated, &rollback, map[string]interface{}{"rollback_of_cr_id": original.CRID}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AutoApprove {
+		actor.System = true
+		if err := services.ApplyTransition(tx, &rollback, models.ActionAutoApprove, actor, "Rollback requested with auto_approve"); err != nil {
+			tx.Rollback()
+			reqErr := transitionError(err)
+			c.JSON(reqErr.Status, reqErr.Body)
+			return
+		}
+		if err := services.EnqueueProcessCR(tx, rollback.CRID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue automation"})
+			return
+		}
+	}
+
+	tx.Commit()
+
+	database.DB.Preload("RequesterUser").Preload("RequesterTeam").First(&rollback, rollback.CRID)
+
+	c.JSON(http.StatusCreated, rollback)
+}
+
+// PromoteChangeRequest clones a completed CR into the next environment as a new pending CR
+func PromoteChangeRequest(c *gin.Context) {
+	crIDStr := c.Param("id")
+	crID, ok := utils.ParseUint(crIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CR ID"})
+		return
+	}
+
+	var parent models.ChangeRequest
+	if err := database.DB.Preload("Environment").First(&parent, "cr_id = ?", crID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+
+	if parent.ExecutionStatus != models.ExecutionStatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only completed change requests can be promoted"})
+		return
+	}
+	if parent.Environment == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Change request has no target environment"})
+		return
+	}
+
+	var next models.Environment
+	if err := database.DB.Where("promotion_order > ?", parent.Environment.PromotionOrder).
+		Order("promotion_order ASC").First(&next).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Environment " + parent.Environment.Name + " is the last stage"})
+		return
+	}
+
+	var req PromoteCRRequest
+	// Body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Title == "" {
+		req.Title = parent.Title
+	}
+
+	actor := clientActor(c)
+	promoted, env, reqErr := newChangeRequest(actor, CreateCRRequest{
+		Title:                req.Title,
+		ConfigChangesPayload: parent.ConfigChangesPayload,
+		RequesterTeamID:      parent.RequesterTeamID,
+		EnvironmentID:        &next.EnvironmentID,
+		Type:                 parent.Type,
+		SchemaVersion:        parent.SchemaVersion,
+		parentCRID:           &parent.CRID,
+	})
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	// The promoted CR and the parent's PROMOTED entry are recorded together
+	tx := database.DB.Begin()
+	if reqErr := storeChangeRequest(tx, actor, promoted); reqErr != nil {
+		tx.Rollback()
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+	parentStatus := string(parent.ExecutionStatus)
+	details := fmt.Sprintf("Promoted to %s as CR %d", next.Name, promoted.CRID)
+	history := actor.NewHistory(parent.CRID, "PROMOTED", parentStatus, parentStatus, details)
+	if err := services.RecordHistory(tx, &history); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create history"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create change request"})
+		return
+	}
+	finishChangeRequest(promoted, env, actor)
+
+	c.JSON(http.StatusCreated, promoted)
+}
+
 // Helper function
 func parseInt(s string) int {
 	var result int
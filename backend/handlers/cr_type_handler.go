@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CreateCRTypeRequest struct {
+	Name           string `json:"name" binding:"required"`
+	DisplayName    string `json:"display_name" binding:"required"`
+	Description    string `json:"description"`
+	FormDefinition string `json:"form_definition" binding:"required"` // JSON, same layout as apiProps.json
+	Schema         string `json:"schema" binding:"required"`          // JSON Schema of config_changes_payload
+}
+
+type UpdateCRTypeRequest struct {
+	DisplayName    string  `json:"display_name"`
+	Description    *string `json:"description"`
+	FormDefinition string  `json:"form_definition"` // Either of these creates a new version
+	Schema         string  `json:"schema"`
+}
+
+// CreateCRType registers a new change request type with its first version
+func CreateCRType(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req CreateCRTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !services.ValidCRTypeName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type name must be lowercase letters, digits and dashes"})
+		return
+	}
+
+	var existing models.CRType
+	if err := database.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Change request type already exists"})
+		return
+	}
+
+	if msg := checkCRTypeDefinition(req.FormDefinition, req.Schema); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	crType := models.CRType{
+		Name:          req.Name,
+		DisplayName:   req.DisplayName,
+		Description:   req.Description,
+		LatestVersion: 1,
+		Versions: []models.CRTypeVersion{{
+			Version:         1,
+			FormDefinition:  req.FormDefinition,
+			Schema:          req.Schema,
+			CreatedByUserID: userID,
+		}},
+	}
+
+	if err := database.DB.Create(&crType).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create change request type"})
+		return
+	}
+	recordAudit(c, models.AuditConfigCreated, "cr_type", crType.Name, gin.H{"value": crType})
+
+	c.JSON(http.StatusCreated, crType)
+}
+
+// ListCRTypes lists all change request types
+func ListCRTypes(c *gin.Context) {
+	var crTypes []models.CRType
+	if err := database.DB.Order("name ASC").Find(&crTypes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch change request types"})
+		return
+	}
+
+	c.JSON(http.StatusOK, crTypes)
+}
+
+// GetCRType retrieves a change request type with all of its versions
+func GetCRType(c *gin.Context) {
+	var crType models.CRType
+	if err := database.DB.
+		Preload("Versions", func(db *gorm.DB) *gorm.DB { return db.Order("version ASC") }).
+		Where("name = ?", c.Param("name")).
+		First(&crType).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request type not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, crType)
+}
+
+// GetCRTypeVersion retrieves one version of a change request type.
+// "latest" selects the current version.
+func GetCRTypeVersion(c *gin.Context) {
+	version := 0
+	if versionStr := c.Param("version"); versionStr != "latest" {
+		var err error
+		if version, err = strconv.Atoi(versionStr); err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+			return
+		}
+	}
+
+	_, typeVersion, err := services.ResolveCRTypeVersion(c.Param("name"), version)
+	switch {
+	case errors.Is(err, services.ErrCRTypeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request type not found"})
+		return
+	case errors.Is(err, services.ErrCRTypeVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch change request type"})
+		return
+	}
+
+	c.JSON(http.StatusOK, typeVersion)
+}
+
+// UpdateCRType updates a change request type. Versions are immutable, so a new
+// form definition or schema is stored as the next version; existing CRs keep
+// validating against the version they were authored with.
+func UpdateCRType(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var crType models.CRType
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&crType).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request type not found"})
+		return
+	}
+
+	var req UpdateCRTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DisplayName != "" {
+		crType.DisplayName = req.DisplayName
+	}
+	if req.Description != nil {
+		crType.Description = *req.Description
+	}
+
+	var newVersion *models.CRTypeVersion
+	if req.FormDefinition != "" || req.Schema != "" {
+		var latest models.CRTypeVersion
+		if err := database.DB.Where("cr_type_id = ? AND version = ?", crType.CRTypeID, crType.LatestVersion).First(&latest).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load latest version"})
+			return
+		}
+
+		// Carry over the part that is not being changed
+		formDefinition := latest.FormDefinition
+		if req.FormDefinition != "" {
+			formDefinition = req.FormDefinition
+		}
+		schema := latest.Schema
+		if req.Schema != "" {
+			schema = req.Schema
+		}
+		if msg := checkCRTypeDefinition(formDefinition, schema); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		crType.LatestVersion++
+		newVersion = &models.CRTypeVersion{
+			CRTypeID:        crType.CRTypeID,
+			Version:         crType.LatestVersion,
+			FormDefinition:  formDefinition,
+			Schema:          schema,
+			CreatedByUserID: userID,
+		}
+	}
+
+	tx := database.DB.Begin()
+	if newVersion != nil {
+		if err := tx.Create(newVersion).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create version"})
+			return
+		}
+	}
+	if err := tx.Save(&crType).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update change request type"})
+		return
+	}
+	tx.Commit()
+	recordAudit(c, models.AuditConfigUpdated, "cr_type", crType.Name, gin.H{"value": crType, "new_version": newVersion != nil})
+
+	c.JSON(http.StatusOK, crType)
+}
+
+// DeleteCRType deletes a custom change request type no change request uses
+func DeleteCRType(c *gin.Context) {
+	var crType models.CRType
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&crType).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request type not found"})
+		return
+	}
+
+	if crType.Builtin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in change request types cannot be deleted"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.ChangeRequest{}).Where("type = ?", crType.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Change request type is used by change requests"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("cr_type_id = ?", crType.CRTypeID).Delete(&models.CRTypeVersion{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete change request type"})
+		return
+	}
+	if err := tx.Delete(&crType).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete change request type"})
+		return
+	}
+	tx.Commit()
+	recordAudit(c, models.AuditConfigDeleted, "cr_type", crType.Name, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Change request type deleted successfully"})
+}
+
+// checkCRTypeDefinition returns why a form definition and schema cannot be stored, or ""
+func checkCRTypeDefinition(formDefinition, schema string) string {
+	var form struct {
+		Elements []json.RawMessage `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(formDefinition), &form); err != nil || form.Elements == nil {
+		return "form_definition must be an object with an elements array"
+	}
+	if _, err := services.CompileCRTypeSchema(schema); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var driftDetector *services.DriftDetector
+
+// InitDriftDetector creates the drift detector and starts it if an interval is configured.
+// Requires the automation service to be initialized.
+func InitDriftDetector(cfg config.DriftConfig) {
+	if automationService == nil {
+		return
+	}
+	driftDetector = services.NewDriftDetector(automationService, cfg.Interval, cfg.Notify)
+	if cfg.Interval > 0 {
+		driftDetector.Start()
+	}
+}
+
+// ListDriftFindings lists drift findings, open ones by default
+func ListDriftFindings(c *gin.Context) {
+	var findings []models.DriftFinding
+	query := database.DB.Order("detected_at DESC")
+
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+		query = query.Where("resolved_at IS NULL")
+	case "resolved":
+		query = query.Where("resolved_at IS NOT NULL")
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be open, resolved or all"})
+		return
+	}
+	if service := c.Query("service"); service != "" {
+		query = query.Where("service_name = ?", service)
+	}
+	if envIDStr := c.Query("environment_id"); envIDStr != "" {
+		if envID, ok := utils.ParseUint(envIDStr); ok {
+			query = query.Where("environment_id = ?", envID)
+		}
+	}
+
+	if err := query.Find(&findings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drift findings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, findings)
+}
+
+// RunDriftCheck runs a drift check immediately
+func RunDriftCheck(c *gin.Context) {
+	if driftDetector == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Automation service not initialized"})
+		return
+	}
+
+	created, err := driftDetector.Check()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"new_findings": created})
+}
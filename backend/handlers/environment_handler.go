@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EnvironmentRequest struct {
+	Name           string `json:"name" binding:"required"`
+	KongAdminURL   string `json:"kong_admin_url"`
+	KongAdminToken string `json:"kong_admin_token"`
+	PromotionOrder int    `json:"promotion_order"`
+	AutoApprove    bool   `json:"auto_approve"`
+}
+
+// CreateEnvironment creates a new environment
+func CreateEnvironment(c *gin.Context) {
+	var req EnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing models.Environment
+	if err := database.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Environment already exists"})
+		return
+	}
+
+	env := models.Environment{
+		Name:           req.Name,
+		KongAdminURL:   req.KongAdminURL,
+		KongAdminToken: req.KongAdminToken,
+		PromotionOrder: req.PromotionOrder,
+		AutoApprove:    req.AutoApprove,
+	}
+
+	if err := database.DB.Create(&env).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create environment"})
+		return
+	}
+	recordAudit(c, models.AuditConfigCreated, "environment", env.EnvironmentID, gin.H{"value": env})
+
+	c.JSON(http.StatusCreated, env)
+}
+
+// ListEnvironments lists all environments in promotion order
+func ListEnvironments(c *gin.Context) {
+	var envs []models.Environment
+	if err := database.DB.Order("promotion_order ASC").Find(&envs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch environments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, envs)
+}
+
+// GetEnvironment retrieves a single environment
+func GetEnvironment(c *gin.Context) {
+	envIDStr := c.Param("id")
+	envID, ok := utils.ParseUint(envIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	var env models.Environment
+	if err := database.DB.First(&env, "environment_id = ?", envID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Environment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, env)
+}
+
+// UpdateEnvironment updates an environment's gateway endpoint and approval rules
+func UpdateEnvironment(c *gin.Context) {
+	envIDStr := c.Param("id")
+	envID, ok := utils.ParseUint(envIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	var env models.Environment
+	if err := database.DB.First(&env, "environment_id = ?", envID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Environment not found"})
+		return
+	}
+
+	var req EnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	env.Name = req.Name
+	env.KongAdminURL = req.KongAdminURL
+	env.PromotionOrder = req.PromotionOrder
+	env.AutoApprove = req.AutoApprove
+	// Keep the stored token unless a new one is sent
+	if req.KongAdminToken != "" {
+		env.KongAdminToken = req.KongAdminToken
+	}
+
+	if err := database.DB.Save(&env).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update environment"})
+		return
+	}
+	recordAudit(c, models.AuditConfigUpdated, "environment", env.EnvironmentID, gin.H{"value": env})
+
+	c.JSON(http.StatusOK, env)
+}
+
+// DeleteEnvironment deletes an environment no change request targets
+func DeleteEnvironment(c *gin.Context) {
+	envIDStr := c.Param("id")
+	envID, ok := utils.ParseUint(envIDStr)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.ChangeRequest{}).Where("environment_id = ?", envID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Environment is targeted by change requests"})
+		return
+	}
+
+	if err := database.DB.Where("environment_id = ?", envID).Delete(&models.Environment{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete environment"})
+		return
+	}
+	recordAudit(c, models.AuditConfigDeleted, "environment", envID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Environment deleted successfully"})
+}
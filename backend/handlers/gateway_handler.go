@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportDeckResponse lists the CRs created from a decK file
+type ImportDeckResponse struct {
+	ChangeRequests []models.ChangeRequest `json:"change_requests"`
+	Warnings       []string               `json:"warnings,omitempty"`
+}
+
+// ExportGatewayConfig exports the state built from completed CRs as a decK file
+func ExportGatewayConfig(c *gin.Context) {
+	scope := services.DefaultGatewayScope()
+	if envIDStr := c.Query("environment_id"); envIDStr != "" {
+		envID, ok := utils.ParseUint(envIDStr)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+			return
+		}
+		scope = services.EnvironmentScope(envID)
+	}
+
+	state, err := services.BuildExpectedState(scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build gateway state"})
+		return
+	}
+
+	file, err := services.ExportDeck(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "yaml") {
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="kong.json"`)
+		c.JSON(http.StatusOK, file)
+	case "yaml":
+		data, err := yaml.Marshal(file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode decK file"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="kong.yaml"`)
+		c.Data(http.StatusOK, "application/yaml", data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Must be yaml or json"})
+	}
+}
+
+// ImportGatewayConfig splits a decK file into one change request per service
+func ImportGatewayConfig(c *gin.Context) {
+	teamID, ok := utils.ParseUint(c.Query("team_id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "team_id query parameter is required"})
+		return
+	}
+
+	var environmentID *uint
+	if envIDStr := c.Query("environment_id"); envIDStr != "" {
+		envID, ok := utils.ParseUint(envIDStr)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+			return
+		}
+		environmentID = &envID
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	file, err := services.ParseDeck(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Convert and validate every service before creating anything so a bad file creates no CRs
+	actor := clientActor(c)
+	var crs []*models.ChangeRequest
+	var env *models.Environment
+	var warnings []string
+	for _, svc := range file.Services {
+		changes, svcWarnings, err := svc.ToConfigChanges()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		payload, err := json.Marshal(changes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode config changes"})
+			return
+		}
+		cr, crEnv, reqErr := newChangeRequest(actor, CreateCRRequest{
+			Title:                fmt.Sprintf("Import decK service %s", svc.Name),
+			ConfigChangesPayload: string(payload),
+			RequesterTeamID:      teamID,
+			EnvironmentID:        environmentID,
+		})
+		if reqErr != nil {
+			if msg, ok := reqErr.Body["error"].(string); ok {
+				reqErr.Body["error"] = fmt.Sprintf("service %s: %s", svc.Name, msg)
+			}
+			c.JSON(reqErr.Status, reqErr.Body)
+			return
+		}
+		warnings = append(warnings, svcWarnings...)
+		crs = append(crs, cr)
+		env = crEnv
+	}
+
+	// The CRs of a file are created together or not at all
+	tx := database.DB.Begin()
+	for _, cr := range crs {
+		if reqErr := storeChangeRequest(tx, actor, cr); reqErr != nil {
+			tx.Rollback()
+			c.JSON(reqErr.Status, reqErr.Body)
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create change requests"})
+		return
+	}
+
+	resp := ImportDeckResponse{Warnings: warnings}
+	for _, cr := range crs {
+		finishChangeRequest(cr, env, actor)
+		resp.ChangeRequests = append(resp.ChangeRequests, *cr)
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var jobQueue *services.JobQueue
+
+// InitJobQueue creates the job queue with the automation job handlers and starts its workers.
+// Requires the automation service to be initialized.
+func InitJobQueue(cfg config.JobsConfig) {
+	if automationService == nil {
+		return
+	}
+	jobQueue = services.NewJobQueue(cfg.Workers, cfg.PollInterval, cfg.MaxAttempts, cfg.Backoff, cfg.Lease)
+	automationService.RegisterJobs(jobQueue)
+	if cfg.Workers > 0 {
+		jobQueue.Start()
+	}
+}
+
+// ListJobs lists background jobs, newest first
+func ListJobs(c *gin.Context) {
+	var jobs []models.Job
+	query := database.DB.Order("job_id DESC")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if crIDStr := c.Query("cr_id"); crIDStr != "" {
+		if crID, ok := utils.ParseUint(crIDStr); ok {
+			query = query.Where("cr_id = ?", crID)
+		}
+	}
+
+	// Pagination
+	page := parseInt(c.DefaultQuery("page", "1"))
+	limit := parseInt(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if page > 1 {
+		query = query.Offset((page - 1) * limit)
+	}
+
+	if err := query.Limit(limit).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob retrieves a single job
+func GetJob(c *gin.Context) {
+	jobID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	var job models.Job
+	if err := database.DB.First(&job, "job_id = ?", jobID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryJob gives a dead job a fresh set of attempts
+func RetryJob(c *gin.Context) {
+	jobID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := services.RetryJob(jobID)
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	case errors.Is(err, services.ErrJobNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
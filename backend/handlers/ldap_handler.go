@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"alpaka/backend/config"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ldapDirectory *services.LDAPDirectory
+
+// InitLDAP makes Login bind against the directory if one is configured and
+// starts the periodic group sync
+func InitLDAP(cfg config.LDAPConfig) {
+	if cfg.URL == "" {
+		return
+	}
+	ldapDirectory = services.NewLDAPDirectory(cfg)
+	log.Printf("LDAP login enabled for %s", cfg.URL)
+	if cfg.SyncInterval > 0 {
+		ldapDirectory.Start()
+	}
+}
+
+// RunLDAPSync mirrors the directory's groups into teams and roles now
+func RunLDAPSync(c *gin.Context) {
+	if ldapDirectory == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "LDAP is not configured"})
+		return
+	}
+
+	report, err := ldapDirectory.Sync()
+	// The changes it made are recorded one by one
+	recordAudit(c, models.AuditLDAPSync, "", "", gin.H{"error": report.Error})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetLDAPSyncReport returns the report of the last sync
+func GetLDAPSyncReport(c *gin.Context) {
+	if ldapDirectory == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "LDAP is not configured"})
+		return
+	}
+
+	report := ldapDirectory.LastReport()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No LDAP sync has run yet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcCookie keeps the login state between the redirect to the provider and its callback
+const oidcCookie = "alpaka_oidc"
+
+var oidcClient *services.OIDCClient
+
+// InitOIDC enables single sign-on if an issuer is configured
+func InitOIDC(cfg config.OIDCConfig) {
+	if cfg.IssuerURL == "" {
+		return
+	}
+	oidcClient = services.NewOIDCClient(cfg)
+	log.Printf("OIDC login enabled for %s", cfg.IssuerURL)
+}
+
+// GetAuthProviders tells the login page which sign-in methods are available
+func GetAuthProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"local_login": localLogin || ldapDirectory != nil,
+		"ldap":        ldapDirectory != nil,
+		"oidc":        oidcClient != nil,
+	})
+}
+
+// OIDCLogin redirects the user to the identity provider
+func OIDCLogin(c *gin.Context) {
+	if oidcClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	authURL, login, err := oidcClient.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err := json.Marshal(login)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	// Lax so the cookie comes along when the provider redirects back
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, base64.RawURLEncoding.EncodeToString(state), 600, "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes a login: it validates the provider's response,
+// provisions the user and starts a session
+func OIDCCallback(c *gin.Context) {
+	if oidcClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		recordLoginFailed(c, "", "oidc", "provider error "+errCode)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed at the identity provider: " + errCode, "description": c.Query("error_description")})
+		return
+	}
+
+	encoded, err := c.Cookie(oidcCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login expired, please start again"})
+		return
+	}
+	c.SetCookie(oidcCookie, "", -1, "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+
+	var login services.OIDCLogin
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(raw, &login) != nil || login.State == "" || login.State != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state"})
+		return
+	}
+
+	identity, err := oidcClient.Exchange(c.Request.Context(), c.Query("code"), &login)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		recordLoginFailed(c, "", "oidc", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed: " + err.Error()})
+		return
+	}
+
+	user, err := oidcClient.Login(identity)
+	if err != nil {
+		log.Printf("OIDC provisioning failed for %s: %v", identity.Subject, err)
+		recordLoginFailed(c, identity.Username, "oidc", err.Error())
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	loadUserRoles(user)
+
+	resp, _, err := issueTokens(database.DB, c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordAuditAs(c, user.UserID, user.Username, models.AuditLogin, "user", user.UserID, gin.H{"method": "oidc"})
+
+	postLoginURL := oidcClient.Config.PostLoginURL
+	if postLoginURL == "" {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	// Hand the tokens to the frontend in the fragment, which is not sent to servers
+	fragment := url.Values{}
+	fragment.Set("token", resp.Token)
+	fragment.Set("refresh_token", resp.RefreshToken)
+	fragment.Set("expires_at", resp.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"))
+	c.Redirect(http.StatusFound, postLoginURL+"#"+fragment.Encode())
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleRequest struct {
+	Name        string              `json:"name" binding:"required"`
+	Description *string             `json:"description"`
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+}
+
+type RoleBindingRequest struct {
+	RoleID        uint  `json:"role_id" binding:"required"`
+	UserID        uint  `json:"user_id" binding:"required"`
+	TeamID        *uint `json:"team_id"`        // Limits the binding to one team
+	EnvironmentID *uint `json:"environment_id"` // Limits the binding to one environment
+}
+
+// ListPermissions lists the permissions roles can be granted
+func ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Permissions)
+}
+
+// CreateRole creates a custom role
+func CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.RoleDefinition{}
+	if reqErr := applyRoleRequest(&role, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	recordAudit(c, models.AuditRoleCreated, "role", role.RoleID, gin.H{"name": role.Name, "permissions": role.Permissions})
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// ListRoles lists all roles
+func ListRoles(c *gin.Context) {
+	var roles []models.RoleDefinition
+	if err := database.DB.Order("name ASC").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole retrieves a single role
+func GetRole(c *gin.Context) {
+	role, reqErr := loadRole(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// UpdateRole updates a custom role. Its bindings get the new permissions at once.
+func UpdateRole(c *gin.Context) {
+	role, reqErr := loadRole(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrBuiltInRole.Error()})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqErr := applyRoleRequest(role, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Save(role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	recordAudit(c, models.AuditRoleUpdated, "role", role.RoleID, gin.H{"name": role.Name, "permissions": role.Permissions})
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role and its bindings
+func DeleteRole(c *gin.Context) {
+	role, reqErr := loadRole(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrBuiltInRole.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.RoleID).Delete(&models.RoleBinding{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	recordAudit(c, models.AuditRoleDeleted, "role", role.RoleID, gin.H{"name": role.Name})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// CreateRoleBinding grants a role to a user, optionally limited to a team or environment
+func CreateRoleBinding(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req RoleBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.RoleDefinition
+	if err := database.DB.First(&role, "role_id = ?", req.RoleID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, "user_id = ?", req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if req.TeamID != nil {
+		var team models.Team
+		if err := database.DB.First(&team, "team_id = ?", *req.TeamID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Team not found"})
+			return
+		}
+	}
+	if req.EnvironmentID != nil {
+		var env models.Environment
+		if err := database.DB.First(&env, "environment_id = ?", *req.EnvironmentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Environment not found"})
+			return
+		}
+	}
+
+	// NULL scope columns would defeat a unique index, so duplicates are checked here
+	query := database.DB.Model(&models.RoleBinding{}).Where("role_id = ? AND user_id = ?", req.RoleID, req.UserID)
+	query = whereNullable(query, "team_id", req.TeamID)
+	query = whereNullable(query, "environment_id", req.EnvironmentID)
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role bindings"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role binding already exists"})
+		return
+	}
+
+	binding := models.RoleBinding{
+		RoleID:          req.RoleID,
+		UserID:          req.UserID,
+		TeamID:          req.TeamID,
+		EnvironmentID:   req.EnvironmentID,
+		CreatedByUserID: &userID,
+	}
+	if err := database.DB.Create(&binding).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role binding"})
+		return
+	}
+	recordAudit(c, models.AuditRoleGranted, "user", req.UserID, gin.H{
+		"role": role.Name, "binding_id": binding.BindingID, "team_id": req.TeamID, "environment_id": req.EnvironmentID,
+	})
+
+	roleBindingPreloads(database.DB).First(&binding, binding.BindingID)
+	c.JSON(http.StatusCreated, binding)
+}
+
+// ListRoleBindings lists role bindings with filters
+func ListRoleBindings(c *gin.Context) {
+	query := roleBindingPreloads(database.DB).Order("binding_id ASC")
+	for _, filter := range []string{"user_id", "role_id", "team_id", "environment_id"} {
+		if value := c.Query(filter); value != "" {
+			if id, ok := utils.ParseUint(value); ok {
+				query = query.Where(filter+" = ?", id)
+			}
+		}
+	}
+
+	var bindings []models.RoleBinding
+	if err := query.Find(&bindings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role bindings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, bindings)
+}
+
+// DeleteRoleBinding revokes a role binding
+func DeleteRoleBinding(c *gin.Context) {
+	bindingID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role binding ID"})
+		return
+	}
+
+	var binding models.RoleBinding
+	if err := database.DB.Preload("Role").First(&binding, "binding_id = ?", bindingID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role binding not found"})
+		return
+	}
+
+	result := database.DB.Where("binding_id = ?", bindingID).Delete(&models.RoleBinding{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role binding"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role binding not found"})
+		return
+	}
+	recordAudit(c, models.AuditRoleRevoked, "user", binding.UserID, gin.H{
+		"role": binding.Role.Name, "binding_id": binding.BindingID, "team_id": binding.TeamID, "environment_id": binding.EnvironmentID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role binding deleted successfully"})
+}
+
+// loadRole loads a role by its ID parameter
+func loadRole(idParam string) (*models.RoleDefinition, *requestError) {
+	roleID, ok := utils.ParseUint(idParam)
+	if !ok {
+		return nil, &requestError{http.StatusBadRequest, gin.H{"error": "Invalid role ID"}}
+	}
+
+	var role models.RoleDefinition
+	if err := database.DB.First(&role, "role_id = ?", roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &requestError{http.StatusNotFound, gin.H{"error": "Role not found"}}
+		}
+		return nil, &requestError{http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"}}
+	}
+	return &role, nil
+}
+
+// applyRoleRequest validates a request and copies it onto role
+func applyRoleRequest(role *models.RoleDefinition, req RoleRequest) *requestError {
+	for _, perm := range req.Permissions {
+		if !services.ValidPermission(perm) {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Unknown permission " + string(perm), "permissions": models.Permissions}}
+		}
+	}
+
+	var existing models.RoleDefinition
+	if err := database.DB.Where("name = ? AND role_id <> ?", req.Name, role.RoleID).First(&existing).Error; err == nil {
+		return &requestError{http.StatusConflict, gin.H{"error": "Role name already exists"}}
+	}
+
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Permissions = req.Permissions
+	return nil
+}
+
+func roleBindingPreloads(db *gorm.DB) *gorm.DB {
+	return db.Preload("Role").Preload("User").Preload("Team").Preload("Environment")
+}
+
+// whereNullable matches a nullable column against a value, or NULL for nil
+func whereNullable(query *gorm.DB, column string, value *uint) *gorm.DB {
+	if value == nil {
+		return query.Where(column + " IS NULL")
+	}
+	return query.Where(column+" = ?", *value)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var scheduler *services.Scheduler
+
+// InitScheduler creates the scheduler and starts it if an interval is configured.
+// Requires the automation service to be initialized.
+func InitScheduler(cfg config.SchedulerConfig) {
+	if automationService == nil {
+		return
+	}
+	scheduler = services.NewScheduler(automationService, cfg.Interval)
+	if cfg.Interval > 0 {
+		scheduler.Start()
+	}
+}
+
+type ChangeWindowRequest struct {
+	Name          string `json:"name" binding:"required"`
+	EnvironmentID *uint  `json:"environment_id"`
+	Weekday       *int   `json:"weekday" binding:"required"`    // 0 = Sunday
+	StartTime     string `json:"start_time" binding:"required"` // HH:MM
+	EndTime       string `json:"end_time" binding:"required"`   // HH:MM, after start_time
+	Timezone      string `json:"timezone"`                      // IANA name, defaults to UTC
+}
+
+type FreezePeriodRequest struct {
+	Name          string    `json:"name" binding:"required"`
+	EnvironmentID *uint     `json:"environment_id"`
+	StartsAt      time.Time `json:"starts_at" binding:"required"`
+	EndsAt        time.Time `json:"ends_at" binding:"required"`
+	Reason        string    `json:"reason"`
+}
+
+// CreateChangeWindow creates a new change window
+func CreateChangeWindow(c *gin.Context) {
+	var req ChangeWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window := models.ChangeWindow{}
+	if reqErr := applyChangeWindowRequest(&window, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Create(&window).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create change window"})
+		return
+	}
+	recordAudit(c, models.AuditConfigCreated, "change_window", window.WindowID, gin.H{"value": window})
+
+	c.JSON(http.StatusCreated, window)
+}
+
+// ListChangeWindows lists change windows, optionally for one environment
+func ListChangeWindows(c *gin.Context) {
+	var windows []models.ChangeWindow
+	query := database.DB.Order("weekday ASC").Order("start_time ASC")
+	if envIDStr := c.Query("environment_id"); envIDStr != "" {
+		if envID, ok := utils.ParseUint(envIDStr); ok {
+			query = query.Where("environment_id = ?", envID)
+		}
+	}
+
+	if err := query.Find(&windows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch change windows"})
+		return
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// UpdateChangeWindow updates a change window
+func UpdateChangeWindow(c *gin.Context) {
+	windowID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window ID"})
+		return
+	}
+
+	var window models.ChangeWindow
+	if err := database.DB.First(&window, "window_id = ?", windowID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change window not found"})
+		return
+	}
+
+	var req ChangeWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqErr := applyChangeWindowRequest(&window, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Save(&window).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update change window"})
+		return
+	}
+	recordAudit(c, models.AuditConfigUpdated, "change_window", window.WindowID, gin.H{"value": window})
+
+	c.JSON(http.StatusOK, window)
+}
+
+// DeleteChangeWindow deletes a change window
+func DeleteChangeWindow(c *gin.Context) {
+	windowID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window ID"})
+		return
+	}
+
+	if err := database.DB.Where("window_id = ?", windowID).Delete(&models.ChangeWindow{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete change window"})
+		return
+	}
+	recordAudit(c, models.AuditConfigDeleted, "change_window", windowID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Change window deleted successfully"})
+}
+
+// applyChangeWindowRequest validates a request and copies it onto window
+func applyChangeWindowRequest(window *models.ChangeWindow, req ChangeWindowRequest) *requestError {
+	if *req.Weekday < 0 || *req.Weekday > 6 {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "weekday must be between 0 (Sunday) and 6 (Saturday)"}}
+	}
+	start, err := services.ParseWindowTime(req.StartTime)
+	if err != nil {
+		return &requestError{http.StatusBadRequest, gin.H{"error": err.Error()}}
+	}
+	end, err := services.ParseWindowTime(req.EndTime)
+	if err != nil {
+		return &requestError{http.StatusBadRequest, gin.H{"error": err.Error()}}
+	}
+	if end <= start {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "end_time must be after start_time; split windows that cross midnight"}}
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "Unknown timezone " + req.Timezone}}
+	}
+	if reqErr := checkEnvironmentExists(req.EnvironmentID); reqErr != nil {
+		return reqErr
+	}
+
+	window.Name = req.Name
+	window.EnvironmentID = req.EnvironmentID
+	window.Weekday = *req.Weekday
+	window.StartTime = req.StartTime
+	window.EndTime = req.EndTime
+	window.Timezone = req.Timezone
+	return nil
+}
+
+// CreateFreezePeriod creates a new freeze period
+func CreateFreezePeriod(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req FreezePeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	freeze := models.FreezePeriod{CreatedByUserID: userID}
+	if reqErr := applyFreezePeriodRequest(&freeze, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Create(&freeze).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create freeze period"})
+		return
+	}
+	recordAudit(c, models.AuditConfigCreated, "freeze_period", freeze.FreezeID, gin.H{"value": freeze})
+
+	c.JSON(http.StatusCreated, freeze)
+}
+
+// ListFreezePeriods lists freeze periods, current and upcoming ones by default
+func ListFreezePeriods(c *gin.Context) {
+	var freezes []models.FreezePeriod
+	query := database.DB.Order("starts_at ASC")
+
+	switch c.DefaultQuery("status", "upcoming") {
+	case "upcoming":
+		query = query.Where("ends_at > ?", time.Now())
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be upcoming or all"})
+		return
+	}
+	if envIDStr := c.Query("environment_id"); envIDStr != "" {
+		if envID, ok := utils.ParseUint(envIDStr); ok {
+			query = query.Where("environment_id = ?", envID)
+		}
+	}
+
+	if err := query.Find(&freezes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch freeze periods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, freezes)
+}
+
+// UpdateFreezePeriod updates a freeze period, e.g. to end it early
+func UpdateFreezePeriod(c *gin.Context) {
+	freezeID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freeze ID"})
+		return
+	}
+
+	var freeze models.FreezePeriod
+	if err := database.DB.First(&freeze, "freeze_id = ?", freezeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Freeze period not found"})
+		return
+	}
+
+	var req FreezePeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqErr := applyFreezePeriodRequest(&freeze, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Save(&freeze).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update freeze period"})
+		return
+	}
+	recordAudit(c, models.AuditConfigUpdated, "freeze_period", freeze.FreezeID, gin.H{"value": freeze})
+
+	c.JSON(http.StatusOK, freeze)
+}
+
+// DeleteFreezePeriod deletes a freeze period
+func DeleteFreezePeriod(c *gin.Context) {
+	freezeID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freeze ID"})
+		return
+	}
+
+	if err := database.DB.Where("freeze_id = ?", freezeID).Delete(&models.FreezePeriod{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete freeze period"})
+		return
+	}
+	recordAudit(c, models.AuditConfigDeleted, "freeze_period", freezeID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Freeze period deleted successfully"})
+}
+
+// applyFreezePeriodRequest validates a request and copies it onto freeze
+func applyFreezePeriodRequest(freeze *models.FreezePeriod, req FreezePeriodRequest) *requestError {
+	if !req.EndsAt.After(req.StartsAt) {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"}}
+	}
+	if reqErr := checkEnvironmentExists(req.EnvironmentID); reqErr != nil {
+		return reqErr
+	}
+
+	freeze.Name = req.Name
+	freeze.EnvironmentID = req.EnvironmentID
+	freeze.StartsAt = req.StartsAt
+	freeze.EndsAt = req.EndsAt
+	freeze.Reason = req.Reason
+	return nil
+}
+
+// checkEnvironmentExists rejects references to unknown environments
+func checkEnvironmentExists(environmentID *uint) *requestError {
+	if environmentID == nil {
+		return nil
+	}
+	var env models.Environment
+	if err := database.DB.First(&env, "environment_id = ?", *environmentID).Error; err != nil {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "Environment not found"}}
+	}
+	return nil
+}
+
+// RunScheduler processes due change requests immediately
+func RunScheduler(c *gin.Context) {
+	if scheduler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Automation service not initialized"})
+		return
+	}
+
+	started, err := scheduler.RunDue()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"started": started})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ServiceAccountRequest struct {
+	Name          string  `json:"name" binding:"required"`
+	Description   *string `json:"description"`
+	Active        *bool   `json:"active"`         // Defaults to true
+	TeamID        *uint   `json:"team_id"`        // Limits the account's keys to CRs of a team
+	EnvironmentID *uint   `json:"environment_id"` // Limits the account's keys to CRs targeting an environment
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"` // Omit for a key that never expires
+}
+
+// CreateServiceAccount creates a new service account
+func CreateServiceAccount(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req ServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqErr := checkServiceAccountScope(req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	account := models.ServiceAccount{
+		Name:            req.Name,
+		Description:     req.Description,
+		Active:          req.Active == nil || *req.Active,
+		TeamID:          req.TeamID,
+		EnvironmentID:   req.EnvironmentID,
+		CreatedByUserID: userID,
+	}
+
+	var existing models.ServiceAccount
+	if err := database.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Service account name already exists"})
+		return
+	}
+
+	if err := database.DB.Create(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+	recordAudit(c, models.AuditServiceAccountCreated, "service_account", account.ServiceAccountID, gin.H{"name": account.Name, "active": account.Active, "team_id": account.TeamID, "environment_id": account.EnvironmentID})
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// ListServiceAccounts lists all service accounts
+func ListServiceAccounts(c *gin.Context) {
+	var accounts []models.ServiceAccount
+	if err := database.DB.Order("name ASC").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// GetServiceAccount retrieves a service account with its keys
+func GetServiceAccount(c *gin.Context) {
+	account, reqErr := loadServiceAccount(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	database.DB.Where("service_account_id = ?", account.ServiceAccountID).Order("key_id ASC").Find(&account.APIKeys)
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateServiceAccount renames, describes or (de)activates a service account
+func UpdateServiceAccount(c *gin.Context) {
+	account, reqErr := loadServiceAccount(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	var req ServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing models.ServiceAccount
+	if err := database.DB.Where("name = ? AND service_account_id <> ?", req.Name, account.ServiceAccountID).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Service account name already exists"})
+		return
+	}
+	if reqErr := checkServiceAccountScope(req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	account.Name = req.Name
+	account.Description = req.Description
+	account.TeamID = req.TeamID
+	account.EnvironmentID = req.EnvironmentID
+	if req.Active != nil {
+		account.Active = *req.Active
+	}
+
+	if err := database.DB.Save(account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service account"})
+		return
+	}
+	recordAudit(c, models.AuditServiceAccountUpdated, "service_account", account.ServiceAccountID, gin.H{"name": account.Name, "active": account.Active, "team_id": account.TeamID, "environment_id": account.EnvironmentID})
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DeleteServiceAccount deletes a service account and its keys.
+// History entries keep the account's ID.
+func DeleteServiceAccount(c *gin.Context) {
+	accountID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("service_account_id = ?", accountID).Delete(&models.APIKey{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API keys"})
+		return
+	}
+	if err := tx.Where("service_account_id = ?", accountID).Delete(&models.ServiceAccount{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account"})
+		return
+	}
+	recordAudit(c, models.AuditServiceAccountDeleted, "service_account", accountID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted successfully"})
+}
+
+// CreateAPIKey issues a key for a service account. The key is only returned by this call.
+func CreateAPIKey(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	account, reqErr := loadServiceAccount(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required", "scopes": models.APIKeyScopes})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !services.ValidAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope " + scope, "scopes": models.APIKeyScopes})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	key, prefix, err := services.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiKey := models.APIKey{
+		ServiceAccountID: account.ServiceAccountID,
+		Name:             req.Name,
+		Prefix:           prefix,
+		KeyHash:          services.HashAPIKey(key),
+		Scopes:           req.Scopes,
+		ExpiresAt:        req.ExpiresAt,
+		CreatedByUserID:  userID,
+	}
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	recordAudit(c, models.AuditAPIKeyIssued, "service_account", account.ServiceAccountID, gin.H{
+		"key_id": apiKey.KeyID, "prefix": apiKey.Prefix, "scopes": apiKey.Scopes, "expires_at": apiKey.ExpiresAt,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"key": key, "api_key": apiKey})
+}
+
+// ListAPIKeys lists the keys of a service account
+func ListAPIKeys(c *gin.Context) {
+	account, reqErr := loadServiceAccount(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	var keys []models.APIKey
+	if err := database.DB.Where("service_account_id = ?", account.ServiceAccountID).Order("key_id ASC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes a key of a service account. Revoked keys are kept for reference.
+func RevokeAPIKey(c *gin.Context) {
+	account, reqErr := loadServiceAccount(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	keyID, ok := utils.ParseUint(c.Param("key_id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := database.DB.First(&apiKey, "key_id = ? AND service_account_id = ?", keyID, account.ServiceAccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		if err := database.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		apiKey.RevokedAt = &now
+		recordAudit(c, models.AuditAPIKeyRevoked, "service_account", account.ServiceAccountID, gin.H{"key_id": apiKey.KeyID, "prefix": apiKey.Prefix})
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// loadServiceAccount loads a service account by its ID parameter
+func loadServiceAccount(idParam string) (*models.ServiceAccount, *requestError) {
+	accountID, ok := utils.ParseUint(idParam)
+	if !ok {
+		return nil, &requestError{http.StatusBadRequest, gin.H{"error": "Invalid service account ID"}}
+	}
+
+	var account models.ServiceAccount
+	if err := database.DB.First(&account, "service_account_id = ?", accountID).Error; err != nil {
+		return nil, &requestError{http.StatusNotFound, gin.H{"error": "Service account not found"}}
+	}
+	return &account, nil
+}
+
+// checkServiceAccountScope verifies that the team and environment a service account is limited to exist
+func checkServiceAccountScope(req ServiceAccountRequest) *requestError {
+	if req.TeamID != nil {
+		var team models.Team
+		if err := database.DB.First(&team, "team_id = ?", *req.TeamID).Error; err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Team not found"}}
+		}
+	}
+	if req.EnvironmentID != nil {
+		var env models.Environment
+		if err := database.DB.First(&env, "environment_id = ?", *req.EnvironmentID).Error; err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Environment not found"}}
+		}
+	}
+	return nil
+}
@@ -4,10 +4,13 @@ import (
 	"net/http"
 
 	"alpaka/backend/database"
+	"alpaka/backend/middleware"
 	"alpaka/backend/models"
+	"alpaka/backend/services"
 	"alpaka/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CreateTeamRequest struct {
@@ -34,14 +37,22 @@ func CreateTeam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
 		return
 	}
+	recordAudit(c, models.AuditTeamCreated, "team", team.TeamID, gin.H{"name": team.Name})
 
 	c.JSON(http.StatusCreated, team)
 }
 
-// ListTeams lists all teams
+// ListTeams lists the teams the user may see
 func ListTeams(c *gin.Context) {
+	grants, err := middleware.Grants(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var teams []models.Team
-	if err := database.DB.Preload("Members.User").Find(&teams).Error; err != nil {
+	query := services.ReadableTeams(database.DB.Preload("Members.User"), c.GetUint("user_id"), grants)
+	if err := query.Find(&teams).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
 		return
 	}
@@ -58,6 +69,10 @@ func GetTeam(c *gin.Context) {
 		return
 	}
 
+	if !authorizeTeam(c, c.GetUint("user_id"), teamID, services.CanReadTeam, "You do not have access to this team") {
+		return
+	}
+
 	var team models.Team
 	// Preload members with their user information
 	if err := database.DB.Preload("Members.User").First(&team, "team_id = ?", teamID).Error; err != nil {
@@ -72,7 +87,7 @@ func GetTeam(c *gin.Context) {
 // AddTeamMember adds a user to a team
 // User can add members if they are:
 // 1. A member of the team, OR
-// 2. A gateway editor
+// 2. Granted team.manage for the team
 func AddTeamMember(c *gin.Context) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
@@ -104,15 +119,8 @@ func AddTeamMember(c *gin.Context) {
 		return
 	}
 
-	// Check permissions: user must be either a member of the team OR a gateway editor
-	var membership models.UserTeamMembership
-	isTeamMember := database.DB.Where("user_id = ? AND team_id = ?", userID, teamID).First(&membership).Error == nil
-
-	var gatewayEditor models.GatewayEditor
-	isGatewayEditor := database.DB.Where("user_id = ?", userID).First(&gatewayEditor).Error == nil
-
-	if !isTeamMember && !isGatewayEditor {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You must be a member of this team or a gateway editor to add members"})
+	// Check permissions: user must be either a member of the team OR granted team.manage
+	if !authorizeTeam(c, userID, teamID, services.CanManageTeam, "You must be a member of this team or have team.manage to add members") {
 		return
 	}
 
@@ -130,7 +138,7 @@ func AddTeamMember(c *gin.Context) {
 		return
 	}
 
-	membership = models.UserTeamMembership{
+	membership := models.UserTeamMembership{
 		UserID: req.UserID,
 		TeamID: teamID,
 	}
@@ -139,6 +147,7 @@ func AddTeamMember(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add team member"})
 		return
 	}
+	recordAudit(c, models.AuditTeamMemberAdded, "team", teamID, gin.H{"user_id": req.UserID})
 
 	database.DB.Preload("User").Preload("Team").First(&membership, membership.UserID, membership.TeamID)
 	c.JSON(http.StatusCreated, membership)
@@ -147,7 +156,7 @@ func AddTeamMember(c *gin.Context) {
 // RemoveTeamMember removes a user from a team
 // User can remove members if they are:
 // 1. A member of the team, OR
-// 2. A gateway editor
+// 2. Granted team.manage for the team
 func RemoveTeamMember(c *gin.Context) {
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
@@ -170,22 +179,19 @@ func RemoveTeamMember(c *gin.Context) {
 		return
 	}
 
-	// Check permissions: user must be either a member of the team OR a gateway editor
-	var membership models.UserTeamMembership
-	isTeamMember := database.DB.Where("user_id = ? AND team_id = ?", currentUserID, teamID).First(&membership).Error == nil
-
-	var gatewayEditor models.GatewayEditor
-	isGatewayEditor := database.DB.Where("user_id = ?", currentUserID).First(&gatewayEditor).Error == nil
-
-	if !isTeamMember && !isGatewayEditor {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You must be a member of this team or a gateway editor to remove members"})
+	// Check permissions: user must be either a member of the team OR granted team.manage
+	if !authorizeTeam(c, currentUserID, teamID, services.CanManageTeam, "You must be a member of this team or have team.manage to remove members") {
 		return
 	}
 
-	if err := database.DB.Where("user_id = ? AND team_id = ?", userID, teamID).Delete(&models.UserTeamMembership{}).Error; err != nil {
+	result := database.DB.Where("user_id = ? AND team_id = ?", userID, teamID).Delete(&models.UserTeamMembership{})
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove team member"})
 		return
 	}
+	if result.RowsAffected > 0 {
+		recordAudit(c, models.AuditTeamMemberRemoved, "team", teamID, gin.H{"user_id": userID})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Team member removed successfully"})
 }
@@ -213,3 +219,23 @@ func GetMyTeams(c *gin.Context) {
 
 	c.JSON(http.StatusOK, teams)
 }
+
+// authorizeTeam runs a team access check for the current user and reports a refusal.
+// It returns whether the request may continue.
+func authorizeTeam(c *gin.Context, userID, teamID uint, check func(*gorm.DB, uint, services.Grants, uint) (bool, error), denied string) bool {
+	grants, err := middleware.Grants(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	allowed, err := check(database.DB, userID, grants, teamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": denied})
+		return false
+	}
+	return true
+}
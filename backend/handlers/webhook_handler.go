@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+	"alpaka/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookSubscriptionRequest struct {
+	Name   string                `json:"name" binding:"required"`
+	URL    string                `json:"url" binding:"required"`
+	Secret *string               `json:"secret"` // Omit on update to keep the current secret
+	Events []models.WebhookEvent `json:"events"` // Empty subscribes to every event
+	TeamID *uint                 `json:"team_id"`
+	Active *bool                 `json:"active"` // Defaults to true
+}
+
+// CreateWebhookSubscription creates a new webhook subscription
+func CreateWebhookSubscription(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := models.WebhookSubscription{CreatedByUserID: userID, Active: true}
+	if reqErr := applyWebhookSubscriptionRequest(&sub, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook subscription"})
+		return
+	}
+
+	sub.HasSecret = sub.Secret != ""
+	recordAudit(c, models.AuditConfigCreated, "webhook_subscription", sub.SubscriptionID, gin.H{"value": sub})
+	c.JSON(http.StatusCreated, sub)
+}
+
+// ListWebhookSubscriptions lists all webhook subscriptions
+func ListWebhookSubscriptions(c *gin.Context) {
+	var subs []models.WebhookSubscription
+	if err := database.DB.Order("name ASC").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook subscriptions"})
+		return
+	}
+
+	for i := range subs {
+		subs[i].HasSecret = subs[i].Secret != ""
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// GetWebhookSubscription retrieves a single webhook subscription
+func GetWebhookSubscription(c *gin.Context) {
+	sub, reqErr := loadWebhookSubscription(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// UpdateWebhookSubscription updates a webhook subscription
+func UpdateWebhookSubscription(c *gin.Context) {
+	sub, reqErr := loadWebhookSubscription(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqErr := applyWebhookSubscriptionRequest(sub, req); reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	if err := database.DB.Save(sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook subscription"})
+		return
+	}
+
+	sub.HasSecret = sub.Secret != ""
+	recordAudit(c, models.AuditConfigUpdated, "webhook_subscription", sub.SubscriptionID, gin.H{"value": sub})
+	c.JSON(http.StatusOK, sub)
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription. Its deliveries are kept.
+func DeleteWebhookSubscription(c *gin.Context) {
+	subID, ok := utils.ParseUint(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return
+	}
+
+	if err := database.DB.Where("subscription_id = ?", subID).Delete(&models.WebhookSubscription{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook subscription"})
+		return
+	}
+	recordAudit(c, models.AuditConfigDeleted, "webhook_subscription", subID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted successfully"})
+}
+
+// ListWebhookDeliveries lists the deliveries of a subscription, newest first
+func ListWebhookDeliveries(c *gin.Context) {
+	sub, reqErr := loadWebhookSubscription(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	var deliveries []models.WebhookDelivery
+	query := database.DB.Where("subscription_id = ?", sub.SubscriptionID).Order("delivery_id DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	limit := parseInt(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if page := parseInt(c.DefaultQuery("page", "1")); page > 1 {
+		query = query.Offset((page - 1) * limit)
+	}
+
+	if err := query.Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook sends the payload of an earlier delivery again as a new delivery
+func RedeliverWebhook(c *gin.Context) {
+	sub, reqErr := loadWebhookSubscription(c.Param("id"))
+	if reqErr != nil {
+		c.JSON(reqErr.Status, reqErr.Body)
+		return
+	}
+
+	deliveryID, ok := utils.ParseUint(c.Param("delivery_id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	var original models.WebhookDelivery
+	if err := database.DB.First(&original, "delivery_id = ? AND subscription_id = ?", deliveryID, sub.SubscriptionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook delivery not found"})
+		return
+	}
+
+	delivery, err := services.Redeliver(original.DeliveryID)
+	if errors.Is(err, services.ErrDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// loadWebhookSubscription loads a subscription by its ID parameter
+func loadWebhookSubscription(idParam string) (*models.WebhookSubscription, *requestError) {
+	subID, ok := utils.ParseUint(idParam)
+	if !ok {
+		return nil, &requestError{http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"}}
+	}
+
+	var sub models.WebhookSubscription
+	if err := database.DB.First(&sub, "subscription_id = ?", subID).Error; err != nil {
+		return nil, &requestError{http.StatusNotFound, gin.H{"error": "Webhook subscription not found"}}
+	}
+	sub.HasSecret = sub.Secret != ""
+	return &sub, nil
+}
+
+// applyWebhookSubscriptionRequest validates a request and copies it onto sub
+func applyWebhookSubscriptionRequest(sub *models.WebhookSubscription, req WebhookSubscriptionRequest) *requestError {
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &requestError{http.StatusBadRequest, gin.H{"error": "url must be an absolute http(s) URL"}}
+	}
+	for _, event := range req.Events {
+		if !services.ValidWebhookEvent(event) {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Unknown event " + string(event), "events": models.WebhookEvents}}
+		}
+	}
+	if req.TeamID != nil {
+		var team models.Team
+		if err := database.DB.First(&team, "team_id = ?", *req.TeamID).Error; err != nil {
+			return &requestError{http.StatusBadRequest, gin.H{"error": "Team not found"}}
+		}
+	}
+
+	sub.Name = req.Name
+	sub.URL = req.URL
+	if req.Secret != nil {
+		sub.Secret = *req.Secret
+	}
+	sub.Events = req.Events
+	if sub.Events == nil {
+		sub.Events = []models.WebhookEvent{}
+	}
+	sub.TeamID = req.TeamID
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	return nil
+}
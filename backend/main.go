@@ -6,6 +6,7 @@ import (
 	"alpaka/backend/config"
 	"alpaka/backend/database"
 	"alpaka/backend/routes"
+	"alpaka/backend/services"
 )
 
 func main() {
@@ -22,14 +23,43 @@ func main() {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Start the history hash chain, sealing entries written before it existed
+	if err := services.InitHistoryChain(); err != nil {
+		log.Fatalf("Failed to initialize history chain: %v", err)
+	}
+
+	// Keep the payload of CRs created before revisions were stored as their first revision
+	if err := services.SeedPayloadRevisions(); err != nil {
+		log.Fatalf("Failed to seed payload revisions: %v", err)
+	}
+
+	// Bind CRs approved before approval hashes were kept to their current payload
+	if err := services.SeedApprovedPayloadHashes(); err != nil {
+		log.Fatalf("Failed to seed approved payload hashes: %v", err)
+	}
+
+	// Create the built-in roles and move legacy Super Managers / Gateway Editors to role bindings
+	if err := services.SeedBuiltinRoles(); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+	}
+
+	// Register built-in change request types
+	if err := services.SeedBuiltinCRTypes(); err != nil {
+		log.Fatalf("Failed to seed change request types: %v", err)
+	}
+
+	// Subscribe the legacy WEBHOOK_URL to the events it used to receive
+	if err := services.SeedWebhookSubscription(cfg.Automation.WebhookURL); err != nil {
+		log.Fatalf("Failed to seed webhook subscription: %v", err)
+	}
+
 	// Create indexes
 	if err := database.CreateIndexes(); err != nil {
 		log.Printf("Warning: Failed to create indexes: %v", err)
 	}
 
 	// Setup routes
-	webhookURL := config.GetEnv("WEBHOOK_URL", "")
-	router := routes.SetupRoutes(webhookURL)
+	router := routes.SetupRoutes(cfg)
 
 	// Start server
 	addr := cfg.Server.Host + ":" + cfg.Server.Port
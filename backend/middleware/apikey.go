@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"alpaka/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the API key of a service account
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyOrAuth accepts a service account API key granted the scope, or else
+// validates a user JWT like AuthMiddleware. Sets "service_account_id",
+// "api_key_id", "api_key" and "service_account" for keys and "user_id" for users.
+func APIKeyOrAuth(scope string) gin.HandlerFunc {
+	userAuth := AuthMiddleware()
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			userAuth(c)
+			return
+		}
+
+		apiKey, account, err := services.AuthenticateAPIKey(key, scope)
+		if errors.Is(err, services.ErrAPIKeyScope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key requires scope " + scope})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		c.Set("service_account_id", apiKey.ServiceAccountID)
+		c.Set("api_key_id", apiKey.KeyID)
+		c.Set("api_key", apiKey)
+		c.Set("service_account", account)
+		c.Next()
+	}
+}
@@ -1,19 +1,19 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
-	"alpaka/backend/database"
-	"alpaka/backend/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"` // Login session the token was issued for
 	jwt.RegisteredClaims
 }
 
@@ -35,15 +35,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
-		claims := &Claims{}
-
-		// For now, we'll use a simple token validation
-		// In production, use proper JWT secret from config
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your-secret-key"), nil // Should come from config
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := jwtKeys.Parse(tokenString)
+		if errors.Is(err, ErrSessionRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been logged out"})
+			c.Abort()
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
@@ -52,48 +50,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Set user context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
-		c.Next()
-	}
-}
-
-// RequireSuperManager checks if user is a super manager
-func RequireSuperManager() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-			c.Abort()
-			return
-		}
-
-		var superManager models.SuperManager
-		if err := database.DB.Where("user_id = ?", userID).First(&superManager).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Super manager access required"})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
-
-// RequireGatewayEditor checks if user is a gateway editor
-func RequireGatewayEditor() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-			c.Abort()
-			return
-		}
-
-		var gatewayEditor models.GatewayEditor
-		if err := database.DB.Where("user_id = ?", userID).First(&gatewayEditor).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Gateway editor access required"})
-			c.Abort()
-			return
-		}
-
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
@@ -106,14 +63,10 @@ func OptionalAuth() gin.HandlerFunc {
 			parts := strings.Split(authHeader, " ")
 			if len(parts) == 2 && parts[0] == "Bearer" {
 				tokenString := parts[1]
-				claims := &Claims{}
-				token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-					return []byte("your-secret-key"), nil
-				})
-
-				if err == nil && token.Valid {
+				if claims, err := jwtKeys.Parse(tokenString); err == nil {
 					c.Set("user_id", claims.UserID)
 					c.Set("username", claims.Username)
+					c.Set("session_id", claims.SessionID)
 				}
 			}
 		}
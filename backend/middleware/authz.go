@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+	"alpaka/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScopeFunc resolves the team and environment of the resource a request is
+// about. ok is false when the resource does not exist; the handler reports that.
+type ScopeFunc func(c *gin.Context) (scope services.Scope, ok bool)
+
+// Grants returns the role bindings of the authenticated user, loading them once per request
+func Grants(c *gin.Context) (services.Grants, error) {
+	if grants, ok := c.Get("grants"); ok {
+		return grants.(services.Grants), nil
+	}
+
+	grants, err := services.LoadGrants(database.DB, c.GetUint("user_id"))
+	if err != nil {
+		return nil, err
+	}
+	c.Set("grants", grants)
+	return grants, nil
+}
+
+// RequirePermission checks that the user holds a permission in the scope of the
+// requested resource. Without a ScopeFunc only bindings that are not limited to
+// a team or environment count. Service accounts authenticated by APIKeyOrAuth
+// need a key scope granting the permission, within their team and environment.
+func RequirePermission(perm models.Permission, scopeFunc ...ScopeFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, isServiceAccount := c.Get("service_account_id")
+		if _, exists := c.Get("user_id"); !exists && !isServiceAccount {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		var scope services.Scope
+		if len(scopeFunc) > 0 {
+			var ok bool
+			if scope, ok = scopeFunc[0](c); !ok {
+				c.Next()
+				return
+			}
+		}
+
+		if isServiceAccount {
+			if !keyAllows(c, perm, scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key does not grant " + string(perm) + " for this resource"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		grants, err := Grants(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !grants.Allows(perm, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission " + string(perm) + " required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireCRAccess checks that the user may see the change request in the :id
+// parameter: its requester, members of its team and holders of cr.read.
+// Service accounts authenticated by APIKeyOrAuth need cr.read for the CR.
+func RequireCRAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cr, ok := loadCR(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if _, isServiceAccount := c.Get("service_account_id"); isServiceAccount {
+			if !keyAllows(c, models.PermCRRead, services.CRScope(cr)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this change request"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		grants, err := Grants(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		allowed, err := services.CanReadCR(database.DB, c.GetUint("user_id"), grants, cr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this change request"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// keyAllows checks the API key a service account authenticated with
+func keyAllows(c *gin.Context, perm models.Permission, scope services.Scope) bool {
+	apiKey, ok := c.Get("api_key")
+	if !ok {
+		return false
+	}
+	account, ok := c.Get("service_account")
+	if !ok {
+		return false
+	}
+	return services.KeyAllows(apiKey.(*models.APIKey), account.(*models.ServiceAccount), perm, scope)
+}
+
+// CRScope resolves the change request in the :id parameter
+func CRScope(c *gin.Context) (services.Scope, bool) {
+	cr, ok := loadCR(c)
+	if !ok {
+		return services.Scope{}, false
+	}
+	return services.CRScope(cr), true
+}
+
+// TeamScope resolves the team in the :id parameter
+func TeamScope(c *gin.Context) (services.Scope, bool) {
+	teamID, ok := idParam(c)
+	if !ok {
+		return services.Scope{}, false
+	}
+	return services.TeamScope(teamID), true
+}
+
+// EnvironmentQueryScope resolves the environment in the environment_id query
+// parameter. Without it the request covers CRs without an environment, which
+// only unrestricted bindings grant.
+func EnvironmentQueryScope(c *gin.Context) (services.Scope, bool) {
+	envIDStr := c.Query("environment_id")
+	if envIDStr == "" {
+		return services.Scope{}, true
+	}
+	envID, err := strconv.ParseUint(envIDStr, 10, 64)
+	if err != nil {
+		return services.Scope{}, false
+	}
+	id := uint(envID)
+	return services.Scope{EnvironmentID: &id}, true
+}
+
+func loadCR(c *gin.Context) (*models.ChangeRequest, bool) {
+	crID, ok := idParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
+		return nil, false
+	}
+	return &cr, true
+}
+
+// idParam parses the :id parameter. utils.ParseUint cannot be used here as utils imports middleware.
+func idParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
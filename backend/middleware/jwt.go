@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrSessionRevoked is returned for access tokens of a logged out or expired session
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// JWTKeys signs and verifies access tokens
+type JWTKeys struct {
+	SigningKeyID   string
+	Keys           map[string][]byte // By kid, including the signing key
+	AccessTokenTTL time.Duration
+}
+
+var jwtKeys = &JWTKeys{
+	SigningKeyID:   "default",
+	Keys:           map[string][]byte{"default": []byte("your-secret-key-change-in-production")},
+	AccessTokenTTL: 15 * time.Minute,
+}
+
+// InitJWT loads the token keys from config
+func InitJWT(cfg config.JWTConfig) {
+	keys := &JWTKeys{
+		SigningKeyID:   cfg.KeyID,
+		Keys:           map[string][]byte{},
+		AccessTokenTTL: cfg.AccessTokenTTL,
+	}
+	for kid, secret := range cfg.VerificationKeys {
+		keys.Keys[kid] = []byte(secret)
+	}
+	keys.Keys[cfg.KeyID] = []byte(cfg.SecretKey)
+	if cfg.SecretKey == "your-secret-key-change-in-production" {
+		log.Println("Warning: JWT_SECRET is not set, tokens are signed with the default key")
+	}
+	jwtKeys = keys
+}
+
+// GetJWTKeys returns the token keys
+func GetJWTKeys() *JWTKeys {
+	return jwtKeys
+}
+
+// Sign signs claims with the signing key, naming it in the kid header
+func (k *JWTKeys) Sign(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = k.SigningKeyID
+	return token.SignedString(k.Keys[k.SigningKeyID])
+}
+
+// Parse verifies a token with the key named by its kid header and checks
+// that its session is still active
+func (k *JWTKeys) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if !sessionActive(claims.SessionID) {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
+// sessionActive reports whether a session still has a usable refresh token.
+// Logging out revokes them, which also ends the session's access tokens.
+func sessionActive(sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	var count int64
+	database.DB.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		Count(&count)
+	return count > 0
+}
@@ -10,12 +10,13 @@ type User struct {
 	UserID   uint   `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"user_id"`
 	Username string `gorm:"type:varchar(50);uniqueIndex;not null" json:"username"`
 	Email    string `gorm:"type:varchar(100);uniqueIndex;not null" json:"email"`
-	Password string `gorm:"type:varchar(255);not null" json:"-"` // Hashed password, not returned in JSON
+	Password string `gorm:"type:varchar(255);not null" json:"-"` // Hashed password, not returned in JSON; empty for users of an identity provider
 
 	// Relationships
 	TeamMemberships []UserTeamMembership `gorm:"foreignKey:UserID" json:"team_memberships,omitempty"`
-	IsSuperManager  bool                 `gorm:"-" json:"is_super_manager,omitempty"`
-	IsGatewayEditor bool                 `gorm:"-" json:"is_gateway_editor,omitempty"`
+	RoleBindings    []RoleBinding        `gorm:"foreignKey:UserID" json:"role_bindings,omitempty"`
+	IsSuperManager  bool                 `gorm:"-" json:"is_super_manager,omitempty"`  // Holds cr.approve in some scope
+	IsGatewayEditor bool                 `gorm:"-" json:"is_gateway_editor,omitempty"` // Holds cr.execute in some scope
 }
 
 func (User) TableName() string {
@@ -42,40 +43,179 @@ type UserTeamMembership struct {
 	UserID uint `gorm:"type:bigint unsigned;primaryKey" json:"user_id"`
 	TeamID uint `gorm:"type:bigint unsigned;primaryKey" json:"team_id"`
 
-	User User `gorm:"foreignKey:UserID" json:"user,omitempty" references:UserID`
-	Team Team `gorm:"foreignKey:TeamID" json:"team,omitempty" references:TeamID`
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Team Team `gorm:"foreignKey:TeamID" json:"team,omitempty"`
 }
 
 func (UserTeamMembership) TableName() string {
 	return "user_team_membership"
 }
 
-// SuperManager defines users who can approve CRs
+// UserIdentity links a user to their account at an external identity provider
+// Table: user_identities
+type UserIdentity struct {
+	IdentityID  uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"identity_id"`
+	UserID      uint      `gorm:"type:bigint unsigned;not null;index" json:"user_id"`
+	Provider    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_user_identities_subject" json:"provider"` // e.g. "oidc"
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_subject" json:"issuer"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_subject" json:"subject"`
+	LastLoginAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"last_login_at"`
+	CreatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// SuperManager defines users who could approve CRs before role bindings.
+// Rows are moved to bindings of the super_manager role at startup.
 // Table: super_managers
 type SuperManager struct {
 	UserID  uint      `gorm:"type:bigint unsigned;primaryKey" json:"user_id"`
 	AddedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"added_at"`
 
-	User User `gorm:"foreignKey:UserID" json:"user,omitempty" references:UserID`
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
 func (SuperManager) TableName() string {
 	return "super_managers"
 }
 
-// GatewayEditor defines users who can execute CRs
+// GatewayEditor defines users who could execute CRs before role bindings.
+// Rows are moved to bindings of the gateway_editor role at startup.
 // Table: gateway_editors
 type GatewayEditor struct {
 	UserID  uint      `gorm:"type:bigint unsigned;primaryKey" json:"user_id"`
 	AddedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"added_at"`
 
-	User User `gorm:"foreignKey:UserID" json:"user,omitempty" references:UserID`
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
 func (GatewayEditor) TableName() string {
 	return "gateway_editors"
 }
 
+// Environment is a deployment stage (e.g. dev, staging, prod) with its own gateway
+// Table: environments
+type Environment struct {
+	EnvironmentID  uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"environment_id"`
+	Name           string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	KongAdminURL   string    `gorm:"type:varchar(255)" json:"kong_admin_url"` // Empty uses KONG_ADMIN_URL
+	KongAdminToken string    `gorm:"type:varchar(255)" json:"-"`
+	PromotionOrder int       `gorm:"type:int;not null;default:0" json:"promotion_order"` // CRs are promoted to the next higher order
+	AutoApprove    bool      `gorm:"not null;default:false" json:"auto_approve"`          // CRs targeting it skip Super Manager review
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (Environment) TableName() string {
+	return "environments"
+}
+
+// CRType is a kind of change request (e.g. kong-service, consumer onboarding)
+// with a versioned form definition and JSON Schema
+// Table: cr_types
+type CRType struct {
+	CRTypeID      uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"cr_type_id"`
+	Name          string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"` // Referenced by change_requests.type
+	DisplayName   string    `gorm:"type:varchar(100);not null" json:"display_name"`
+	Description   string    `gorm:"type:text" json:"description,omitempty"`
+	LatestVersion int       `gorm:"type:int;not null;default:1" json:"latest_version"`
+	Builtin       bool      `gorm:"not null;default:false" json:"builtin"` // Applied by the Kong executor, cannot be deleted
+	CreatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// Relationships
+	Versions []CRTypeVersion `gorm:"foreignKey:CRTypeID" json:"versions,omitempty"`
+}
+
+func (CRType) TableName() string {
+	return "cr_types"
+}
+
+// CRTypeVersion is an immutable form definition and schema of a CR type.
+// Change requests keep the version they were authored with.
+// Table: cr_type_versions
+type CRTypeVersion struct {
+	VersionID       uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"version_id"`
+	CRTypeID        uint      `gorm:"type:bigint unsigned;not null;uniqueIndex:idx_cr_type_version" json:"cr_type_id"`
+	Version         int       `gorm:"type:int;not null;uniqueIndex:idx_cr_type_version" json:"version"`
+	FormDefinition  string    `gorm:"type:json;not null" json:"form_definition"` // Same layout as the frontend apiProps.json
+	Schema          string    `gorm:"type:json;not null" json:"schema"`          // JSON Schema of config_changes_payload
+	CreatedByUserID uint      `gorm:"type:bigint unsigned;not null" json:"created_by_user_id"` // 0 for built-in versions
+	CreatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (CRTypeVersion) TableName() string {
+	return "cr_type_versions"
+}
+
+// ApprovalPolicy defines when the reviews of a CR approve or reject it.
+// The most specific policy matching the CR's environment and type applies.
+// Table: approval_policies
+type ApprovalPolicy struct {
+	PolicyID                      uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"policy_id"`
+	Name                          string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	EnvironmentID                 *uint     `gorm:"type:bigint unsigned;index" json:"environment_id,omitempty"` // Nil matches every environment
+	CRType                        string    `gorm:"type:varchar(50)" json:"cr_type,omitempty"`                 // Empty matches every type
+	RequiredApprovals             int       `gorm:"type:int;not null;default:1" json:"required_approvals"`
+	RequiredRejections            int       `gorm:"type:int;not null;default:1" json:"required_rejections"` // 1 means any rejection blocks
+	ApproversOutsideRequesterTeam bool      `gorm:"not null;default:false" json:"approvers_outside_requester_team"` // Approvals from requester team members do not count
+	CreatedAt                     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (ApprovalPolicy) TableName() string {
+	return "approval_policies"
+}
+
+// ChangeWindow is a weekly period in which approved CRs may be executed.
+// When no window matches a CR's environment, execution is allowed at any time.
+// Table: change_windows
+type ChangeWindow struct {
+	WindowID      uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"window_id"`
+	Name          string    `gorm:"type:varchar(100);not null" json:"name"`
+	EnvironmentID *uint     `gorm:"type:bigint unsigned;index" json:"environment_id,omitempty"` // Nil matches every environment
+	Weekday       int       `gorm:"type:tinyint;not null" json:"weekday"`                       // 0 = Sunday
+	StartTime     string    `gorm:"type:char(5);not null" json:"start_time"`                    // HH:MM, inclusive
+	EndTime       string    `gorm:"type:char(5);not null" json:"end_time"`                      // HH:MM, exclusive
+	Timezone      string    `gorm:"type:varchar(64);not null;default:'UTC'" json:"timezone"`    // IANA name
+	CreatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (ChangeWindow) TableName() string {
+	return "change_windows"
+}
+
+// FreezePeriod blocks all execution, automated or manual, while it is active
+// Table: freeze_periods
+type FreezePeriod struct {
+	FreezeID        uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"freeze_id"`
+	Name            string    `gorm:"type:varchar(100);not null" json:"name"`
+	EnvironmentID   *uint     `gorm:"type:bigint unsigned;index" json:"environment_id,omitempty"` // Nil freezes every environment
+	StartsAt        time.Time `gorm:"type:timestamp;not null;index" json:"starts_at"`
+	EndsAt          time.Time `gorm:"type:timestamp;not null;index" json:"ends_at"`
+	Reason          string    `gorm:"type:text" json:"reason,omitempty"`
+	CreatedByUserID uint      `gorm:"type:bigint unsigned;not null" json:"created_by_user_id"`
+	CreatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (FreezePeriod) TableName() string {
+	return "freeze_periods"
+}
+
+// ApprovalOutcome is the result of evaluating an approval policy over the reviews of a CR.
+// It is computed on read and not stored.
+type ApprovalOutcome struct {
+	PolicyID                      *uint          `json:"policy_id,omitempty"` // Nil for the default policy
+	PolicyName                    string         `json:"policy_name"`
+	RequiredApprovals             int            `json:"required_approvals"`
+	RequiredRejections            int            `json:"required_rejections"`
+	ApproversOutsideRequesterTeam bool           `json:"approvers_outside_requester_team"`
+	Approvals                     int            `json:"approvals"`          // Approvals counting towards the policy
+	IgnoredApprovals              int            `json:"ignored_approvals"`  // Approvals from requester team members
+	OutdatedReviews               int            `json:"outdated_reviews"`   // Reviews of an earlier payload of the revision
+	Rejections                    int            `json:"rejections"`
+	Decision                      ApprovalStatus `json:"decision"` // PENDING_APPROVAL until the policy is satisfied
+}
+
 // ApprovalStatus enum
 // Values: 'PENDING_APPROVAL','APPROVED','REJECTED','NEEDS_REWORK'
 type ApprovalStatus string
@@ -88,7 +228,7 @@ const (
 )
 
 // ExecutionStatus enum
-// Values: 'DRAFT','IN_PROGRESS','COMPLETED','CANCELED'
+// Values: 'DRAFT','IN_PROGRESS','COMPLETED','CANCELED','FAILED'
 type ExecutionStatus string
 
 const (
@@ -96,6 +236,7 @@ const (
 	ExecutionStatusInProgress ExecutionStatus = "IN_PROGRESS"
 	ExecutionStatusCompleted  ExecutionStatus = "COMPLETED"
 	ExecutionStatusCanceled   ExecutionStatus = "CANCELED"
+	ExecutionStatusFailed     ExecutionStatus = "FAILED"
 )
 
 // ChangeRequest represents a configuration change request
@@ -108,11 +249,24 @@ type ChangeRequest struct {
 	ConfigChangesPayload string         `gorm:"type:json;not null" json:"config_changes_payload"`
 	CreatedAt           time.Time       `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
 	ApprovalStatus      ApprovalStatus  `gorm:"type:enum('PENDING_APPROVAL','APPROVED','REJECTED','NEEDS_REWORK');not null" json:"approval_status"`
-	ExecutionStatus     ExecutionStatus `gorm:"type:enum('DRAFT','IN_PROGRESS','COMPLETED','CANCELED');not null" json:"execution_status"`
+	ExecutionStatus     ExecutionStatus `gorm:"type:enum('DRAFT','IN_PROGRESS','COMPLETED','CANCELED','FAILED');not null" json:"execution_status"`
+	PreChangeSnapshot   *string         `gorm:"type:json" json:"pre_change_snapshot,omitempty"`              // Gateway state before execution, set by the executor
+	RollbackOfCRID      *uint           `gorm:"type:bigint unsigned;index" json:"rollback_of_cr_id,omitempty"` // Set on rollback CRs
+	CompletedAt         *time.Time      `gorm:"type:timestamp NULL" json:"completed_at,omitempty"`           // When execution reached COMPLETED
+	EnvironmentID       *uint           `gorm:"type:bigint unsigned;index" json:"environment_id,omitempty"`    // Target environment, nil for the default gateway
+	ParentCRID          *uint           `gorm:"type:bigint unsigned;index" json:"parent_cr_id,omitempty"`      // CR this one was promoted from
+	Type                string          `gorm:"type:varchar(50);not null;default:'kong-service';index" json:"type"` // cr_types.name
+	SchemaVersion       int             `gorm:"type:int;not null;default:1" json:"schema_version"`                  // Version of the type the payload was authored with
+	Revision            int             `gorm:"type:int;not null;default:1" json:"revision"`                        // Bumped on every resubmission after NEEDS_REWORK
+	ScheduledFor        *time.Time      `gorm:"type:timestamp NULL;index" json:"scheduled_for,omitempty"`             // Not executed before this time once approved
+	Version             int             `gorm:"type:int;not null;default:1" json:"version"`                         // Bumped on every write; sent as the ETag
+	ApprovedPayloadHash string          `gorm:"type:char(64);not null;default:''" json:"approved_payload_hash,omitempty"` // SHA-256 of the canonical payload when it was approved
 
 	// Relationships
-	RequesterUser User `gorm:"foreignKey:RequesterUserID" json:"requester_user,omitempty" references:RequesterUserID`
-	RequesterTeam Team `gorm:"foreignKey:RequesterTeamID" json:"requester_team,omitempty" references:RequesterTeamID`
+	RequesterUser User `gorm:"foreignKey:RequesterUserID" json:"requester_user,omitempty"`
+	RequesterTeam Team `gorm:"foreignKey:RequesterTeamID" json:"requester_team,omitempty"`
+	Environment   *Environment         `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
+	ApprovalOutcome *ApprovalOutcome   `gorm:"-" json:"approval_outcome,omitempty"` // Set when a single CR is fetched
 	Reviews       []SuperManagerReview `gorm:"foreignKey:CRID" json:"reviews,omitempty"`
 	Comments      []Comment            `gorm:"foreignKey:CRID" json:"comments,omitempty"`
 	History       []History            `gorm:"foreignKey:CRID" json:"history,omitempty"`
@@ -123,12 +277,13 @@ func (ChangeRequest) TableName() string {
 }
 
 // ReviewDecision enum
-// Values: 'APPROVED','REJECTED'
+// Values: 'APPROVED','REJECTED','CHANGES_REQUESTED'
 type ReviewDecision string
 
 const (
-	ReviewDecisionApproved ReviewDecision = "APPROVED"
-	ReviewDecisionRejected ReviewDecision = "REJECTED"
+	ReviewDecisionApproved         ReviewDecision = "APPROVED"
+	ReviewDecisionRejected         ReviewDecision = "REJECTED"
+	ReviewDecisionChangesRequested ReviewDecision = "CHANGES_REQUESTED"
 )
 
 // SuperManagerReview represents a review decision by a super manager
@@ -137,18 +292,41 @@ type SuperManagerReview struct {
 	ReviewID       uint           `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"review_id"`
 	CRID           uint           `gorm:"type:bigint unsigned;not null;index" json:"cr_id"`
 	SMUserID       uint           `gorm:"type:bigint unsigned;not null;index" json:"sm_user_id"`
-	ReviewDecision ReviewDecision `gorm:"type:enum('APPROVED','REJECTED');not null" json:"review_decision"`
+	ReviewDecision ReviewDecision `gorm:"type:enum('APPROVED','REJECTED','CHANGES_REQUESTED');not null" json:"review_decision"`
+	Reason         *string        `gorm:"type:text" json:"reason,omitempty"`                 // Required for CHANGES_REQUESTED
+	Revision       int            `gorm:"type:int;not null;default:1" json:"revision"` // CR revision the review applies to
+	PayloadHash    string         `gorm:"type:char(64);not null;default:''" json:"payload_hash"` // SHA-256 of the canonical payload the review applies to
 	ReviewedAt     time.Time     `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"reviewed_at"`
 
 	// Relationships
-	ChangeRequest ChangeRequest `gorm:"foreignKey:CRID" json:"change_request,omitempty" references:CRID	`
-	SuperManager  User          `gorm:"foreignKey:SMUserID" json:"super_manager,omitempty" references:SMUserID`
+	ChangeRequest ChangeRequest `gorm:"foreignKey:CRID" json:"change_request,omitempty"`
+	SuperManager  User          `gorm:"foreignKey:SMUserID" json:"super_manager,omitempty"`
 }
 
 func (SuperManagerReview) TableName() string {
 	return "cr_super_manager_review"
 }
 
+// PayloadRevision is one version of a CR's payload. The first is stored when the
+// CR is created, the next on every update that changes the payload.
+// Table: cr_payload_revisions
+type PayloadRevision struct {
+	PayloadRevisionID    uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"payload_revision_id"`
+	CRID                 uint      `gorm:"type:bigint unsigned;not null;uniqueIndex:idx_payload_revision_number" json:"cr_id"`
+	Number               int       `gorm:"type:int;not null;uniqueIndex:idx_payload_revision_number" json:"number"` // 1, 2, ... per CR
+	Revision             int       `gorm:"type:int;not null;default:1" json:"revision"`                             // CR revision (review round) it is reviewed in
+	ConfigChangesPayload string    `gorm:"type:json;not null" json:"config_changes_payload"`
+	CreatedByUserID      uint      `gorm:"type:bigint unsigned;not null" json:"created_by_user_id"`
+	CreatedAt            time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// Relationships
+	CreatedBy User `gorm:"foreignKey:CreatedByUserID" json:"created_by,omitempty"`
+}
+
+func (PayloadRevision) TableName() string {
+	return "cr_payload_revisions"
+}
+
 // Comment represents a comment on a change request
 // Table: cr_comments
 type Comment struct {
@@ -159,8 +337,8 @@ type Comment struct {
 	CreatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
 
 	// Relationships
-	ChangeRequest ChangeRequest `gorm:"foreignKey:CRID" json:"change_request,omitempty" references:CRID`
-	User          User          `gorm:"foreignKey:UserID" json:"user,omitempty" references:UserID`
+	ChangeRequest ChangeRequest `gorm:"foreignKey:CRID" json:"change_request,omitempty"`
+	User          User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
 func (Comment) TableName() string {
@@ -170,20 +348,400 @@ func (Comment) TableName() string {
 // History represents an audit trail entry
 // Table: cr_history
 type History struct {
-	HistoryID       uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"history_id"`
-	CRID            uint      `gorm:"type:bigint unsigned;not null;index" json:"cr_id"`
-	ChangedByUserID uint      `gorm:"type:bigint unsigned;not null;index" json:"changed_by_user_id"`
-	EventType       string    `gorm:"type:varchar(50);not null" json:"event_type"`
-	OldStatus       *string   `gorm:"type:varchar(50)" json:"old_status,omitempty"` // Nullable
-	NewStatus       string    `gorm:"type:varchar(50);not null" json:"new_status"`
-	Timestamp       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"timestamp"`
+	HistoryID                 uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"history_id"`
+	CRID                      uint      `gorm:"type:bigint unsigned;not null;index" json:"cr_id"`
+	ChangedByUserID           uint      `gorm:"type:bigint unsigned;not null;index" json:"changed_by_user_id"` // 0 for automation and service accounts
+	ChangedByServiceAccountID *uint     `gorm:"type:bigint unsigned;index" json:"changed_by_service_account_id,omitempty"`
+	EventType                 string    `gorm:"type:varchar(50);not null" json:"event_type"`
+	OldStatus                 *string   `gorm:"type:varchar(50)" json:"old_status,omitempty"` // Nullable
+	NewStatus                 string    `gorm:"type:varchar(50);not null" json:"new_status"`
+	Details                   *string   `gorm:"type:text" json:"details,omitempty"` // e.g. gateway error of a failed execution
+	IPAddress                 string    `gorm:"type:varchar(45)" json:"ip_address,omitempty"` // Client of the request; empty for automation
+	UserAgent                 string    `gorm:"type:varchar(255)" json:"user_agent,omitempty"`
+	Timestamp                 time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"timestamp"`
+	PrevHash                  string    `gorm:"type:char(64);not null;default:''" json:"prev_hash"`        // Hash of the previous entry of the CR
+	PrevGlobalHash            string    `gorm:"type:char(64);not null;default:''" json:"prev_global_hash"` // Hash of the previous entry of any CR
+	Hash                      string    `gorm:"type:char(64);not null;default:''" json:"hash"`             // SHA-256 of the content and both previous hashes
 
 	// Relationships
-	ChangeRequest ChangeRequest `gorm:"foreignKey:CRID" json:"change_request,omitempty" references:CRID`
-	ChangedBy     User          `gorm:"foreignKey:ChangedByUserID" json:"changed_by,omitempty" references:UserID`
+	ChangeRequest           ChangeRequest   `gorm:"foreignKey:CRID" json:"change_request,omitempty"`
+	ChangedBy               User            `gorm:"foreignKey:ChangedByUserID" json:"changed_by,omitempty"`
+	ChangedByServiceAccount *ServiceAccount `gorm:"foreignKey:ChangedByServiceAccountID" json:"changed_by_service_account,omitempty"`
 }
 
 func (History) TableName() string {
 	return "cr_history"
 }
 
+// HistoryChainHead is the end of the hash chain over all history entries.
+// Writers lock it to append one entry at a time; verification compares it
+// with the last entry to detect removed entries.
+// Table: cr_history_chain
+type HistoryChainHead struct {
+	ChainID       uint      `gorm:"type:bigint unsigned;primaryKey" json:"chain_id"` // Always 1
+	LastHistoryID uint      `gorm:"type:bigint unsigned;not null" json:"last_history_id"`
+	LastHash      string    `gorm:"type:char(64);not null;default:''" json:"last_hash"`
+	UpdatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (HistoryChainHead) TableName() string {
+	return "cr_history_chain"
+}
+
+
+// DriftType enum
+// Values: 'MISSING','MODIFIED','UNEXPECTED','UNMANAGED'
+type DriftType string
+
+const (
+	DriftTypeMissing    DriftType = "MISSING"    // Approved entity is absent from the gateway
+	DriftTypeModified   DriftType = "MODIFIED"   // Entity differs from the approved state
+	DriftTypeUnexpected DriftType = "UNEXPECTED" // Entity of a managed service that no CR created
+	DriftTypeUnmanaged  DriftType = "UNMANAGED"  // Service that no completed CR manages
+)
+
+// DriftFinding is a difference between the state built from completed CRs and the live gateway
+// Table: drift_findings
+type DriftFinding struct {
+	FindingID     uint       `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"finding_id"`
+	ServiceName   string     `gorm:"type:varchar(255);not null;index" json:"service_name"`
+	ResourceType  string     `gorm:"type:varchar(20);not null" json:"resource_type"`
+	ResourceName  string     `gorm:"type:varchar(255);not null" json:"resource_name"`
+	EnvironmentID *uint      `gorm:"type:bigint unsigned;index" json:"environment_id,omitempty"`
+	DriftType     DriftType  `gorm:"type:enum('MISSING','MODIFIED','UNEXPECTED','UNMANAGED');not null" json:"drift_type"`
+	ChangedFields string     `gorm:"type:varchar(255)" json:"changed_fields,omitempty"` // Comma-separated
+	Expected      *string    `gorm:"type:json" json:"expected,omitempty"`
+	Actual        *string    `gorm:"type:json" json:"actual,omitempty"`
+	SourceCRID    *uint      `gorm:"type:bigint unsigned" json:"source_cr_id,omitempty"` // Last completed CR for the service
+	DetectedAt    time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"detected_at"`
+	LastSeenAt    time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"last_seen_at"`
+	ResolvedAt    *time.Time `gorm:"type:timestamp NULL;index" json:"resolved_at,omitempty"`
+}
+
+func (DriftFinding) TableName() string {
+	return "drift_findings"
+}
+
+// JobStatus enum
+// Values: 'PENDING','RUNNING','SUCCEEDED','DEAD'
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "PENDING" // Waiting for its first attempt or a retry
+	JobStatusRunning   JobStatus = "RUNNING" // Claimed by a worker
+	JobStatusSucceeded JobStatus = "SUCCEEDED"
+	JobStatusDead      JobStatus = "DEAD" // Out of attempts, waits for a manual retry
+)
+
+// Job is a unit of background automation work (applying a CR, sending a webhook)
+// Table: jobs
+type Job struct {
+	JobID       uint       `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"job_id"`
+	Kind        string     `gorm:"type:varchar(50);not null;index" json:"kind"`
+	CRID        *uint      `gorm:"type:bigint unsigned;index" json:"cr_id,omitempty"` // CR the job works on, if any
+	Payload     *string    `gorm:"type:json" json:"payload,omitempty"`
+	Status      JobStatus  `gorm:"type:enum('PENDING','RUNNING','SUCCEEDED','DEAD');not null;default:'PENDING';index:idx_jobs_status_run_at" json:"status"`
+	RunAt       time.Time  `gorm:"type:timestamp;not null;index:idx_jobs_status_run_at" json:"run_at"` // Next attempt not before
+	Attempts    int        `gorm:"type:int;not null;default:0" json:"attempts"`
+	LastError   *string    `gorm:"type:text" json:"last_error,omitempty"`
+	LockedBy    string     `gorm:"type:varchar(100)" json:"locked_by,omitempty"` // Worker running the job
+	LockedAt    *time.Time `gorm:"type:timestamp NULL" json:"locked_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+	CompletedAt *time.Time `gorm:"type:timestamp NULL" json:"completed_at,omitempty"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// WebhookEvent is an event webhook subscriptions can filter on
+type WebhookEvent string
+
+const (
+	WebhookEventCRCreated        WebhookEvent = "CR_CREATED"
+	WebhookEventReviewed         WebhookEvent = "REVIEWED" // Every Super Manager review
+	WebhookEventChangesRequested WebhookEvent = "CHANGES_REQUESTED"
+	WebhookEventApproved         WebhookEvent = "APPROVED"
+	WebhookEventRejected         WebhookEvent = "REJECTED"
+	WebhookEventExecutionStarted WebhookEvent = "EXECUTION_STARTED"
+	WebhookEventCompleted        WebhookEvent = "COMPLETED"
+	WebhookEventFailed           WebhookEvent = "FAILED"
+	WebhookEventCanceled         WebhookEvent = "CANCELED"
+	WebhookEventCommentAdded     WebhookEvent = "COMMENT_ADDED"
+	WebhookEventDriftDetected    WebhookEvent = "DRIFT_DETECTED"
+)
+
+// WebhookEvents lists every event a subscription may filter on
+var WebhookEvents = []WebhookEvent{
+	WebhookEventCRCreated,
+	WebhookEventReviewed,
+	WebhookEventChangesRequested,
+	WebhookEventApproved,
+	WebhookEventRejected,
+	WebhookEventExecutionStarted,
+	WebhookEventCompleted,
+	WebhookEventFailed,
+	WebhookEventCanceled,
+	WebhookEventCommentAdded,
+	WebhookEventDriftDetected,
+}
+
+// WebhookSubscription posts matching events to a URL, signed with its secret
+// Table: webhook_subscriptions
+type WebhookSubscription struct {
+	SubscriptionID  uint           `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"subscription_id"`
+	Name            string         `gorm:"type:varchar(100);not null" json:"name"`
+	URL             string         `gorm:"type:varchar(500);not null" json:"url"`
+	Secret          string         `gorm:"type:varchar(255)" json:"-"`            // HMAC-SHA256 key; empty sends unsigned requests
+	Events          []WebhookEvent `gorm:"type:json;serializer:json" json:"events"` // Empty matches every event
+	TeamID          *uint          `gorm:"type:bigint unsigned;index" json:"team_id,omitempty"` // Only CRs of this requester team
+	Active          bool           `gorm:"not null" json:"active"`
+	CreatedByUserID uint           `gorm:"type:bigint unsigned;not null" json:"created_by_user_id"`
+	CreatedAt       time.Time      `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	HasSecret bool `gorm:"-" json:"has_secret"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// DeliveryStatus enum
+// Values: 'PENDING','DELIVERED','FAILED'
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "PENDING"
+	DeliveryStatusDelivered DeliveryStatus = "DELIVERED"
+	DeliveryStatusFailed    DeliveryStatus = "FAILED" // Last attempt failed; the job may still retry
+)
+
+// WebhookDelivery is one event sent to one subscription, with the outcome of its last attempt
+// Table: webhook_deliveries
+type WebhookDelivery struct {
+	DeliveryID     uint           `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"delivery_id"`
+	SubscriptionID uint           `gorm:"type:bigint unsigned;not null;index" json:"subscription_id"`
+	Event          WebhookEvent   `gorm:"type:varchar(50);not null" json:"event"`
+	CRID           *uint          `gorm:"type:bigint unsigned;index" json:"cr_id,omitempty"`
+	Payload        string         `gorm:"type:json;not null" json:"payload"`
+	Status         DeliveryStatus `gorm:"type:enum('PENDING','DELIVERED','FAILED');not null;default:'PENDING'" json:"status"`
+	Attempts       int            `gorm:"type:int;not null;default:0" json:"attempts"`
+	ResponseCode   *int           `gorm:"type:int" json:"response_code,omitempty"`
+	ResponseBody   *string        `gorm:"type:text" json:"response_body,omitempty"` // Truncated
+	Error          *string        `gorm:"type:text" json:"error,omitempty"`
+	RedeliveryOf   *uint          `gorm:"type:bigint unsigned" json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time      `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+	DeliveredAt    *time.Time     `gorm:"type:timestamp NULL" json:"delivered_at,omitempty"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// API key scopes
+const (
+	ScopeCRRead    = "cr:read"    // Read CR status for CI/CD
+	ScopeCRExecute = "cr:execute" // Trigger CR execution and report its result
+)
+
+// APIKeyScopes lists the scopes keys can be granted
+var APIKeyScopes = []string{ScopeCRRead, ScopeCRExecute}
+
+// ServiceAccount is a non-human identity, e.g. a CI/CD pipeline, that calls the automation endpoints with API keys
+// Table: service_accounts
+type ServiceAccount struct {
+	ServiceAccountID uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"service_account_id"`
+	Name             string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description      *string   `gorm:"type:text" json:"description,omitempty"`
+	Active           bool      `gorm:"not null" json:"active"`                                     // Keys of inactive accounts are refused
+	TeamID           *uint     `gorm:"type:bigint unsigned;index" json:"team_id,omitempty"`        // Limits the account to CRs of this team; nil for all teams
+	EnvironmentID    *uint     `gorm:"type:bigint unsigned;index" json:"environment_id,omitempty"` // Limits the account to CRs targeting this environment; nil for all
+	CreatedByUserID  uint      `gorm:"type:bigint unsigned;not null" json:"created_by_user_id"`
+	CreatedAt        time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// Relationships
+	APIKeys []APIKey `gorm:"foreignKey:ServiceAccountID" json:"api_keys,omitempty"`
+}
+
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
+
+// APIKey authenticates a service account. Only the SHA-256 hash of the key is stored.
+// Table: api_keys
+type APIKey struct {
+	KeyID            uint       `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"key_id"`
+	ServiceAccountID uint       `gorm:"type:bigint unsigned;not null;index" json:"service_account_id"`
+	Name             string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix           string     `gorm:"type:varchar(20);not null" json:"prefix"` // Start of the key, to recognize it
+	KeyHash          string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	Scopes           []string   `gorm:"type:json;serializer:json" json:"scopes"`
+	ExpiresAt        *time.Time `gorm:"type:timestamp NULL" json:"expires_at,omitempty"` // Nil never expires
+	LastUsedAt       *time.Time `gorm:"type:timestamp NULL" json:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `gorm:"type:timestamp NULL" json:"revoked_at,omitempty"`
+	CreatedByUserID  uint       `gorm:"type:bigint unsigned;not null" json:"created_by_user_id"`
+	CreatedAt        time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// HasScope reports whether the key was granted a scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshToken exchanges for a new access token. Tokens are rotated on every use;
+// the tokens issued from one login share a SessionID. Only the SHA-256 hash is stored.
+// Table: refresh_tokens
+type RefreshToken struct {
+	TokenID           uint       `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"token_id"`
+	UserID            uint       `gorm:"type:bigint unsigned;not null;index" json:"user_id"`
+	SessionID         string     `gorm:"type:varchar(64);not null;index" json:"session_id"`
+	TokenHash         string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt         time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	RevokedAt         *time.Time `gorm:"type:timestamp NULL" json:"revoked_at,omitempty"`
+	ReplacedByTokenID *uint      `gorm:"type:bigint unsigned" json:"replaced_by_token_id,omitempty"` // Set when rotated
+	UserAgent         string     `gorm:"type:varchar(255)" json:"user_agent"`
+	IPAddress         string     `gorm:"type:varchar(45)" json:"ip_address"`
+	CreatedAt         time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// Permission is an action a role binding allows
+type Permission string
+
+const (
+	PermCRRead        Permission = "cr.read"        // Read CRs of teams the user is not a member of
+	PermCRApprove     Permission = "cr.approve"     // Review CRs
+	PermCRExecute     Permission = "cr.execute"     // Execute, roll back and run the automation of CRs
+	PermTeamManage    Permission = "team.manage"    // Create teams and manage the members of teams the user is not in
+	PermConfigManage  Permission = "config.manage"  // Manage environments, CR types, change windows, freezes and drift checks
+	PermWebhookManage Permission = "webhook.manage" // Manage webhook subscriptions
+	PermPolicyManage  Permission = "policy.manage"  // Manage approval policies
+	PermAdminManage   Permission = "admin.manage"   // Manage roles, role bindings, service accounts and directory sync
+)
+
+// Permissions lists the permissions roles can be granted
+var Permissions = []Permission{
+	PermCRRead, PermCRApprove, PermCRExecute, PermTeamManage,
+	PermConfigManage, PermWebhookManage, PermPolicyManage, PermAdminManage,
+}
+
+// Built-in roles, replacing the former super_managers and gateway_editors tables
+const (
+	RoleNameSuperManager  = "super_manager"
+	RoleNameGatewayEditor = "gateway_editor"
+)
+
+// RoleDefinition is a named set of permissions granted to users by role bindings
+// Table: roles
+type RoleDefinition struct {
+	RoleID      uint         `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"role_id"`
+	Name        string       `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description *string      `gorm:"type:text" json:"description,omitempty"`
+	Permissions []Permission `gorm:"type:json;serializer:json" json:"permissions"`
+	BuiltIn     bool         `gorm:"not null" json:"built_in"` // Built-in roles cannot be changed or deleted
+	CreatedAt   time.Time    `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (RoleDefinition) TableName() string {
+	return "roles"
+}
+
+// HasPermission reports whether the role grants a permission
+func (r RoleDefinition) HasPermission(perm Permission) bool {
+	for _, p := range r.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleBinding grants a role to a user. A binding with a team or environment only
+// applies to resources of that team or environment; without either it applies everywhere.
+// Table: role_bindings
+type RoleBinding struct {
+	BindingID       uint      `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"binding_id"`
+	RoleID          uint      `gorm:"type:bigint unsigned;not null;index" json:"role_id"`
+	UserID          uint      `gorm:"type:bigint unsigned;not null;index" json:"user_id"`
+	TeamID          *uint     `gorm:"type:bigint unsigned" json:"team_id,omitempty"`
+	EnvironmentID   *uint     `gorm:"type:bigint unsigned" json:"environment_id,omitempty"`
+	CreatedByUserID *uint     `gorm:"type:bigint unsigned" json:"created_by_user_id,omitempty"` // Nil when granted by migration or directory sync
+	CreatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	Role        RoleDefinition `gorm:"foreignKey:RoleID" json:"role,omitempty"`
+	User        User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Team        *Team          `gorm:"foreignKey:TeamID" json:"team,omitempty"`
+	Environment *Environment   `gorm:"foreignKey:EnvironmentID" json:"environment,omitempty"`
+}
+
+func (RoleBinding) TableName() string {
+	return "role_bindings"
+}
+
+// AuditAction is a kind of audit event
+type AuditAction string
+
+const (
+	AuditLogin              AuditAction = "auth.login" // Password, LDAP or SSO login
+	AuditLoginFailed        AuditAction = "auth.login_failed"
+	AuditRegister           AuditAction = "auth.register"
+	AuditLogout             AuditAction = "auth.logout"
+	AuditLogoutAll          AuditAction = "auth.logout_all"
+	AuditRefreshTokenReused AuditAction = "auth.refresh_token_reused" // A rotated refresh token was presented; its session was revoked
+
+	AuditTeamCreated       AuditAction = "team.created"
+	AuditTeamMemberAdded   AuditAction = "team.member_added"
+	AuditTeamMemberRemoved AuditAction = "team.member_removed"
+
+	AuditRoleCreated AuditAction = "role.created"
+	AuditRoleUpdated AuditAction = "role.updated"
+	AuditRoleDeleted AuditAction = "role.deleted"
+	AuditRoleGranted AuditAction = "role.granted" // A role binding was created
+	AuditRoleRevoked AuditAction = "role.revoked" // A role binding was deleted
+
+	AuditServiceAccountCreated AuditAction = "service_account.created"
+	AuditServiceAccountUpdated AuditAction = "service_account.updated"
+	AuditServiceAccountDeleted AuditAction = "service_account.deleted"
+	AuditAPIKeyIssued          AuditAction = "api_key.issued"
+	AuditAPIKeyRevoked         AuditAction = "api_key.revoked"
+
+	AuditLDAPSync AuditAction = "ldap.sync" // A manual directory sync
+
+	// Environments, CR types, approval policies, change windows, freeze periods and webhooks
+	AuditConfigCreated AuditAction = "config.created"
+	AuditConfigUpdated AuditAction = "config.updated"
+	AuditConfigDeleted AuditAction = "config.deleted"
+)
+
+// AuditEvent records a mutating admin, team or authentication action, or a
+// failed login. Change request events are recorded in cr_history instead.
+// Table: audit_events
+type AuditEvent struct {
+	EventID               uint                   `gorm:"type:bigint unsigned;primaryKey;autoIncrement" json:"event_id"`
+	Action                AuditAction            `gorm:"type:varchar(50);not null;index" json:"action"`
+	ActorUserID           *uint                  `gorm:"type:bigint unsigned;index" json:"actor_user_id,omitempty"` // Nil for failed logins and directory sync
+	ActorServiceAccountID *uint                  `gorm:"type:bigint unsigned" json:"actor_service_account_id,omitempty"`
+	ActorName             string                 `gorm:"type:varchar(100);not null;default:''" json:"actor_name"`                        // Username at the time, or the one tried by a failed login
+	TargetType            string                 `gorm:"type:varchar(50);not null;default:'';index:idx_audit_target" json:"target_type"` // e.g. "team", "user", "environment"
+	TargetID              string                 `gorm:"type:varchar(100);not null;default:'';index:idx_audit_target" json:"target_id"`  // ID, or name for CR types
+	Details               map[string]interface{} `gorm:"type:json;serializer:json" json:"details,omitempty"`
+	IPAddress             string                 `gorm:"type:varchar(45)" json:"ip_address,omitempty"`
+	UserAgent             string                 `gorm:"type:varchar(255)" json:"user_agent,omitempty"`
+	CreatedAt             time.Time              `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
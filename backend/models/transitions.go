@@ -0,0 +1,197 @@
+package models
+
+// Role is a capacity in which an actor may act on a change request
+type Role string
+
+const (
+	RoleRequester     Role = "REQUESTER" // The user who created the CR
+	RoleSuperManager  Role = "SUPER_MANAGER"
+	RoleGatewayEditor Role = "GATEWAY_EDITOR"
+	RoleSystem        Role = "SYSTEM" // Automation and approval policy decisions
+)
+
+// TransitionAction names a transition of the CR state machine
+type TransitionAction string
+
+const (
+	ActionUpdate         TransitionAction = "update"          // Edit title/payload before approval
+	ActionReview         TransitionAction = "review"          // Vote without deciding the CR
+	ActionRequestChanges TransitionAction = "request_changes" // Send the CR back to the requester
+	ActionResubmit       TransitionAction = "resubmit"
+	ActionApprove        TransitionAction = "approve"      // Approval policy satisfied
+	ActionReject         TransitionAction = "reject"       // Approval policy rejected
+	ActionAutoApprove    TransitionAction = "auto_approve" // Environment or rollback skips review
+	ActionStart          TransitionAction = "start"
+	ActionComplete       TransitionAction = "complete"
+	ActionFail           TransitionAction = "fail"
+	ActionRetry          TransitionAction = "retry"
+	ActionCancel         TransitionAction = "cancel"
+)
+
+// Transition is an allowed move between (ApprovalStatus, ExecutionStatus) states.
+// Empty To* fields leave that status unchanged.
+type Transition struct {
+	Action        TransitionAction  `json:"action"`
+	FromApproval  []ApprovalStatus  `json:"-"`
+	FromExecution []ExecutionStatus `json:"-"`
+	ToApproval    ApprovalStatus    `json:"to_approval_status,omitempty"`
+	ToExecution   ExecutionStatus   `json:"to_execution_status,omitempty"`
+	Roles         []Role            `json:"roles"`
+	EventType     string            `json:"-"` // cr_history.event_type written when applied
+	WebhookEvent  WebhookEvent      `json:"-"` // Published to webhook subscriptions when applied, if set
+}
+
+// Transitions declares the CR state machine. Approval decides whether a CR may
+// run; execution only moves once the CR is APPROVED.
+var Transitions = []Transition{
+	{
+		Action:        ActionUpdate,
+		FromApproval:  []ApprovalStatus{ApprovalStatusPending, ApprovalStatusNeedsRework},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		Roles:         []Role{RoleRequester},
+		EventType:     "UPDATED",
+	},
+	{
+		Action:        ActionReview,
+		FromApproval:  []ApprovalStatus{ApprovalStatusPending},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		Roles:         []Role{RoleSuperManager},
+		EventType:     "REVIEW_ADDED",
+	},
+	{
+		Action:        ActionRequestChanges,
+		FromApproval:  []ApprovalStatus{ApprovalStatusPending},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		ToApproval:    ApprovalStatusNeedsRework,
+		Roles:         []Role{RoleSuperManager},
+		EventType:     "CHANGES_REQUESTED",
+		WebhookEvent:  WebhookEventChangesRequested,
+	},
+	{
+		Action:        ActionResubmit,
+		FromApproval:  []ApprovalStatus{ApprovalStatusNeedsRework},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		ToApproval:    ApprovalStatusPending,
+		Roles:         []Role{RoleRequester},
+		EventType:     "RESUBMITTED",
+	},
+	{
+		Action:        ActionApprove,
+		FromApproval:  []ApprovalStatus{ApprovalStatusPending},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		ToApproval:    ApprovalStatusApproved,
+		Roles:         []Role{RoleSystem},
+		EventType:     "STATUS_CHANGE",
+		WebhookEvent:  WebhookEventApproved,
+	},
+	{
+		Action:        ActionReject,
+		FromApproval:  []ApprovalStatus{ApprovalStatusPending},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		ToApproval:    ApprovalStatusRejected,
+		Roles:         []Role{RoleSystem},
+		EventType:     "STATUS_CHANGE",
+		WebhookEvent:  WebhookEventRejected,
+	},
+	{
+		Action:        ActionAutoApprove,
+		FromApproval:  []ApprovalStatus{ApprovalStatusPending},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		ToApproval:    ApprovalStatusApproved,
+		Roles:         []Role{RoleSystem},
+		EventType:     "AUTO_APPROVED",
+		WebhookEvent:  WebhookEventApproved,
+	},
+	{
+		Action:        ActionStart,
+		FromApproval:  []ApprovalStatus{ApprovalStatusApproved},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft},
+		ToExecution:   ExecutionStatusInProgress,
+		Roles:         []Role{RoleGatewayEditor, RoleSystem},
+		EventType:     "STATUS_CHANGE",
+		WebhookEvent:  WebhookEventExecutionStarted,
+	},
+	{
+		Action:        ActionComplete,
+		FromApproval:  []ApprovalStatus{ApprovalStatusApproved},
+		FromExecution: []ExecutionStatus{ExecutionStatusInProgress},
+		ToExecution:   ExecutionStatusCompleted,
+		Roles:         []Role{RoleGatewayEditor, RoleSystem},
+		EventType:     "STATUS_CHANGE",
+		WebhookEvent:  WebhookEventCompleted,
+	},
+	{
+		Action:        ActionFail,
+		FromApproval:  []ApprovalStatus{ApprovalStatusApproved},
+		FromExecution: []ExecutionStatus{ExecutionStatusInProgress},
+		ToExecution:   ExecutionStatusFailed,
+		Roles:         []Role{RoleGatewayEditor, RoleSystem},
+		EventType:     "EXECUTION_FAILED",
+		WebhookEvent:  WebhookEventFailed,
+	},
+	{
+		Action:        ActionRetry,
+		FromApproval:  []ApprovalStatus{ApprovalStatusApproved},
+		FromExecution: []ExecutionStatus{ExecutionStatusFailed},
+		ToExecution:   ExecutionStatusInProgress,
+		Roles:         []Role{RoleGatewayEditor, RoleSystem},
+		EventType:     "STATUS_CHANGE",
+		WebhookEvent:  WebhookEventExecutionStarted,
+	},
+	{
+		Action:        ActionCancel,
+		FromApproval:  []ApprovalStatus{ApprovalStatusApproved},
+		FromExecution: []ExecutionStatus{ExecutionStatusDraft, ExecutionStatusInProgress, ExecutionStatusFailed},
+		ToExecution:   ExecutionStatusCanceled,
+		Roles:         []Role{RoleGatewayEditor},
+		EventType:     "STATUS_CHANGE",
+		WebhookEvent:  WebhookEventCanceled,
+	},
+}
+
+// FindTransition returns the declared transition for an action
+func FindTransition(action TransitionAction) (Transition, bool) {
+	for _, t := range Transitions {
+		if t.Action == action {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// AppliesTo reports whether the transition can leave the given state
+func (t Transition) AppliesTo(approval ApprovalStatus, execution ExecutionStatus) bool {
+	approvalOK := false
+	for _, s := range t.FromApproval {
+		if s == approval {
+			approvalOK = true
+			break
+		}
+	}
+	if !approvalOK {
+		return false
+	}
+	for _, s := range t.FromExecution {
+		if s == execution {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAny reports whether any of the given roles may perform the transition
+func (t Transition) AllowsAny(roles []Role) bool {
+	for _, allowed := range t.Roles {
+		for _, r := range roles {
+			if r == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ChangesApproval reports whether the transition moves the approval status
+func (t Transition) ChangesApproval() bool {
+	return t.ToApproval != ""
+}
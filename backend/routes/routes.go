@@ -1,21 +1,31 @@
 package routes
 
 import (
+	"alpaka/backend/config"
 	"alpaka/backend/handlers"
 	"alpaka/backend/middleware"
+	"alpaka/backend/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configures all API routes
-func SetupRoutes(webhookURL string) *gin.Engine {
+func SetupRoutes(cfg *config.Config) *gin.Engine {
 	router := gin.Default()
 
 	// Apply CORS middleware to all routes
 	router.Use(middleware.CORSMiddleware())
 
+	// Load token keys
+	handlers.InitAuth(cfg.JWT, cfg.Auth)
+	handlers.InitOIDC(cfg.OIDC)
+	handlers.InitLDAP(cfg.LDAP)
+
 	// Initialize automation service
-	handlers.InitAutomationService(webhookURL)
+	handlers.InitAutomationService(cfg.Kong)
+	handlers.InitDriftDetector(cfg.Drift)
+	handlers.InitScheduler(cfg.Scheduler)
+	handlers.InitJobQueue(cfg.Jobs)
 
 	// Health check
 	// Returns: {"status": "ok"}
@@ -31,16 +41,49 @@ func SetupRoutes(webhookURL string) *gin.Engine {
 		{
 			// POST /api/v1/auth/register
 			// Request: {"username": "string", "email": "string", "password": "string"}
-			// Returns: {"token": "string", "user": {"user_id": uint, "username": "string", "email": "string", ...}}
+			// Returns: {"token": "string", "expires_at": "timestamp", "refresh_token": "string", "user": {"user_id": uint, "username": "string", "email": "string", ...}}
 			auth.POST("/register", handlers.Register)
 
 			// POST /api/v1/auth/login
+			// With LDAP_URL set the password is checked by binding to the directory; the user is provisioned and their groups synced
 			// Request: {"username": "string", "password": "string"}
-			// Returns: {"token": "string", "user": {"user_id": uint, "username": "string", "email": "string", "is_super_manager": bool, "is_gateway_editor": bool, ...}}
+			// Returns: {"token": "string", "expires_at": "timestamp", "refresh_token": "string", "user": {"user_id": uint, "username": "string", "email": "string", "is_super_manager": bool, "is_gateway_editor": bool, ...}}
 			auth.POST("/login", handlers.Login)
 
+			// POST /api/v1/auth/refresh
+			// Request: {"refresh_token": "string"}
+			// Returns: Same as login with a new access token and refresh token; the old refresh token stops working
+			// Reusing a rotated refresh token revokes its whole session (401)
+			auth.POST("/refresh", handlers.RefreshToken)
+
+			// POST /api/v1/auth/logout
+			// Revokes the current session; its access and refresh tokens stop working
+			// Returns: {"message": "Logged out successfully"}
+			auth.POST("/logout", middleware.AuthMiddleware(), handlers.Logout)
+
+			// POST /api/v1/auth/logout-all
+			// Revokes every session of the current user
+			// Returns: {"message": "All sessions revoked", "revoked_sessions": int}
+			auth.POST("/logout-all", middleware.AuthMiddleware(), handlers.LogoutAll)
+
+			// GET /api/v1/auth/providers
+			// Returns: {"local_login": bool, "ldap": bool, "oidc": bool} - the sign-in methods the login page should offer
+			// local_login means the username/password form is available, checked against the directory when ldap is true
+			auth.GET("/providers", handlers.GetAuthProviders)
+
+			// GET /api/v1/auth/oidc/login
+			// Redirects to the OIDC provider (authorization code flow with PKCE); 404 if OIDC_ISSUER_URL is not set
+			auth.GET("/oidc/login", handlers.OIDCLogin)
+
+			// GET /api/v1/auth/oidc/callback
+			// Query params: code, state (set by the provider)
+			// Validates the ID token, provisions the user on first login and syncs mapped groups to teams and roles
+			// Returns: Same as login, or a redirect to OIDC_POST_LOGIN_URL#token=...&refresh_token=...&expires_at=... when configured
+			auth.GET("/oidc/callback", handlers.OIDCCallback)
+
 			// GET /api/v1/auth/me
-			// Returns: {"user_id": uint, "username": "string", "email": "string", "team_memberships": [...], "is_super_manager": bool, "is_gateway_editor": bool}
+			// Returns: {"user_id": uint, "username": "string", "email": "string", "team_memberships": [...], "role_bindings": [{"binding_id": uint, "team_id": uint, "environment_id": uint, "role": {"name": "string", "permissions": [...]}, ...}], "is_super_manager": bool, "is_gateway_editor": bool}
+			// is_super_manager / is_gateway_editor are set when cr.approve / cr.execute is held in any scope
 			auth.GET("/me", middleware.AuthMiddleware(), handlers.GetCurrentUser)
 		}
 
@@ -58,13 +101,14 @@ func SetupRoutes(webhookURL string) *gin.Engine {
 		teams := api.Group("/teams")
 		teams.Use(middleware.AuthMiddleware())
 		{
-			// POST /api/v1/teams (Gateway Editor only)
+			// POST /api/v1/teams (requires team.manage)
 			// Request: {"name": "string"}
 			// Returns: {"team_id": uint, "name": "string"}
-			teams.POST("", middleware.RequireGatewayEditor(), handlers.CreateTeam)
+			teams.POST("", middleware.RequirePermission(models.PermTeamManage), handlers.CreateTeam)
 
 			// GET /api/v1/teams
 			// Returns: [{"team_id": uint, "name": "string", "members": [{"user_id": uint, "team_id": uint, "user": {...}}, ...]}, ...]
+			// Lists the caller's teams and those in the scope of their team.manage or cr.read bindings
 			teams.GET("", handlers.ListTeams)
 
 			// GET /api/v1/teams/my-teams
@@ -74,111 +118,508 @@ func SetupRoutes(webhookURL string) *gin.Engine {
 
 			// GET /api/v1/teams/:id
 			// Returns: {"team_id": uint, "name": "string", "members": [{"user_id": uint, "team_id": uint, "user": {...}}, ...]}
+			// Requires membership, or team.manage or cr.read for the team (403 otherwise)
 			teams.GET("/:id", handlers.GetTeam)
 
-			// POST /api/v1/teams/:id/members
+			// POST /api/v1/teams/:id/members (team members, or team.manage for the team)
 			// Request: {"user_id": uint}
 			// Returns: {"user_id": uint, "team_id": uint, "user": {...}, "team": {...}}
 			teams.POST("/:id/members", handlers.AddTeamMember)
 
-			// DELETE /api/v1/teams/:id/members/:user_id
+			// DELETE /api/v1/teams/:id/members/:user_id (team members, or team.manage for the team)
 			// Returns: {"message": "Team member removed successfully"}
 			teams.DELETE("/:id/members/:user_id", handlers.RemoveTeamMember)
 		}
 
+		// Environments
+		environments := api.Group("/environments")
+		environments.Use(middleware.AuthMiddleware())
+		{
+			// POST /api/v1/environments (requires config.manage)
+			// Request: {"name": "string", "kong_admin_url": "string", "kong_admin_token": "string", "promotion_order": int, "auto_approve": bool}
+			// Returns: {"environment_id": uint, "name": "string", "kong_admin_url": "string", "promotion_order": int, "auto_approve": bool, "created_at": "timestamp"}
+			environments.POST("", middleware.RequirePermission(models.PermConfigManage), handlers.CreateEnvironment)
+
+			// GET /api/v1/environments
+			// Returns: [{"environment_id": uint, "name": "string", ...}, ...] ordered by promotion_order
+			environments.GET("", handlers.ListEnvironments)
+
+			// GET /api/v1/environments/:id
+			// Returns: {"environment_id": uint, "name": "string", ...}
+			environments.GET("/:id", handlers.GetEnvironment)
+
+			// PUT /api/v1/environments/:id (requires config.manage)
+			// Request: same as POST (kong_admin_token is kept when omitted)
+			// Returns: Updated environment object
+			environments.PUT("/:id", middleware.RequirePermission(models.PermConfigManage), handlers.UpdateEnvironment)
+
+			// DELETE /api/v1/environments/:id (requires config.manage)
+			// Returns: {"message": "Environment deleted successfully"}
+			environments.DELETE("/:id", middleware.RequirePermission(models.PermConfigManage), handlers.DeleteEnvironment)
+		}
+
+		// Change request types (form definitions and schemas)
+		crTypes := api.Group("/cr-types")
+		crTypes.Use(middleware.AuthMiddleware())
+		{
+			// POST /api/v1/cr-types (requires config.manage)
+			// Request: {"name": "string", "display_name": "string", "description": "string", "form_definition": "string" (JSON, apiProps.json layout), "schema": "string" (JSON Schema)}
+			// Returns: {"cr_type_id": uint, "name": "string", "display_name": "string", "latest_version": 1, "builtin": false, "versions": [...], ...}
+			crTypes.POST("", middleware.RequirePermission(models.PermConfigManage), handlers.CreateCRType)
+
+			// GET /api/v1/cr-types
+			// Returns: [{"cr_type_id": uint, "name": "string", "display_name": "string", "latest_version": int, "builtin": bool, ...}, ...]
+			crTypes.GET("", handlers.ListCRTypes)
+
+			// GET /api/v1/cr-types/:name
+			// Returns: CR type with all "versions": [{"version": int, "form_definition": "string", "schema": "string", ...}, ...]
+			crTypes.GET("/:name", handlers.GetCRType)
+
+			// GET /api/v1/cr-types/:name/versions/:version
+			// :version is a number or "latest"
+			// Returns: {"version_id": uint, "cr_type_id": uint, "version": int, "form_definition": "string", "schema": "string", "created_by_user_id": uint, "created_at": "timestamp"}
+			crTypes.GET("/:name/versions/:version", handlers.GetCRTypeVersion)
+
+			// PUT /api/v1/cr-types/:name (requires config.manage)
+			// Request: {"display_name": "string", "description": "string", "form_definition": "string", "schema": "string"} (all optional)
+			// A new form_definition or schema is stored as the next version
+			// Returns: Updated CR type object
+			crTypes.PUT("/:name", middleware.RequirePermission(models.PermConfigManage), handlers.UpdateCRType)
+
+			// DELETE /api/v1/cr-types/:name (requires config.manage)
+			// Built-in types and types used by change requests cannot be deleted
+			// Returns: {"message": "Change request type deleted successfully"}
+			crTypes.DELETE("/:name", middleware.RequirePermission(models.PermConfigManage), handlers.DeleteCRType)
+		}
+
+		// Approval policies
+		policies := api.Group("/approval-policies")
+		policies.Use(middleware.AuthMiddleware())
+		{
+			// POST /api/v1/approval-policies (requires policy.manage)
+			// Request: {"name": "string", "environment_id": uint (optional), "cr_type": "string" (optional), "required_approvals": int, "required_rejections": int (default 1), "approvers_outside_requester_team": bool}
+			// Returns: {"policy_id": uint, "name": "string", "required_approvals": int, "required_rejections": int, ...}
+			policies.POST("", middleware.RequirePermission(models.PermPolicyManage), handlers.CreateApprovalPolicy)
+
+			// GET /api/v1/approval-policies
+			// Returns: [{"policy_id": uint, "name": "string", ...}, ...]
+			policies.GET("", handlers.ListApprovalPolicies)
+
+			// GET /api/v1/approval-policies/:id
+			// Returns: {"policy_id": uint, "name": "string", ...}
+			policies.GET("/:id", handlers.GetApprovalPolicy)
+
+			// PUT /api/v1/approval-policies/:id (requires policy.manage)
+			// Request: same as POST
+			// Returns: Updated approval policy object
+			policies.PUT("/:id", middleware.RequirePermission(models.PermPolicyManage), handlers.UpdateApprovalPolicy)
+
+			// DELETE /api/v1/approval-policies/:id (requires policy.manage)
+			// Returns: {"message": "Approval policy deleted successfully"}
+			policies.DELETE("/:id", middleware.RequirePermission(models.PermPolicyManage), handlers.DeleteApprovalPolicy)
+		}
+
+		// Change windows
+		windows := api.Group("/change-windows")
+		windows.Use(middleware.AuthMiddleware())
+		{
+			// POST /api/v1/change-windows (requires config.manage)
+			// Request: {"name": "string", "environment_id": uint (optional), "weekday": int (0 = Sunday), "start_time": "HH:MM", "end_time": "HH:MM", "timezone": "string" (optional, default "UTC")}
+			// Returns: {"window_id": uint, "name": "string", "weekday": int, "start_time": "HH:MM", "end_time": "HH:MM", "timezone": "string", ...}
+			windows.POST("", middleware.RequirePermission(models.PermConfigManage), handlers.CreateChangeWindow)
+
+			// GET /api/v1/change-windows
+			// Query params: environment_id
+			// Returns: [{"window_id": uint, "name": "string", ...}, ...]
+			windows.GET("", handlers.ListChangeWindows)
+
+			// PUT /api/v1/change-windows/:id (requires config.manage)
+			// Request: same as POST
+			// Returns: Updated change window object
+			windows.PUT("/:id", middleware.RequirePermission(models.PermConfigManage), handlers.UpdateChangeWindow)
+
+			// DELETE /api/v1/change-windows/:id (requires config.manage)
+			// Returns: {"message": "Change window deleted successfully"}
+			windows.DELETE("/:id", middleware.RequirePermission(models.PermConfigManage), handlers.DeleteChangeWindow)
+		}
+
+		// Freeze periods
+		freezes := api.Group("/freeze-periods")
+		freezes.Use(middleware.AuthMiddleware())
+		{
+			// POST /api/v1/freeze-periods (requires config.manage)
+			// Request: {"name": "string", "environment_id": uint (optional), "starts_at": "timestamp", "ends_at": "timestamp", "reason": "string"}
+			// Returns: {"freeze_id": uint, "name": "string", "starts_at": "timestamp", "ends_at": "timestamp", ...}
+			freezes.POST("", middleware.RequirePermission(models.PermConfigManage), handlers.CreateFreezePeriod)
+
+			// GET /api/v1/freeze-periods
+			// Query params: status ("upcoming" (default, includes active) | "all"), environment_id
+			// Returns: [{"freeze_id": uint, "name": "string", ...}, ...]
+			freezes.GET("", handlers.ListFreezePeriods)
+
+			// PUT /api/v1/freeze-periods/:id (requires config.manage)
+			// Request: same as POST
+			// Returns: Updated freeze period object
+			freezes.PUT("/:id", middleware.RequirePermission(models.PermConfigManage), handlers.UpdateFreezePeriod)
+
+			// DELETE /api/v1/freeze-periods/:id (requires config.manage)
+			// Returns: {"message": "Freeze period deleted successfully"}
+			freezes.DELETE("/:id", middleware.RequirePermission(models.PermConfigManage), handlers.DeleteFreezePeriod)
+		}
+
 		// Change Requests
 		cr := api.Group("/change-requests")
 		cr.Use(middleware.AuthMiddleware())
 		{
 			// POST /api/v1/change-requests
-			// Request: {"title": "string", "config_changes_payload": "string", "requester_team_id": uint}
+			// Request: {"title": "string", "config_changes_payload": "string", "requester_team_id": uint, "environment_id": uint (optional), "type": "string" (optional, default "kong-service"), "schema_version": int (optional, default latest), "scheduled_for": "RFC 3339 timestamp" (optional)}
 			// Returns: {"cr_id": uint, "requester_user_id": uint, "requester_team_id": uint, "title": "string", "config_changes_payload": "string", "approval_status": "string", "execution_status": "string", "created_at": "timestamp", ...}
+			// Invalid payloads return 422: {"error": "Invalid config_changes_payload", "details": [{"path": "routes[1].paths", "message": "string"}, ...]}
 			cr.POST("", handlers.CreateChangeRequest)
 
 			// GET /api/v1/change-requests
-			// Query params: approval_status, execution_status, team_id, user_id, page, limit
+			// Query params: approval_status, execution_status, team_id, user_id, environment_id, type, page, limit
+			// Lists the caller's CRs, those of their teams and those in the scope of their cr.read bindings
 			// Returns: [{"cr_id": uint, "title": "string", "approval_status": "string", "execution_status": "string", "requester_user": {...}, "requester_team": {...}, ...}, ...]
 			cr.GET("", handlers.ListChangeRequests)
 
+			// Routes about one CR require being its requester, a member of its team, or cr.read for it (403 otherwise)
 			// GET /api/v1/change-requests/:id
-			// Returns: {"cr_id": uint, "title": "string", "config_changes_payload": "string", "approval_status": "string", "execution_status": "string", "requester_user": {...}, "requester_team": {...}, "reviews": [...], "comments": [...], "history": [...], ...}
-			cr.GET("/:id", handlers.GetChangeRequest)
+			// The ETag header carries the CR's "version"; send it as If-Match to PUT /:id, /review and /execution-status
+			// so they fail with 412 {"error": "string", "version": int} if the CR changed since (409 if it changes meanwhile)
+			// Returns: {"cr_id": uint, "title": "string", "config_changes_payload": "string", "approval_status": "string", "execution_status": "string", "requester_user": {...}, "requester_team": {...}, "reviews": [...], "comments": [...], "history": [...], "approval_outcome": {"policy_name": "string", "approvals": int, "required_approvals": int, "rejections": int, "required_rejections": int, "decision": "string", ...}, ...}
+			cr.GET("/:id", middleware.RequireCRAccess(), handlers.GetChangeRequest)
 
 			// PUT /api/v1/change-requests/:id
-			// Request: {"title": "string", "config_changes_payload": "string"} (both optional)
-			// Returns: Updated change request object
+			// Request: {"title": "string", "config_changes_payload": "string", "scheduled_for": "timestamp"} (all optional)
+			// Header: If-Match (optional)
+			// Returns: Updated change request object (422 with field-level "details" for invalid payloads, 412/409 if the CR changed)
 			cr.PUT("/:id", handlers.UpdateChangeRequest)
 
+			// POST /api/v1/change-requests/:id/resubmit (requester only)
+			// Request: {"comment": "string"} (optional)
+			// Moves a NEEDS_REWORK CR back to PENDING_APPROVAL as the next revision; earlier reviews no longer count
+			// Returns: Updated change request object
+			cr.POST("/:id/resubmit", handlers.ResubmitChangeRequest)
+
+			// GET /api/v1/change-requests/:id/transitions
+			// Returns: {"cr_id": uint, "approval_status": "string", "execution_status": "string", "roles": ["REQUESTER" | "SUPER_MANAGER" | "GATEWAY_EDITOR", ...], "transitions": [{"action": "string", "to_approval_status": "string", "to_execution_status": "string", "roles": [...]}, ...]}
+			// Lists what the caller may do next
+			cr.GET("/:id/transitions", middleware.RequireCRAccess(), handlers.GetChangeRequestTransitions)
+
 			// POST /api/v1/change-requests/:id/comments
 			// Request: {"comment_text": "string"}
 			// Returns: {"comment_id": uint, "cr_id": uint, "user_id": uint, "comment_text": "string", "created_at": "timestamp", "user": {...}}
-			cr.POST("/:id/comments", handlers.AddComment)
+			cr.POST("/:id/comments", middleware.RequireCRAccess(), handlers.AddComment)
 
 			// GET /api/v1/change-requests/:id/comments
 			// Returns: [{"comment_id": uint, "cr_id": uint, "user_id": uint, "comment_text": "string", "created_at": "timestamp", "user": {...}}, ...]
-			cr.GET("/:id/comments", handlers.GetComments)
+			cr.GET("/:id/comments", middleware.RequireCRAccess(), handlers.GetComments)
 
 			// GET /api/v1/change-requests/:id/history
-			// Returns: [{"history_id": uint, "cr_id": uint, "changed_by_user_id": uint, "event_type": "string", "old_status": "string", "new_status": "string", "timestamp": "timestamp", "changed_by": {...}}, ...]
-			cr.GET("/:id/history", handlers.GetHistory)
-
-			// Super Manager routes
-			// POST /api/v1/change-requests/:id/review (Super Manager only)
-			// Request: {"review_decision": "APPROVED" | "REJECTED"}
-			// Returns: Updated change request with approval status changed
-			cr.POST("/:id/review", middleware.RequireSuperManager(), handlers.ReviewChangeRequest)
-
-			// Gateway Editor routes
-			// PUT /api/v1/change-requests/:id/execution-status (Gateway Editor only)
-			// Request: {"execution_status": "DRAFT" | "IN_PROGRESS" | "COMPLETED" | "CANCELED"}
-			// Returns: Updated change request with execution status changed
-			cr.PUT("/:id/execution-status", middleware.RequireGatewayEditor(), handlers.UpdateExecutionStatus)
+			// Returns: [{"history_id": uint, "cr_id": uint, "changed_by_user_id": uint, "changed_by_service_account_id": uint, "event_type": "string", "old_status": "string", "new_status": "string", "details": "string", "ip_address": "string", "user_agent": "string", "timestamp": "timestamp", "prev_hash": "string", "prev_global_hash": "string", "hash": "string", "changed_by": {...}, "changed_by_service_account": {...}}, ...]
+			// Entries of service accounts have changed_by_user_id 0 and changed_by_service_account set
+			// Entries written by the scheduler or automation have empty ip_address and user_agent
+			cr.GET("/:id/history", middleware.RequireCRAccess(), handlers.GetHistory)
+
+			// GET /api/v1/change-requests/:id/history/verify
+			// Walks the hash chain of the CR's history and reports the first entry that was changed, inserted or removed
+			// Returns: {"valid": bool, "cr_id": uint, "entries": int, "last_hash": "string", "first_broken": {"history_id": uint, "cr_id": uint, "reason": "string"}, "verified_at": "timestamp"}
+			cr.GET("/:id/history/verify", middleware.RequireCRAccess(), handlers.VerifyChangeRequestHistory)
+
+			// GET /api/v1/change-requests/:id/revisions
+			// Every stored version of the payload, oldest first; "revision" is the review round it belongs to
+			// Returns: [{"payload_revision_id": uint, "cr_id": uint, "number": int, "revision": int, "config_changes_payload": "string", "created_by_user_id": uint, "created_at": "timestamp", "created_by": {...}}, ...]
+			cr.GET("/:id/revisions", middleware.RequireCRAccess(), handlers.ListPayloadRevisions)
+
+			// GET /api/v1/change-requests/:id/diff
+			// Query params: from, to (payload revision numbers; to defaults to the latest, from to the last one of the previous review round)
+			// Returns: {"cr_id": uint, "from": {"number": int, "revision": int, "created_at": "timestamp", "created_by_user_id": uint}, "to": {...}, "changes": [{"path": "routes[1].paths", "type": "added" | "removed" | "changed", "old": any, "new": any}, ...], "summary": {"added": int, "removed": int, "changed": int}}
+			cr.GET("/:id/diff", middleware.RequireCRAccess(), handlers.GetPayloadDiff)
+
+			// GET /api/v1/change-requests/:id/plan
+			// Diffs the CR payload against the live Kong state (requires KONG_ADMIN_URL)
+			// Returns: {"cr_id": uint, "service_name": "string", "changes": [{"resource_type": "service" | "route" | "plugin", "name": "string", "action": "create" | "update" | "delete", "changed_fields": [...], "before": {...}, "after": {...}}, ...], "summary": {"create": int, "update": int, "delete": int}, "generated_at": "timestamp"}
+			cr.GET("/:id/plan", middleware.RequireCRAccess(), handlers.GetChangeRequestPlan)
+
+			// POST /api/v1/change-requests/:id/review (requires cr.approve for the CR)
+			// Request: {"review_decision": "APPROVED" | "REJECTED" | "CHANGES_REQUESTED", "reason": "string" (required for CHANGES_REQUESTED)}
+			// Each reviewer reviews a revision once (409 otherwise); the CR stays PENDING_APPROVAL until its approval policy is satisfied
+			// The review records the SHA-256 of the payload; reviews of an earlier payload no longer count
+			// CHANGES_REQUESTED moves the CR to NEEDS_REWORK
+			// Header: If-Match (optional), the ETag of the version that was reviewed
+			// Returns: Updated change request with "approval_outcome" (412 if the CR changed since the reviewer loaded it)
+			cr.POST("/:id/review", middleware.RequirePermission(models.PermCRApprove, middleware.CRScope), handlers.ReviewChangeRequest)
+
+			// PUT /api/v1/change-requests/:id/execution-status (requires cr.execute for the CR)
+			// Request: {"execution_status": "IN_PROGRESS" | "COMPLETED" | "CANCELED" | "FAILED"}
+			// Only transitions declared in models.Transitions are allowed (409 otherwise)
+			// Moving to IN_PROGRESS during a freeze period, or with a payload other than the approved one, returns 409 and records an EXECUTION_REFUSED history entry
+			// Header: If-Match (optional)
+			// Returns: Updated change request with execution status changed (412/409 if the CR changed)
+			cr.PUT("/:id/execution-status", middleware.RequirePermission(models.PermCRExecute, middleware.CRScope), handlers.UpdateExecutionStatus)
+
+			// POST /api/v1/change-requests/:id/rollback (requires cr.execute for the CR)
+			// Request: {"auto_approve": bool} (optional)
+			// Creates a rollback CR restoring the Kong state captured before the CR was executed
+			// Returns: The new rollback change request with "rollback_of_cr_id" set
+			cr.POST("/:id/rollback", middleware.RequirePermission(models.PermCRExecute, middleware.CRScope), handlers.RollbackChangeRequest)
+
+			// POST /api/v1/change-requests/:id/promote
+			// Request: {"title": "string"} (optional, defaults to the parent's title)
+			// Clones a COMPLETED CR into the next environment (by promotion_order) as a new CR with "parent_cr_id" set
+			// Returns: The new change request
+			cr.POST("/:id/promote", middleware.RequireCRAccess(), handlers.PromoteChangeRequest)
 		}
 
 		// Admin routes
 		admin := api.Group("/admin")
 		admin.Use(middleware.AuthMiddleware())
 		{
-			// Super Managers
-			// POST /api/v1/admin/super-managers (Super Manager only)
+			// Roles
+			// GET /api/v1/admin/permissions (requires admin.manage)
+			// Returns: ["cr.read", "cr.approve", "cr.execute", "team.manage", "config.manage", "webhook.manage", "policy.manage", "admin.manage"]
+			admin.GET("/permissions", middleware.RequirePermission(models.PermAdminManage), handlers.ListPermissions)
+
+			// POST /api/v1/admin/roles (requires admin.manage)
+			// Request: {"name": "string", "description": "string" (optional), "permissions": ["cr.approve", ...]}
+			// Returns: {"role_id": uint, "name": "string", "description": "string", "permissions": [...], "built_in": bool, "created_at": "timestamp"}
+			admin.POST("/roles", middleware.RequirePermission(models.PermAdminManage), handlers.CreateRole)
+
+			// GET /api/v1/admin/roles (requires admin.manage)
+			// Returns: [{"role_id": uint, "name": "string", "permissions": [...], "built_in": bool, ...}, ...]
+			admin.GET("/roles", middleware.RequirePermission(models.PermAdminManage), handlers.ListRoles)
+
+			// GET /api/v1/admin/roles/:id (requires admin.manage)
+			// Returns: Role object
+			admin.GET("/roles/:id", middleware.RequirePermission(models.PermAdminManage), handlers.GetRole)
+
+			// PUT /api/v1/admin/roles/:id (requires admin.manage)
+			// Request: Same as POST
+			// Returns: Updated role object (409 for the built-in super_manager and gateway_editor roles)
+			admin.PUT("/roles/:id", middleware.RequirePermission(models.PermAdminManage), handlers.UpdateRole)
+
+			// DELETE /api/v1/admin/roles/:id (requires admin.manage)
+			// Deletes the role and its bindings (409 for built-in roles)
+			// Returns: {"message": "Role deleted successfully"}
+			admin.DELETE("/roles/:id", middleware.RequirePermission(models.PermAdminManage), handlers.DeleteRole)
+
+			// Role Bindings
+			// POST /api/v1/admin/role-bindings (requires admin.manage)
+			// Request: {"role_id": uint, "user_id": uint, "team_id": uint (optional), "environment_id": uint (optional)}
+			// A team or environment limits the binding to CRs and teams of that team / CRs targeting that environment
+			// Returns: {"binding_id": uint, "role_id": uint, "user_id": uint, "team_id": uint, "environment_id": uint, "created_by_user_id": uint, "created_at": "timestamp", "role": {...}, "user": {...}, ...} (409 if it exists)
+			admin.POST("/role-bindings", middleware.RequirePermission(models.PermAdminManage), handlers.CreateRoleBinding)
+
+			// GET /api/v1/admin/role-bindings (requires admin.manage)
+			// Query params: user_id, role_id, team_id, environment_id
+			// Returns: [Role binding object, ...]
+			admin.GET("/role-bindings", middleware.RequirePermission(models.PermAdminManage), handlers.ListRoleBindings)
+
+			// DELETE /api/v1/admin/role-bindings/:id (requires admin.manage)
+			// Returns: {"message": "Role binding deleted successfully"}
+			admin.DELETE("/role-bindings/:id", middleware.RequirePermission(models.PermAdminManage), handlers.DeleteRoleBinding)
+
+			// Super Managers: shortcuts for unrestricted bindings of the built-in super_manager role
+			// POST /api/v1/admin/super-managers (requires admin.manage)
 			// Request: {"user_id": uint}
-			// Returns: {"user_id": uint, "added_at": "timestamp", "user": {...}}
-			admin.POST("/super-managers", middleware.RequireSuperManager(), handlers.AddSuperManager)
+			// Returns: Role binding object
+			admin.POST("/super-managers", middleware.RequirePermission(models.PermAdminManage), handlers.AddSuperManager)
 
-			// DELETE /api/v1/admin/super-managers/:id (Super Manager only)
+			// DELETE /api/v1/admin/super-managers/:id (requires admin.manage)
 			// Returns: {"message": "Super manager removed successfully"}
-			admin.DELETE("/super-managers/:id", middleware.RequireSuperManager(), handlers.RemoveSuperManager)
+			admin.DELETE("/super-managers/:id", middleware.RequirePermission(models.PermAdminManage), handlers.RemoveSuperManager)
 
 			// GET /api/v1/admin/super-managers
-			// Returns: [{"user_id": uint, "added_at": "timestamp", "user": {...}}, ...]
+			// Returns: [Role binding object with "user", ...]
 			admin.GET("/super-managers", handlers.ListSuperManagers)
 
-			// Gateway Editors
-			// POST /api/v1/admin/gateway-editors (Super Manager only)
+			// Gateway Editors: shortcuts for unrestricted bindings of the built-in gateway_editor role
+			// POST /api/v1/admin/gateway-editors (requires admin.manage)
 			// Request: {"user_id": uint}
-			// Returns: {"user_id": uint, "added_at": "timestamp", "user": {...}}
-			admin.POST("/gateway-editors", middleware.RequireSuperManager(), handlers.AddGatewayEditor)
+			// Returns: Role binding object
+			admin.POST("/gateway-editors", middleware.RequirePermission(models.PermAdminManage), handlers.AddGatewayEditor)
 
-			// DELETE /api/v1/admin/gateway-editors/:id (Super Manager only)
+			// DELETE /api/v1/admin/gateway-editors/:id (requires admin.manage)
 			// Returns: {"message": "Gateway editor removed successfully"}
-			admin.DELETE("/gateway-editors/:id", middleware.RequireSuperManager(), handlers.RemoveGatewayEditor)
+			admin.DELETE("/gateway-editors/:id", middleware.RequirePermission(models.PermAdminManage), handlers.RemoveGatewayEditor)
 
 			// GET /api/v1/admin/gateway-editors
-			// Returns: [{"user_id": uint, "added_at": "timestamp", "user": {...}}, ...]
+			// Returns: [Role binding object with "user", ...]
 			admin.GET("/gateway-editors", handlers.ListGatewayEditors)
+
+			// LDAP
+			// POST /api/v1/admin/ldap/sync (requires admin.manage)
+			// Mirrors directory groups into teams and role groups into bindings of the super_manager / gateway_editor roles now
+			// Returns: {"started_at": "timestamp", "finished_at": "timestamp", "users_provisioned": ["string"], "teams_created": ["string"], "memberships_added": [{"username": "string", "team": "string"}], "memberships_removed": [...], "roles_granted": [{"username": "string", "role": "super_manager" | "gateway_editor"}], "roles_revoked": [...], "skipped": ["string"], "error": "string"} (502 if the sync failed)
+			admin.POST("/ldap/sync", middleware.RequirePermission(models.PermAdminManage), handlers.RunLDAPSync)
+
+			// GET /api/v1/admin/ldap/sync (requires admin.manage)
+			// Returns: Report of the last sync, periodic or manual (404 before the first one)
+			admin.GET("/ldap/sync", middleware.RequirePermission(models.PermAdminManage), handlers.GetLDAPSyncReport)
+
+			// Audit
+			// GET /api/v1/admin/audit (requires admin.manage)
+			// Query params: from, to (RFC 3339, to exclusive), actor_user_id, actor (username), action (or a prefix such as "auth."), target_type, target_id, page, limit (default 50)
+			// Returns: [{"event_id": uint, "action": "string", "actor_user_id": uint, "actor_service_account_id": uint, "actor_name": "string", "target_type": "string", "target_id": "string", "details": {...}, "ip_address": "string", "user_agent": "string", "created_at": "timestamp"}, ...] newest first
+			admin.GET("/audit", middleware.RequirePermission(models.PermAdminManage), handlers.ListAuditEvents)
+
+			// GET /api/v1/admin/audit/export (requires admin.manage)
+			// Query params: the filters of /admin/audit, format ("csv" (default) | "json")
+			// Returns: Every matching event, oldest first, as a file download
+			admin.GET("/audit/export", middleware.RequirePermission(models.PermAdminManage), handlers.ExportAuditEvents)
+
+			// History
+			// GET /api/v1/admin/history/verify (requires admin.manage)
+			// Walks the hash chain over the history of all CRs, including removals at its end
+			// Returns: {"valid": bool, "entries": int, "last_hash": "string", "first_broken": {"history_id": uint, "cr_id": uint, "reason": "string"}, "verified_at": "timestamp"}
+			admin.GET("/history/verify", middleware.RequirePermission(models.PermAdminManage), handlers.VerifyHistory)
+
+			// Service Accounts
+			// POST /api/v1/admin/service-accounts (requires admin.manage)
+			// Request: {"name": "string", "description": "string" (optional), "active": bool (optional, default true)}
+			// Returns: {"service_account_id": uint, "name": "string", "description": "string", "active": bool, "created_by_user_id": uint, "created_at": "timestamp"}
+			admin.POST("/service-accounts", middleware.RequirePermission(models.PermAdminManage), handlers.CreateServiceAccount)
+
+			// GET /api/v1/admin/service-accounts (requires admin.manage)
+			// Returns: [{"service_account_id": uint, "name": "string", "active": bool, ...}, ...]
+			admin.GET("/service-accounts", middleware.RequirePermission(models.PermAdminManage), handlers.ListServiceAccounts)
+
+			// GET /api/v1/admin/service-accounts/:id (requires admin.manage)
+			// Returns: Service account object with "api_keys": [...]
+			admin.GET("/service-accounts/:id", middleware.RequirePermission(models.PermAdminManage), handlers.GetServiceAccount)
+
+			// PUT /api/v1/admin/service-accounts/:id (requires admin.manage)
+			// Request: Same as POST; keys of an inactive account are refused
+			// Returns: Updated service account object
+			admin.PUT("/service-accounts/:id", middleware.RequirePermission(models.PermAdminManage), handlers.UpdateServiceAccount)
+
+			// DELETE /api/v1/admin/service-accounts/:id (requires admin.manage)
+			// Deletes the account and its keys; history entries keep its ID
+			// Returns: {"message": "Service account deleted successfully"}
+			admin.DELETE("/service-accounts/:id", middleware.RequirePermission(models.PermAdminManage), handlers.DeleteServiceAccount)
+
+			// POST /api/v1/admin/service-accounts/:id/keys (requires admin.manage)
+			// Request: {"name": "string", "scopes": ["cr:read" | "cr:execute", ...], "expires_at": "timestamp" (optional, never expires if omitted)}
+			// Returns: {"key": "alpk_...", "api_key": {"key_id": uint, "name": "string", "prefix": "string", "scopes": [...], "expires_at": "timestamp", ...}} - the key is only shown here
+			admin.POST("/service-accounts/:id/keys", middleware.RequirePermission(models.PermAdminManage), handlers.CreateAPIKey)
+
+			// GET /api/v1/admin/service-accounts/:id/keys (requires admin.manage)
+			// Returns: [{"key_id": uint, "name": "string", "prefix": "string", "scopes": [...], "expires_at": "timestamp", "last_used_at": "timestamp", "revoked_at": "timestamp", ...}, ...]
+			admin.GET("/service-accounts/:id/keys", middleware.RequirePermission(models.PermAdminManage), handlers.ListAPIKeys)
+
+			// DELETE /api/v1/admin/service-accounts/:id/keys/:key_id (requires admin.manage)
+			// Revokes the key
+			// Returns: Revoked API key object
+			admin.DELETE("/service-accounts/:id/keys/:key_id", middleware.RequirePermission(models.PermAdminManage), handlers.RevokeAPIKey)
+		}
+
+		// Declarative gateway configuration (decK format)
+		gateway := api.Group("/gateway")
+		gateway.Use(middleware.AuthMiddleware())
+		{
+			// GET /api/v1/gateway/export (requires config.manage for the environment)
+			// Query params: format ("yaml" (default) | "json"), environment_id (optional; without it, bindings limited to an environment do not grant the export)
+			// Returns: decK file built from all COMPLETED change requests: {"_format_version": "3.0", "services": [{"name": "string", "protocol": "string", "host": "string", "port": int, "path": "string", "routes": [...], "plugins": [...]}, ...]}
+			gateway.GET("/export", middleware.RequirePermission(models.PermConfigManage, middleware.EnvironmentQueryScope), handlers.ExportGatewayConfig)
+
+			// POST /api/v1/gateway/import
+			// Query params: team_id (required, the caller must be a member), environment_id (optional)
+			// Request: decK file (YAML or JSON) as the raw body
+			// Returns: {"change_requests": [...], "warnings": ["string", ...]} - one pending CR per service
+			gateway.POST("/import", handlers.ImportGatewayConfig)
+		}
+
+		// Drift detection
+		drift := api.Group("/drift")
+		drift.Use(middleware.AuthMiddleware())
+		{
+			// GET /api/v1/drift (requires config.manage)
+			// Query params: status ("open" (default) | "resolved" | "all"), service, environment_id
+			// Returns: [{"finding_id": uint, "service_name": "string", "resource_type": "service" | "route" | "plugin", "resource_name": "string", "drift_type": "MISSING" | "MODIFIED" | "UNEXPECTED" | "UNMANAGED", "changed_fields": "string", "expected": {...}, "actual": {...}, "source_cr_id": uint, "detected_at": "timestamp", "last_seen_at": "timestamp", "resolved_at": "timestamp"}, ...]
+			drift.GET("", middleware.RequirePermission(models.PermConfigManage), handlers.ListDriftFindings)
+
+			// POST /api/v1/drift/check (requires config.manage)
+			// Runs a drift check immediately
+			// Returns: {"new_findings": [...]}
+			drift.POST("/check", middleware.RequirePermission(models.PermConfigManage), handlers.RunDriftCheck)
+		}
+
+		// Webhook subscriptions
+		webhooks := api.Group("/webhooks")
+		webhooks.Use(middleware.AuthMiddleware())
+		{
+			// POST /api/v1/webhooks (requires webhook.manage)
+			// Request: {"name": "string", "url": "string", "secret": "string" (optional), "events": ["CR_CREATED" | "REVIEWED" | "CHANGES_REQUESTED" | "APPROVED" | "REJECTED" | "EXECUTION_STARTED" | "COMPLETED" | "FAILED" | "CANCELED" | "COMMENT_ADDED" | "DRIFT_DETECTED", ...] (empty = all), "team_id": uint (optional), "active": bool (default true)}
+			// Returns: {"subscription_id": uint, "name": "string", "url": "string", "events": [...], "team_id": uint, "active": bool, "has_secret": bool, ...}
+			webhooks.POST("", middleware.RequirePermission(models.PermWebhookManage), handlers.CreateWebhookSubscription)
+
+			// GET /api/v1/webhooks (requires webhook.manage)
+			// Returns: [{"subscription_id": uint, "name": "string", ...}, ...]
+			webhooks.GET("", middleware.RequirePermission(models.PermWebhookManage), handlers.ListWebhookSubscriptions)
+
+			// GET /api/v1/webhooks/:id (requires webhook.manage)
+			// Returns: {"subscription_id": uint, "name": "string", ...}
+			webhooks.GET("/:id", middleware.RequirePermission(models.PermWebhookManage), handlers.GetWebhookSubscription)
+
+			// PUT /api/v1/webhooks/:id (requires webhook.manage)
+			// Request: same as POST; omit "secret" to keep the current one
+			// Returns: Updated subscription object
+			webhooks.PUT("/:id", middleware.RequirePermission(models.PermWebhookManage), handlers.UpdateWebhookSubscription)
+
+			// DELETE /api/v1/webhooks/:id (requires webhook.manage)
+			// Returns: {"message": "Webhook subscription deleted successfully"}
+			webhooks.DELETE("/:id", middleware.RequirePermission(models.PermWebhookManage), handlers.DeleteWebhookSubscription)
+
+			// GET /api/v1/webhooks/:id/deliveries (requires webhook.manage)
+			// Query params: status ("PENDING" | "DELIVERED" | "FAILED"), event, page, limit
+			// Returns: [{"delivery_id": uint, "event": "string", "cr_id": uint, "payload": "string", "status": "string", "attempts": int, "response_code": int, "response_body": "string", "error": "string", "created_at": "timestamp", "delivered_at": "timestamp"}, ...]
+			webhooks.GET("/:id/deliveries", middleware.RequirePermission(models.PermWebhookManage), handlers.ListWebhookDeliveries)
+
+			// POST /api/v1/webhooks/:id/deliveries/:delivery_id/redeliver (requires webhook.manage)
+			// Queues the payload of a delivery again as a new delivery
+			// Returns: The new delivery with "redelivery_of" set (202)
+			webhooks.POST("/:id/deliveries/:delivery_id/redeliver", middleware.RequirePermission(models.PermWebhookManage), handlers.RedeliverWebhook)
 		}
 
 		// Automation/CI-CD routes
 		automation := api.Group("/automation")
 		{
-			// GET /api/v1/automation/change-requests/:id/status
-			// Public endpoint for CI/CD systems (can be secured with API keys)
-			// Returns: {"cr_id": uint, "title": "string", "approval_status": "string", "execution_status": "string", "can_execute": bool, "config_changes": "string", "requester_team": "string", "created_at": "timestamp"}
-			automation.GET("/change-requests/:id/status", handlers.GetCRStatusForCI)
-
-			// POST /api/v1/automation/change-requests/:id/trigger
+			// The CI/CD endpoints below accept a user JWT or a service account API key in the X-API-Key header
+			// GET /api/v1/automation/change-requests/:id/status (API key scope cr:read, or read access to the CR)
+			// Endpoint for CI/CD systems; can_execute is false if the payload is not the approved one
+			// Returns: {"cr_id": uint, "title": "string", "approval_status": "string", "execution_status": "string", "can_execute": bool, "config_changes": "string", "payload_hash": "string", "approved_payload_hash": "string", "refused_reason": "string", "requester_team": "string", "created_at": "timestamp"}
+			automation.GET("/change-requests/:id/status", middleware.APIKeyOrAuth(models.ScopeCRRead), middleware.RequireCRAccess(), handlers.GetCRStatusForCI)
+
+			// POST /api/v1/automation/change-requests/:id/trigger (requires cr.execute for the CR, or API key scope cr:execute)
+			// Moves an approved CR to IN_PROGRESS and queues applying it to Kong
 			// Returns: {"message": "Automation triggered successfully"}
-			automation.POST("/change-requests/:id/trigger", middleware.AuthMiddleware(), handlers.TriggerAutomation)
+			automation.POST("/change-requests/:id/trigger", middleware.APIKeyOrAuth(models.ScopeCRExecute), middleware.RequirePermission(models.PermCRExecute, middleware.CRScope), handlers.TriggerAutomation)
+
+			// POST /api/v1/automation/change-requests/:id/result (requires cr.execute for the CR, or API key scope cr:execute)
+			// Lets the pipeline that executed a CR report back; moves it from IN_PROGRESS to COMPLETED or FAILED
+			// Request: {"result": "SUCCESS" | "FAILURE", "log_url": "string" (optional), "message": "string" (optional), "pipeline": {"provider": "string", "run_id": "string", ...} (optional)}
+			// Returns: Updated change request; the run details are stored as JSON in the history entry's details (409 if the CR is not IN_PROGRESS)
+			automation.POST("/change-requests/:id/result", middleware.APIKeyOrAuth(models.ScopeCRExecute), middleware.RequirePermission(models.PermCRExecute, middleware.CRScope), handlers.ReportExecutionResult)
+
+			// POST /api/v1/automation/scheduler/run (requires cr.execute)
+			// Starts approved CRs that are due and not blocked by a freeze or change window
+			// Returns: {"started": [uint, ...]}
+			automation.POST("/scheduler/run", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermCRExecute), handlers.RunScheduler)
+
+			// GET /api/v1/automation/jobs (requires cr.execute)
+			// Query params: status ("PENDING" | "RUNNING" | "SUCCEEDED" | "DEAD"), kind, cr_id, page, limit
+			// Returns: [{"job_id": uint, "kind": "process_cr" | "apply_cr" | "webhook_delivery", "cr_id": uint, "status": "string", "attempts": int, "run_at": "timestamp", "last_error": "string", "created_at": "timestamp", "completed_at": "timestamp"}, ...]
+			automation.GET("/jobs", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermCRExecute), handlers.ListJobs)
+
+			// GET /api/v1/automation/jobs/:id (requires cr.execute)
+			// Returns: {"job_id": uint, "kind": "string", "payload": {...}, "status": "string", ...}
+			automation.GET("/jobs/:id", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermCRExecute), handlers.GetJob)
+
+			// POST /api/v1/automation/jobs/:id/retry (requires cr.execute)
+			// Gives a DEAD job a fresh set of attempts (409 for other statuses)
+			// Returns: Updated job object
+			automation.POST("/jobs/:id/retry", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermCRExecute), handlers.RetryJob)
 		}
 	}
 
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+
+	"alpaka/backend/models"
+)
+
+func TestKeyAllows(t *testing.T) {
+	team, otherTeam, env := uint(1), uint(2), uint(3)
+	executeKey := &models.APIKey{Scopes: []string{models.ScopeCRExecute}}
+	readKey := &models.APIKey{Scopes: []string{models.ScopeCRRead}}
+	crScope := Scope{TeamID: &team, EnvironmentID: &env}
+
+	tests := []struct {
+		name    string
+		key     *models.APIKey
+		account models.ServiceAccount
+		perm    models.Permission
+		scope   Scope
+		want    bool
+	}{
+		{"unrestricted account", executeKey, models.ServiceAccount{}, models.PermCRExecute, crScope, true},
+		{"key lacks the scope", readKey, models.ServiceAccount{}, models.PermCRExecute, crScope, false},
+		{"permission keys cannot grant", executeKey, models.ServiceAccount{}, models.PermConfigManage, crScope, false},
+		{"account of the CR's team", executeKey, models.ServiceAccount{TeamID: &team}, models.PermCRExecute, crScope, true},
+		{"account of another team", executeKey, models.ServiceAccount{TeamID: &otherTeam}, models.PermCRExecute, crScope, false},
+		{"account of the CR's environment", readKey, models.ServiceAccount{TeamID: &team, EnvironmentID: &env}, models.PermCRRead, crScope, true},
+		{"CR without an environment", readKey, models.ServiceAccount{EnvironmentID: &env}, models.PermCRRead, Scope{TeamID: &team}, false},
+		{"team account without a resource", executeKey, models.ServiceAccount{TeamID: &team}, models.PermCRExecute, Scope{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KeyAllows(tt.key, &tt.account, tt.perm, tt.scope); got != tt.want {
+				t.Errorf("KeyAllows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultApprovalPolicy applies when no configured policy matches a CR:
+// one approval approves and any rejection rejects
+func DefaultApprovalPolicy() models.ApprovalPolicy {
+	return models.ApprovalPolicy{
+		Name:               "default",
+		RequiredApprovals:  1,
+		RequiredRejections: 1,
+	}
+}
+
+// ApprovalPolicyFor returns the most specific policy matching the CR's
+// environment and type. Environment matches win over type matches.
+func ApprovalPolicyFor(cr *models.ChangeRequest) (models.ApprovalPolicy, error) {
+	query := database.DB.Where("(cr_type = '' OR cr_type = ?)", cr.Type)
+	if cr.EnvironmentID != nil {
+		query = query.Where("(environment_id IS NULL OR environment_id = ?)", *cr.EnvironmentID)
+	} else {
+		query = query.Where("environment_id IS NULL")
+	}
+
+	var policy models.ApprovalPolicy
+	err := query.Order("environment_id IS NULL ASC").Order("cr_type = '' ASC").First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultApprovalPolicy(), nil
+	}
+	if err != nil {
+		return models.ApprovalPolicy{}, fmt.Errorf("failed to load approval policy: %w", err)
+	}
+	return policy, nil
+}
+
+// EvaluateApproval evaluates the policy of a CR over the given reviews.
+// Only reviews of the CR's current revision count.
+func EvaluateApproval(cr *models.ChangeRequest, reviews []models.SuperManagerReview) (*models.ApprovalOutcome, error) {
+	policy, err := ApprovalPolicyFor(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &models.ApprovalOutcome{
+		PolicyName:                    policy.Name,
+		RequiredApprovals:             policy.RequiredApprovals,
+		RequiredRejections:            policy.RequiredRejections,
+		ApproversOutsideRequesterTeam: policy.ApproversOutsideRequesterTeam,
+		Decision:                      models.ApprovalStatusPending,
+	}
+	if policy.PolicyID != 0 {
+		outcome.PolicyID = &policy.PolicyID
+	}
+
+	teamMembers := map[uint]bool{}
+	if policy.ApproversOutsideRequesterTeam {
+		var memberships []models.UserTeamMembership
+		if err := database.DB.Where("team_id = ?", cr.RequesterTeamID).Find(&memberships).Error; err != nil {
+			return nil, fmt.Errorf("failed to load requester team: %w", err)
+		}
+		for _, m := range memberships {
+			teamMembers[m.UserID] = true
+		}
+	}
+
+	// Reviews count for the payload they were given on; an edit of a pending CR
+	// needs fresh reviews. Reviews recorded before hashes were kept have none.
+	payloadHash, err := HashPayload(cr.ConfigChangesPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, review := range reviews {
+		if review.Revision != cr.Revision {
+			continue
+		}
+		if review.PayloadHash != "" && review.PayloadHash != payloadHash {
+			outcome.OutdatedReviews++
+			continue
+		}
+		switch review.ReviewDecision {
+		case models.ReviewDecisionApproved:
+			if teamMembers[review.SMUserID] {
+				outcome.IgnoredApprovals++
+				continue
+			}
+			outcome.Approvals++
+		case models.ReviewDecisionRejected:
+			outcome.Rejections++
+		}
+	}
+
+	// Rejections are checked first so a blocking rejection cannot be outvoted
+	switch {
+	case outcome.Rejections >= max(policy.RequiredRejections, 1):
+		outcome.Decision = models.ApprovalStatusRejected
+	case outcome.Approvals >= max(policy.RequiredApprovals, 1):
+		outcome.Decision = models.ApprovalStatusApproved
+	}
+	return outcome, nil
+}
+
+// EvaluateChangeRequestApproval evaluates the policy of a CR over its stored reviews
+func EvaluateChangeRequestApproval(cr *models.ChangeRequest) (*models.ApprovalOutcome, error) {
+	var reviews []models.SuperManagerReview
+	if err := database.DB.Where("cr_id = ? AND revision = ?", cr.CRID, cr.Revision).Find(&reviews).Error; err != nil {
+		return nil, fmt.Errorf("failed to load reviews: %w", err)
+	}
+	return EvaluateApproval(cr, reviews)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// NewAuditEvent returns an audit event of an action by the actor on a target.
+// targetID may be empty for actions without a target.
+func (a Actor) NewAuditEvent(action models.AuditAction, targetType string, targetID interface{}) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:                action,
+		ActorServiceAccountID: a.ServiceAccountID,
+		TargetType:            targetType,
+		TargetID:              fmt.Sprint(targetID),
+		IPAddress:             a.IPAddress,
+		UserAgent:             a.UserAgent,
+	}
+	if a.UserID != 0 {
+		userID := a.UserID
+		event.ActorUserID = &userID
+	}
+	return event
+}
+
+// RecordAudit stores an audit event. db may be a transaction, so that the event
+// is only kept if the change it records is.
+func RecordAudit(db *gorm.DB, event *models.AuditEvent) error {
+	if len(event.UserAgent) > maxUserAgent {
+		event.UserAgent = event.UserAgent[:maxUserAgent]
+	}
+	if err := db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record audit event %s: %w", event.Action, err)
+	}
+	return nil
+}
+
+// recordSyncAudit records a change made by mirroring the groups of an identity provider
+func recordSyncAudit(tx *gorm.DB, source string, action models.AuditAction, targetType string, targetID interface{}, details map[string]interface{}) error {
+	event := SystemActor().NewAuditEvent(action, targetType, targetID)
+	details["source"] = source
+	event.Details = details
+	return RecordAudit(tx, &event)
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	From        *time.Time
+	To          *time.Time // Exclusive
+	ActorUserID *uint
+	ActorName   string
+	Action      string // An action, or a prefix ending in "." such as "auth."
+	TargetType  string
+	TargetID    string
+}
+
+// FilterAuditEvents limits an audit_events query to a filter
+func FilterAuditEvents(query *gorm.DB, f AuditFilter) *gorm.DB {
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at < ?", *f.To)
+	}
+	if f.ActorUserID != nil {
+		query = query.Where("actor_user_id = ?", *f.ActorUserID)
+	}
+	if f.ActorName != "" {
+		query = query.Where("actor_name = ?", f.ActorName)
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		query = query.Where("action LIKE ?", f.Action+"%")
+	} else if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		query = query.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		query = query.Where("target_id = ?", f.TargetID)
+	}
+	return query
+}
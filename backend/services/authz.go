@@ -0,0 +1,334 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrBuiltInRole is returned when changing or deleting a built-in role
+var ErrBuiltInRole = errors.New("built-in roles cannot be changed")
+
+// builtinRoles are created at startup. They grant what the former Super Manager
+// and Gateway Editor tables did.
+var builtinRoles = []models.RoleDefinition{
+	{
+		Name:        models.RoleNameSuperManager,
+		Permissions: []models.Permission{models.PermCRRead, models.PermCRApprove, models.PermPolicyManage, models.PermAdminManage},
+	},
+	{
+		Name: models.RoleNameGatewayEditor,
+		Permissions: []models.Permission{
+			models.PermCRRead, models.PermCRExecute, models.PermTeamManage,
+			models.PermConfigManage, models.PermWebhookManage,
+		},
+	},
+}
+
+// Scope is the team and environment of the resource a permission is checked
+// for. Nil fields mean the resource has none, so only bindings that are not
+// limited to a team (or environment) apply.
+type Scope struct {
+	TeamID        *uint
+	EnvironmentID *uint
+}
+
+// CRScope is the scope of a change request
+func CRScope(cr *models.ChangeRequest) Scope {
+	teamID := cr.RequesterTeamID
+	return Scope{TeamID: &teamID, EnvironmentID: cr.EnvironmentID}
+}
+
+// TeamScope is the scope of a team
+func TeamScope(teamID uint) Scope {
+	return Scope{TeamID: &teamID}
+}
+
+// Grants are the role bindings of a user, with their roles loaded
+type Grants []models.RoleBinding
+
+// LoadGrants loads the role bindings of a user
+func LoadGrants(db *gorm.DB, userID uint) (Grants, error) {
+	var bindings []models.RoleBinding
+	if err := db.Preload("Role").Where("user_id = ?", userID).Find(&bindings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load role bindings: %w", err)
+	}
+	return Grants(bindings), nil
+}
+
+// HasPermission reports whether a user holds a permission in a scope
+func HasPermission(userID uint, perm models.Permission, scope Scope) (bool, error) {
+	grants, err := LoadGrants(database.DB, userID)
+	if err != nil {
+		return false, err
+	}
+	return grants.Allows(perm, scope), nil
+}
+
+// Allows reports whether a binding grants the permission in the scope
+func (g Grants) Allows(perm models.Permission, scope Scope) bool {
+	for _, b := range g {
+		if b.Role.HasPermission(perm) && scopeMatches(b.TeamID, scope.TeamID) && scopeMatches(b.EnvironmentID, scope.EnvironmentID) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAnywhere reports whether a binding grants the permission in any scope
+func (g Grants) AllowsAnywhere(perm models.Permission) bool {
+	for _, b := range g {
+		if b.Role.HasPermission(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoped returns the bindings granting the permission, and whether one of them is unrestricted
+func (g Grants) scoped(perm models.Permission) ([]models.RoleBinding, bool) {
+	var bindings []models.RoleBinding
+	for _, b := range g {
+		if !b.Role.HasPermission(perm) {
+			continue
+		}
+		if b.TeamID == nil && b.EnvironmentID == nil {
+			return nil, true
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, false
+}
+
+func scopeMatches(bound, resource *uint) bool {
+	return bound == nil || (resource != nil && *bound == *resource)
+}
+
+// CanReadCR reports whether a user may see a CR: its requester, members of its
+// team and holders of cr.read in its scope
+func CanReadCR(db *gorm.DB, userID uint, grants Grants, cr *models.ChangeRequest) (bool, error) {
+	if cr.RequesterUserID == userID || grants.Allows(models.PermCRRead, CRScope(cr)) {
+		return true, nil
+	}
+	return isTeamMember(db, userID, cr.RequesterTeamID)
+}
+
+// ReadableCRs limits a change_requests query to the CRs a user may see
+func ReadableCRs(query *gorm.DB, userID uint, grants Grants) *gorm.DB {
+	bindings, all := grants.scoped(models.PermCRRead)
+	if all {
+		return query
+	}
+
+	conditions := []string{
+		"requester_user_id = ?",
+		"requester_team_id IN (SELECT team_id FROM user_team_membership WHERE user_id = ?)",
+	}
+	args := []interface{}{userID, userID}
+	for _, b := range bindings {
+		var parts []string
+		if b.TeamID != nil {
+			parts = append(parts, "requester_team_id = ?")
+			args = append(args, *b.TeamID)
+		}
+		if b.EnvironmentID != nil {
+			parts = append(parts, "environment_id = ?")
+			args = append(args, *b.EnvironmentID)
+		}
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+	return query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// CanManageTeam reports whether a user may change the members of a team:
+// its members and holders of team.manage for it
+func CanManageTeam(db *gorm.DB, userID uint, grants Grants, teamID uint) (bool, error) {
+	if grants.Allows(models.PermTeamManage, TeamScope(teamID)) {
+		return true, nil
+	}
+	return isTeamMember(db, userID, teamID)
+}
+
+// CanReadTeam reports whether a user may see a team: its members and holders of
+// team.manage or cr.read for it
+func CanReadTeam(db *gorm.DB, userID uint, grants Grants, teamID uint) (bool, error) {
+	if grants.Allows(models.PermCRRead, TeamScope(teamID)) {
+		return true, nil
+	}
+	return CanManageTeam(db, userID, grants, teamID)
+}
+
+// ReadableTeams limits a teams query to the teams a user may see
+func ReadableTeams(query *gorm.DB, userID uint, grants Grants) *gorm.DB {
+	teamIDs := map[uint]bool{}
+	for _, perm := range []models.Permission{models.PermCRRead, models.PermTeamManage} {
+		bindings, all := grants.scoped(perm)
+		if all {
+			return query
+		}
+		for _, b := range bindings {
+			if b.TeamID != nil && b.EnvironmentID == nil {
+				teamIDs[*b.TeamID] = true
+			}
+		}
+	}
+
+	conditions := "team_id IN (SELECT team_id FROM user_team_membership WHERE user_id = ?)"
+	if len(teamIDs) == 0 {
+		return query.Where(conditions, userID)
+	}
+	return query.Where("("+conditions+" OR team_id IN ?)", userID, sortedIDs(teamIDs))
+}
+
+func isTeamMember(db *gorm.DB, userID, teamID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.UserTeamMembership{}).Where("user_id = ? AND team_id = ?", userID, teamID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to load team membership: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ValidPermission reports whether roles can be granted a permission
+func ValidPermission(perm models.Permission) bool {
+	for _, p := range models.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantBuiltinRole binds a built-in role to a user everywhere, unless already bound
+func GrantBuiltinRole(db *gorm.DB, userID uint, roleName string) (*models.RoleBinding, bool, error) {
+	role, err := builtinRole(db, roleName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var binding models.RoleBinding
+	err = unscopedBinding(db, role.RoleID, userID).First(&binding).Error
+	if err == nil {
+		return &binding, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("failed to load role binding: %w", err)
+	}
+
+	binding = models.RoleBinding{RoleID: role.RoleID, UserID: userID}
+	if err := db.Create(&binding).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to grant %s: %w", roleName, err)
+	}
+	return &binding, true, nil
+}
+
+// RevokeBuiltinRole removes the unrestricted binding of a built-in role from a
+// user. It reports whether there was one.
+func RevokeBuiltinRole(db *gorm.DB, userID uint, roleName string) (bool, error) {
+	role, err := builtinRole(db, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	result := unscopedBinding(db, role.RoleID, userID).Delete(&models.RoleBinding{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to revoke %s: %w", roleName, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// HasBuiltinRole reports whether a user has the unrestricted binding of a built-in role
+func HasBuiltinRole(db *gorm.DB, userID uint, roleName string) (bool, error) {
+	role, err := builtinRole(db, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	if err := unscopedBinding(db.Model(&models.RoleBinding{}), role.RoleID, userID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to load role binding: %w", err)
+	}
+	return count > 0, nil
+}
+
+// BuiltinRoleBindings lists the unrestricted bindings of a built-in role
+func BuiltinRoleBindings(roleName string) ([]models.RoleBinding, error) {
+	role, err := builtinRole(database.DB, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []models.RoleBinding
+	if err := database.DB.Preload("User").
+		Where("role_id = ? AND team_id IS NULL AND environment_id IS NULL", role.RoleID).
+		Order("binding_id ASC").
+		Find(&bindings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load role bindings: %w", err)
+	}
+	return bindings, nil
+}
+
+func builtinRole(db *gorm.DB, name string) (*models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	if err := db.First(&role, "name = ? AND built_in = ?", name, true).Error; err != nil {
+		return nil, fmt.Errorf("built-in role %s not found: %w", name, err)
+	}
+	return &role, nil
+}
+
+func unscopedBinding(db *gorm.DB, roleID, userID uint) *gorm.DB {
+	return db.Where("role_id = ? AND user_id = ? AND team_id IS NULL AND environment_id IS NULL", roleID, userID)
+}
+
+// SeedBuiltinRoles creates the built-in roles and moves the rows of the legacy
+// super_managers and gateway_editors tables to bindings of them
+func SeedBuiltinRoles() error {
+	for _, def := range builtinRoles {
+		role := def
+		role.BuiltIn = true
+		err := database.DB.Where("name = ?", role.Name).
+			Assign(models.RoleDefinition{Permissions: role.Permissions, BuiltIn: true}).
+			FirstOrCreate(&role).Error
+		if err != nil {
+			return fmt.Errorf("failed to seed role %s: %w", def.Name, err)
+		}
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var superManagers []models.SuperManager
+		if err := tx.Find(&superManagers).Error; err != nil {
+			return fmt.Errorf("failed to load super managers: %w", err)
+		}
+		for _, sm := range superManagers {
+			if _, _, err := GrantBuiltinRole(tx, sm.UserID, models.RoleNameSuperManager); err != nil {
+				return err
+			}
+		}
+
+		var gatewayEditors []models.GatewayEditor
+		if err := tx.Find(&gatewayEditors).Error; err != nil {
+			return fmt.Errorf("failed to load gateway editors: %w", err)
+		}
+		for _, ge := range gatewayEditors {
+			if _, _, err := GrantBuiltinRole(tx, ge.UserID, models.RoleNameGatewayEditor); err != nil {
+				return err
+			}
+		}
+
+		if len(superManagers) > 0 || len(gatewayEditors) > 0 {
+			if err := tx.Where("1 = 1").Delete(&models.SuperManager{}).Error; err != nil {
+				return fmt.Errorf("failed to clear super managers: %w", err)
+			}
+			if err := tx.Where("1 = 1").Delete(&models.GatewayEditor{}).Error; err != nil {
+				return fmt.Errorf("failed to clear gateway editors: %w", err)
+			}
+			log.Printf("Moved %d super managers and %d gateway editors to role bindings", len(superManagers), len(gatewayEditors))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"sort"
+	"testing"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+)
+
+func TestGrantsAllows(t *testing.T) {
+	team, otherTeam, prod := uint(1), uint(2), uint(3)
+	approver := models.RoleDefinition{Permissions: []models.Permission{models.PermCRRead, models.PermCRApprove}}
+
+	tests := []struct {
+		name   string
+		grants Grants
+		perm   models.Permission
+		scope  Scope
+		want   bool
+	}{
+		{"no bindings", nil, models.PermCRRead, Scope{TeamID: &team}, false},
+		{"unscoped binding", Grants{{Role: approver}}, models.PermCRApprove, Scope{TeamID: &team, EnvironmentID: &prod}, true},
+		{"permission of another role", Grants{{Role: approver}}, models.PermCRExecute, Scope{TeamID: &team}, false},
+		{"binding of the team", Grants{{Role: approver, TeamID: &team}}, models.PermCRApprove, Scope{TeamID: &team}, true},
+		{"binding of another team", Grants{{Role: approver, TeamID: &otherTeam}}, models.PermCRApprove, Scope{TeamID: &team}, false},
+		{"team binding for a resource without a team", Grants{{Role: approver, TeamID: &team}}, models.PermCRApprove, Scope{}, false},
+		{"binding of the environment", Grants{{Role: approver, EnvironmentID: &prod}}, models.PermCRApprove, Scope{TeamID: &team, EnvironmentID: &prod}, true},
+		{"environment binding for a CR without one", Grants{{Role: approver, EnvironmentID: &prod}}, models.PermCRApprove, Scope{TeamID: &team}, false},
+		{"second binding matches", Grants{{Role: approver, TeamID: &otherTeam}, {Role: approver, TeamID: &team, EnvironmentID: &prod}}, models.PermCRRead, Scope{TeamID: &team, EnvironmentID: &prod}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.grants.Allows(tt.perm, tt.scope); got != tt.want {
+				t.Errorf("Allows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadableCRs(t *testing.T) {
+	teamA, teamB, prod := uint(10), uint(20), uint(3)
+	reader := models.RoleDefinition{Permissions: []models.Permission{models.PermCRRead}}
+
+	tests := []struct {
+		name   string
+		grants Grants
+		want   []string
+	}{
+		{"own CRs and CRs of own teams", nil, []string{"by user", "of team A"}},
+		{"unscoped cr.read", Grants{{Role: reader}}, []string{"by user", "of team A", "of team B", "of team B in prod"}},
+		{"cr.read for team B in prod", Grants{{Role: reader, TeamID: &teamB, EnvironmentID: &prod}}, []string{"by user", "of team A", "of team B in prod"}},
+		{"cr.read for prod", Grants{{Role: reader, EnvironmentID: &prod}}, []string{"by user", "of team A", "of team B in prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			if err := db.Create(&models.UserTeamMembership{UserID: 1, TeamID: teamA}).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, cr := range []models.ChangeRequest{
+				{Title: "by user", RequesterUserID: 1, RequesterTeamID: teamB},
+				{Title: "of team A", RequesterUserID: 2, RequesterTeamID: teamA},
+				{Title: "of team B", RequesterUserID: 2, RequesterTeamID: teamB},
+				{Title: "of team B in prod", RequesterUserID: 2, RequesterTeamID: teamB, EnvironmentID: &prod},
+			} {
+				cr.ApprovalStatus, cr.ExecutionStatus = models.ApprovalStatusPending, models.ExecutionStatusDraft
+				if err := db.Create(&cr).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var titles []string
+			if err := ReadableCRs(database.DB.Model(&models.ChangeRequest{}), 1, tt.grants).Pluck("title", &titles).Error; err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(titles)
+			if len(titles) != len(tt.want) {
+				t.Fatalf("readable = %v, want %v", titles, tt.want)
+			}
+			for i := range titles {
+				if titles[i] != tt.want[i] {
+					t.Fatalf("readable = %v, want %v", titles, tt.want)
+				}
+			}
+		})
+	}
+}
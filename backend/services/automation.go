@@ -1,31 +1,89 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"time"
 
 	"alpaka/backend/database"
 	"alpaka/backend/models"
+
+	"gorm.io/gorm"
 )
 
 // AutomationService handles automated status transitions and CI/CD integration
 type AutomationService struct {
-	WebhookURL string
+	Kong     KongClient
+	Executor Executor
+}
+
+// NewAutomationService creates a new automation service.
+// Approved CRs are applied by a KongExecutor to the gateway of their environment,
+// falling back to the given default Kong client (which may be nil).
+func NewAutomationService(kong KongClient) *AutomationService {
+	s := &AutomationService{
+		Kong: kong,
+	}
+	s.Executor = &KongExecutor{Client: kong, ClientFor: s.KongClientFor}
+	return s
+}
+
+// KongClientFor returns the Kong client of the environment a CR targets.
+// It returns nil if no gateway is configured for the CR.
+func (s *AutomationService) KongClientFor(cr *models.ChangeRequest) (KongClient, error) {
+	if cr.EnvironmentID == nil {
+		return s.Kong, nil
+	}
+	return s.KongClientForEnvironment(*cr.EnvironmentID)
 }
 
-// NewAutomationService creates a new automation service
-func NewAutomationService(webhookURL string) *AutomationService {
-	return &AutomationService{
-		WebhookURL: webhookURL,
+// KongClientForEnvironment returns the Kong client of an environment
+func (s *AutomationService) KongClientForEnvironment(environmentID uint) (KongClient, error) {
+	var env models.Environment
+	if err := database.DB.First(&env, "environment_id = ?", environmentID).Error; err != nil {
+		return nil, fmt.Errorf("environment %d not found: %w", environmentID, err)
 	}
+	if env.KongAdminURL == "" {
+		return s.Kong, nil
+	}
+	return NewKongAdminClient(env.KongAdminURL, env.KongAdminToken), nil
+}
+
+// RegisterJobs registers the handlers of the automation job kinds
+func (s *AutomationService) RegisterJobs(q *JobQueue) {
+	q.Handle(JobProcessCR, func(job *models.Job) error {
+		err := s.ProcessApprovedCR(*job.CRID, SystemActor())
+		if errors.Is(err, ErrExecutionDeferred) {
+			// The scheduler starts the CR once it is due
+			return nil
+		}
+		if errors.Is(err, ErrPayloadNotApproved) {
+			// Recorded as refused; retrying cannot make the payload the approved one
+			return nil
+		}
+		return err
+	})
+	q.Handle(JobApplyCR, func(job *models.Job) error {
+		return s.ApplyCR(*job.CRID)
+	})
+	q.Handle(JobWebhookDelivery, deliverWebhookJob)
+}
+
+// EnqueueProcessCR queues an approved CR for automation. Pass the transaction
+// that approved the CR so the job is only stored if the approval is.
+func EnqueueProcessCR(db *gorm.DB, crID uint) error {
+	_, err := EnqueueJob(db, JobProcessCR, &crID, nil)
+	return err
 }
 
-// ProcessApprovedCR automatically transitions approved CRs to execution
-func (s *AutomationService) ProcessApprovedCR(crID uint) error {
+// ProcessApprovedCR automatically transitions approved CRs to execution and
+// queues the gateway apply. Starting publishes EXECUTION_STARTED to webhook subscriptions.
+// CRs scheduled for later, frozen or outside their change windows are left
+// DRAFT for the scheduler; the returned error then wraps ErrExecutionDeferred.
+// The start is attributed to actor, the automation itself or a service account.
+func (s *AutomationService) ProcessApprovedCR(crID uint, actor Actor) error {
 	var cr models.ChangeRequest
 	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
 		return fmt.Errorf("change request not found: %w", err)
@@ -36,28 +94,28 @@ func (s *AutomationService) ProcessApprovedCR(crID uint) error {
 	}
 
 	if cr.ExecutionStatus == models.ExecutionStatusDraft {
-		// Automatically transition to IN_PROGRESS
-		cr.ExecutionStatus = models.ExecutionStatusInProgress
-		if err := database.DB.Save(&cr).Error; err != nil {
-			return fmt.Errorf("failed to update execution status: %w", err)
+		if err := ExecutionDue(&cr, time.Now()); err != nil {
+			log.Printf("Automated: CR %d not started: %v", crID, err)
+			return err
 		}
 
-		// Create history entry
-		// Use system user ID 0 for automated actions
-		systemUserID := uint(0)
-		oldStatusStr := string(models.ExecutionStatusDraft)
-		history := models.History{
-			CRID:            cr.CRID,
-			ChangedByUserID: systemUserID, // System automated action
-			EventType:       "STATUS_CHANGE",
-			OldStatus:       &oldStatusStr,
-			NewStatus:       string(models.ExecutionStatusInProgress),
+		// Automatically transition to IN_PROGRESS together with the follow-up jobs
+		tx := database.DB.Begin()
+		if err := ApplyTransition(tx, &cr, models.ActionStart, actor, ""); err != nil {
+			tx.Rollback()
+			if errors.Is(err, ErrPayloadNotApproved) {
+				RecordExecutionRefused(&cr, actor, err.Error())
+			}
+			return err
 		}
-		database.DB.Create(&history)
-
-		// Trigger CI/CD webhook if configured
-		if s.WebhookURL != "" {
-			go s.TriggerWebhook(cr)
+		if s.Executor != nil {
+			if _, err := EnqueueJob(tx, JobApplyCR, &cr.CRID, nil); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			return fmt.Errorf("failed to start change request: %w", err)
 		}
 
 		log.Printf("Automated: CR %d transitioned to IN_PROGRESS", crID)
@@ -66,54 +124,105 @@ func (s *AutomationService) ProcessApprovedCR(crID uint) error {
 	return nil
 }
 
-// TriggerWebhook sends a webhook notification to CI/CD system
-func (s *AutomationService) TriggerWebhook(cr models.ChangeRequest) {
-	payload := map[string]interface{}{
-		"cr_id":                cr.CRID,
-		"title":                cr.Title,
-		"config_changes":       cr.ConfigChangesPayload,
-		"approval_status":      cr.ApprovalStatus,
-		"execution_status":     cr.ExecutionStatus,
-		"requester_user_id":    cr.RequesterUserID,
-		"requester_team_id":    cr.RequesterTeamID,
-		"timestamp":            time.Now().Unix(),
+// ApplyCR applies an IN_PROGRESS CR to the gateway. A FAILED CR is retried,
+// so every attempt of its apply job is recorded in the CR's history.
+// CRs in any other state were finished elsewhere and are left alone.
+func (s *AutomationService) ApplyCR(crID uint) error {
+	var cr models.ChangeRequest
+	if err := database.DB.First(&cr, "cr_id = ?", crID).Error; err != nil {
+		return fmt.Errorf("change request not found: %w", err)
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("Error marshaling webhook payload: %v", err)
-		return
+	switch cr.ExecutionStatus {
+	case models.ExecutionStatusInProgress:
+	case models.ExecutionStatusFailed:
+		if err := ApplyTransition(database.DB, &cr, models.ActionRetry, SystemActor(), "Retried by the job queue"); err != nil {
+			return err
+		}
+	default:
+		return nil
 	}
 
-	resp, err := http.Post(s.WebhookURL, "application/json", 
-		bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Error sending webhook: %v", err)
-		return
+	return s.execute(&cr)
+}
+
+// execute runs the executor for an IN_PROGRESS CR and records the outcome
+func (s *AutomationService) execute(cr *models.ChangeRequest) error {
+	// Only the approved payload is applied. The CR fails without a retry;
+	// a Gateway Editor has to cancel it.
+	if err := CheckApprovedPayload(cr); err != nil {
+		log.Printf("Automated: CR %d not applied: %v", cr.CRID, err)
+		return ApplyTransition(database.DB, cr, models.ActionFail, SystemActor(), err.Error())
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Printf("Webhook sent successfully for CR %d", cr.CRID)
-	} else {
-		log.Printf("Webhook returned status %d for CR %d", resp.StatusCode, cr.CRID)
+	result, execErr := s.Executor.Execute(cr)
+	if errors.Is(execErr, ErrNoGateway) || errors.Is(execErr, ErrUnsupportedCRType) {
+		// Nothing to apply automatically; the CR stays IN_PROGRESS for CI/CD or a Gateway Editor
+		return nil
 	}
-}
 
-// ValidateConfigChanges validates the configuration changes payload
-func ValidateConfigChanges(payload string) error {
-	// Basic JSON validation
-	var config map[string]interface{}
-	if err := json.Unmarshal([]byte(payload), &config); err != nil {
-		return fmt.Errorf("invalid JSON payload: %w", err)
+	// A retry starts from what the failed attempt left behind; rollbacks
+	// restore the state before the first attempt
+	if result != nil && result.Snapshot != nil && cr.PreChangeSnapshot == nil {
+		data, err := json.Marshal(result.Snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to encode pre-change snapshot: %w", err)
+		}
+		snapshot := string(data)
+		if err := database.DB.Model(cr).Update("pre_change_snapshot", snapshot).Error; err != nil {
+			return fmt.Errorf("failed to store pre-change snapshot: %w", err)
+		}
+		cr.PreChangeSnapshot = &snapshot
 	}
 
-	// Add custom validation logic here
-	// For example, validate required fields, structure, etc.
+	action := models.ActionComplete
+	details := ""
+	if execErr != nil {
+		action = models.ActionFail
+		details = execErr.Error()
+	}
+	if err := ApplyTransition(database.DB, cr, action, SystemActor(), details); err != nil {
+		return err
+	}
 
+	if execErr != nil {
+		log.Printf("Automated: CR %d failed to apply: %v", cr.CRID, execErr)
+		return fmt.Errorf("failed to apply change request: %w", execErr)
+	}
+
+	if cr.RollbackOfCRID != nil {
+		recordSystemHistory(*cr.RollbackOfCRID, "ROLLED_BACK", "", string(models.ExecutionStatusCompleted), fmt.Sprintf("Restored by rollback CR %d", cr.CRID))
+	}
+
+	log.Printf("Automated: CR %d applied to gateway and COMPLETED", cr.CRID)
 	return nil
 }
 
+// recordSystemHistory writes a history entry for an automated action
+func recordSystemHistory(crID uint, eventType, oldStatus, newStatus, details string) {
+	history := SystemActor().NewHistory(crID, eventType, oldStatus, newStatus, details)
+	if err := RecordHistory(database.DB, &history); err != nil {
+		log.Printf("Failed to record %s for CR %d: %v", eventType, crID, err)
+	}
+}
+
+// NotifyDrift publishes a DRIFT_DETECTED event listing new drift findings
+func (s *AutomationService) NotifyDrift(findings []models.DriftFinding) {
+	if err := PublishEvent(database.DB, models.WebhookEventDriftDetected, nil, map[string]interface{}{"findings": findings}); err != nil {
+		log.Printf("Error publishing drift event: %v", err)
+	}
+}
+
+// ValidateConfigChanges validates a kong-service payload against the built-in
+// JSON Schema of the form. Failures are returned as *PayloadValidationError.
+func ValidateConfigChanges(payload string) error {
+	if err := validateAgainstSchema(configChangesSchema, payload); err != nil {
+		return err
+	}
+
+	return checkKongServicePayload(payload)
+}
+
 // GetCRStatusForCI returns CR status in a format suitable for CI/CD systems
 func GetCRStatusForCI(crID uint) (map[string]interface{}, error) {
 	var cr models.ChangeRequest
@@ -124,15 +233,43 @@ func GetCRStatusForCI(crID uint) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("change request not found: %w", err)
 	}
 
+	payloadHash, err := HashPayload(cr.ConfigChangesPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := models.FindTransition(models.ActionStart)
+	canExecute := start.AppliesTo(cr.ApprovalStatus, cr.ExecutionStatus)
+	var deferredBy, refusedBy string
+	if canExecute {
+		if err := CheckApprovedPayload(&cr); err != nil {
+			canExecute = false
+			refusedBy = err.Error()
+		} else if err := ExecutionDue(&cr, time.Now()); err != nil {
+			canExecute = false
+			deferredBy = err.Error()
+		}
+	}
 	status := map[string]interface{}{
-		"cr_id":             cr.CRID,
-		"title":             cr.Title,
-		"approval_status":   cr.ApprovalStatus,
-		"execution_status":  cr.ExecutionStatus,
-		"can_execute":       cr.ApprovalStatus == models.ApprovalStatusApproved && cr.ExecutionStatus == models.ExecutionStatusDraft,
-		"config_changes":    cr.ConfigChangesPayload,
-		"requester_team":    cr.RequesterTeam.Name,
-		"created_at":        cr.CreatedAt,
+		"cr_id":                 cr.CRID,
+		"title":                 cr.Title,
+		"type":                  cr.Type,
+		"schema_version":        cr.SchemaVersion,
+		"approval_status":       cr.ApprovalStatus,
+		"execution_status":      cr.ExecutionStatus,
+		"can_execute":           canExecute,
+		"scheduled_for":         cr.ScheduledFor,
+		"config_changes":        cr.ConfigChangesPayload,
+		"payload_hash":          payloadHash,
+		"approved_payload_hash": cr.ApprovedPayloadHash,
+		"requester_team":        cr.RequesterTeam.Name,
+		"created_at":            cr.CreatedAt,
+	}
+	if deferredBy != "" {
+		status["deferred_reason"] = deferredBy
+	}
+	if refusedBy != "" {
+		status["refused_reason"] = refusedBy
 	}
 
 	return status, nil
@@ -0,0 +1,154 @@
+package services
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/gorm"
+)
+
+// KongServiceCRType is the built-in CR type applied to Kong by the executor
+const KongServiceCRType = "kong-service"
+
+//go:embed schemas/kong_service.form.json
+var kongServiceFormJSON string
+
+var (
+	// ErrCRTypeNotFound is returned when a CR type does not exist
+	ErrCRTypeNotFound = errors.New("change request type not found")
+	// ErrCRTypeVersionNotFound is returned when a CR type has no such version
+	ErrCRTypeVersionNotFound = errors.New("change request type version not found")
+	// ErrUnsupportedCRType is returned by the Kong executor for CR types it does not apply
+	ErrUnsupportedCRType = errors.New("change request type is not applied to the gateway automatically")
+)
+
+// compiledSchemas caches compiled schemas by CRTypeVersion.VersionID.
+// Versions are immutable, so entries never go stale.
+var compiledSchemas sync.Map
+
+// IsKongServiceCR reports whether a CR carries a Kong service payload
+func IsKongServiceCR(cr *models.ChangeRequest) bool {
+	return cr.Type == "" || cr.Type == KongServiceCRType
+}
+
+// SeedBuiltinCRTypes registers the kong-service type with the form and schema
+// shipped with the backend. Existing definitions are left untouched.
+func SeedBuiltinCRTypes() error {
+	var existing models.CRType
+	err := database.DB.Where("name = ?", KongServiceCRType).First(&existing).Error
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load change request types: %w", err)
+	}
+
+	crType := models.CRType{
+		Name:          KongServiceCRType,
+		DisplayName:   "Kong service & routes",
+		Description:   "A Kong service with its routes and rate limiting",
+		LatestVersion: 1,
+		Builtin:       true,
+		Versions: []models.CRTypeVersion{{
+			Version:        1,
+			FormDefinition: kongServiceFormJSON,
+			Schema:         configChangesSchemaJSON,
+		}},
+	}
+	if err := database.DB.Create(&crType).Error; err != nil {
+		return fmt.Errorf("failed to seed change request type %s: %w", KongServiceCRType, err)
+	}
+
+	log.Printf("Seeded change request type %s", KongServiceCRType)
+	return nil
+}
+
+// ResolveCRTypeVersion loads a CR type and one of its versions. Version 0 selects the latest.
+func ResolveCRTypeVersion(typeName string, version int) (*models.CRType, *models.CRTypeVersion, error) {
+	var crType models.CRType
+	if err := database.DB.Where("name = ?", typeName).First(&crType).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrCRTypeNotFound
+		}
+		return nil, nil, err
+	}
+
+	if version == 0 {
+		version = crType.LatestVersion
+	}
+
+	var typeVersion models.CRTypeVersion
+	if err := database.DB.Where("cr_type_id = ? AND version = ?", crType.CRTypeID, version).First(&typeVersion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrCRTypeVersionNotFound
+		}
+		return nil, nil, err
+	}
+
+	return &crType, &typeVersion, nil
+}
+
+// CompileCRTypeSchema checks that a document is a usable JSON Schema
+func CompileCRTypeSchema(schema string) (*jsonschema.Schema, error) {
+	compiled, err := jsonschema.CompileString("cr-type.schema.json", schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return compiled, nil
+}
+
+// ValidateCRPayload validates a payload against the exact CR type version it is authored with.
+// Failures are returned as *PayloadValidationError.
+func ValidateCRPayload(crType *models.CRType, version *models.CRTypeVersion, payload string) error {
+	schema, err := versionSchema(version)
+	if err != nil {
+		return err
+	}
+	if err := validateAgainstSchema(schema, payload); err != nil {
+		return err
+	}
+
+	// The executor needs kong-service payloads it can translate, whatever the schema allows
+	if crType.Name == KongServiceCRType {
+		return checkKongServicePayload(payload)
+	}
+	return nil
+}
+
+// versionSchema returns the compiled schema of a CR type version
+func versionSchema(version *models.CRTypeVersion) (*jsonschema.Schema, error) {
+	if cached, ok := compiledSchemas.Load(version.VersionID); ok {
+		return cached.(*jsonschema.Schema), nil
+	}
+
+	schema, err := CompileCRTypeSchema(version.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("change request type version %d: %w", version.Version, err)
+	}
+	compiledSchemas.Store(version.VersionID, schema)
+	return schema, nil
+}
+
+// checkKongServicePayload runs the cross-field checks the schema cannot express
+func checkKongServicePayload(payload string) error {
+	if _, err := ParseConfigChanges(payload); err != nil {
+		return &PayloadValidationError{Errors: []FieldError{{Message: err.Error()}}}
+	}
+	return nil
+}
+
+// ValidCRTypeName reports whether a name can be used as a CR type identifier
+func ValidCRTypeName(name string) bool {
+	if name == "" || len(name) > 50 {
+		return false
+	}
+	return strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789-") == "" && !strings.HasPrefix(name, "-")
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DeckFormatVersion is the decK file format produced by ExportDeck
+const DeckFormatVersion = "3.0"
+
+// DeckFile is a Kong decK declarative configuration file
+type DeckFile struct {
+	FormatVersion string        `yaml:"_format_version" json:"_format_version"`
+	Services      []DeckService `yaml:"services" json:"services"`
+}
+
+// DeckService is a service entry of a decK file
+type DeckService struct {
+	Name     string       `yaml:"name" json:"name"`
+	URL      string       `yaml:"url,omitempty" json:"url,omitempty"`
+	Protocol string       `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	Host     string       `yaml:"host,omitempty" json:"host,omitempty"`
+	Port     int          `yaml:"port,omitempty" json:"port,omitempty"`
+	Path     string       `yaml:"path,omitempty" json:"path,omitempty"`
+	Routes   []DeckRoute  `yaml:"routes,omitempty" json:"routes,omitempty"`
+	Plugins  []DeckPlugin `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+}
+
+// DeckRoute is a route entry nested under a decK service
+type DeckRoute struct {
+	Name    string       `yaml:"name" json:"name"`
+	Paths   []string     `yaml:"paths,omitempty" json:"paths,omitempty"`
+	Methods []string     `yaml:"methods,omitempty" json:"methods,omitempty"`
+	Plugins []DeckPlugin `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+}
+
+// DeckPlugin is a plugin entry of a decK service or route
+type DeckPlugin struct {
+	Name    string                 `yaml:"name" json:"name"`
+	Enabled *bool                  `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Config  map[string]interface{} `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// ExportDeck renders an expected gateway state as a decK file
+func ExportDeck(state map[string]*ExpectedService) (*DeckFile, error) {
+	file := &DeckFile{
+		FormatVersion: DeckFormatVersion,
+		Services:      []DeckService{},
+	}
+
+	for _, name := range SortedServiceNames(state) {
+		changes := state[name].Changes
+		svc, err := changes.KongService()
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		entry := DeckService{
+			Name:     svc.Name,
+			Protocol: svc.Protocol,
+			Host:     svc.Host,
+			Port:     svc.Port,
+			Path:     svc.Path,
+		}
+		for _, r := range changes.KongRoutes() {
+			entry.Routes = append(entry.Routes, DeckRoute{
+				Name:    r.Name,
+				Paths:   r.Paths,
+				Methods: r.Methods,
+			})
+		}
+		if plugin := changes.KongRateLimitPlugin(); plugin != nil {
+			enabled := plugin.Enabled
+			entry.Plugins = append(entry.Plugins, DeckPlugin{
+				Name:    plugin.Name,
+				Enabled: &enabled,
+				Config:  plugin.Config,
+			})
+		}
+		file.Services = append(file.Services, entry)
+	}
+
+	return file, nil
+}
+
+// ParseDeck parses a decK file. YAML is a superset of JSON, so both formats are accepted.
+func ParseDeck(data []byte) (*DeckFile, error) {
+	var file DeckFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid decK file: %w", err)
+	}
+	if file.FormatVersion == "" {
+		return nil, fmt.Errorf("invalid decK file: _format_version is required")
+	}
+	if len(file.Services) == 0 {
+		return nil, fmt.Errorf("decK file contains no services")
+	}
+	return &file, nil
+}
+
+// ToConfigChanges converts a decK service into a CR payload. Settings the
+// payload cannot express (plugins other than rate-limiting, route plugins)
+// are reported as warnings and dropped.
+func (s DeckService) ToConfigChanges() (*ConfigChanges, []string, error) {
+	var warnings []string
+	if s.Name == "" {
+		return nil, nil, fmt.Errorf("service without a name")
+	}
+
+	changes := &ConfigChanges{
+		Service: ServiceConfig{Name: s.Name},
+		Routes:  []RouteConfig{},
+	}
+
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("service %s: invalid url %q", s.Name, s.URL)
+		}
+		changes.Service.URL = s.URL
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			changes.Service.Port = FlexInt(port)
+		}
+	} else {
+		protocol := s.Protocol
+		if protocol == "" {
+			protocol = "http"
+		}
+		port := s.Port
+		if port == 0 {
+			port = 80
+		}
+		u := url.URL{Scheme: protocol, Host: s.Host + ":" + strconv.Itoa(port), Path: s.Path}
+		changes.Service.URL = u.String()
+		changes.Service.Port = FlexInt(port)
+	}
+
+	for _, r := range s.Routes {
+		changes.Routes = append(changes.Routes, RouteConfig{
+			Name:    r.Name,
+			Paths:   StringList(r.Paths),
+			Methods: StringList(r.Methods),
+		})
+		for _, p := range r.Plugins {
+			warnings = append(warnings, fmt.Sprintf("service %s: route %s: plugin %s is not supported and was skipped", s.Name, r.Name, p.Name))
+		}
+	}
+
+	for _, p := range s.Plugins {
+		if p.Name != RateLimitingPlugin {
+			warnings = append(warnings, fmt.Sprintf("service %s: plugin %s is not supported and was skipped", s.Name, p.Name))
+			continue
+		}
+		if p.Enabled != nil && !*p.Enabled {
+			continue
+		}
+		changes.Plugins.EnableRateLimit = true
+		if minute, ok := toFloat(p.Config["minute"]); ok {
+			changes.Plugins.Minute = FlexInt(minute)
+		}
+		for key := range p.Config {
+			if key != "minute" && !strings.HasPrefix(key, "_") {
+				warnings = append(warnings, fmt.Sprintf("service %s: rate-limiting config %s is not supported and was skipped", s.Name, key))
+			}
+		}
+	}
+
+	return changes, warnings, nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestImportedDeckPassesSchema(t *testing.T) {
+	file, err := ParseDeck([]byte(`
+_format_version: "3.0"
+services:
+  - name: orders
+    url: http://orders.internal:8080
+    routes:
+      - name: orders-list
+        paths: [/orders]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, _, err := file.Services[0].ToConfigChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateConfigChanges(string(payload)); err != nil {
+		t.Fatalf("imported payload %s: %v", payload, err)
+	}
+}
+
+func TestDeckExportImportRoundTrip(t *testing.T) {
+	payloads := []string{
+		`{"service":{"name":"users","url":"http://users.internal:8080/api","port":8080},
+		  "routes":[{"name":"users-read","paths":"/users, /v1/users","methods":["GET"]},{"name":"users-any","paths":["/u"]}],
+		  "plugins":{"enable_rate_limit":true,"minute":60}}`,
+		`{"service":{"name":"billing","url":"https://billing.internal:443","port":443},
+		  "routes":[{"name":"billing","paths":["/billing"]}],
+		  "plugins":{"enable_rate_limit":false,"minute":""}}`,
+	}
+
+	state := make(map[string]*ExpectedService)
+	for _, payload := range payloads {
+		if err := ValidateConfigChanges(payload); err != nil {
+			t.Fatalf("source payload: %v", err)
+		}
+		changes, err := ParseConfigChanges(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state[changes.Service.Name] = &ExpectedService{Changes: changes}
+	}
+
+	exported, err := ExportDeck(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ParseDeck(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Services) != len(payloads) {
+		t.Fatalf("got %d services, want %d", len(imported.Services), len(payloads))
+	}
+
+	for _, svc := range imported.Services {
+		changes, warnings, err := svc.ToConfigChanges()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warnings) > 0 {
+			t.Errorf("service %s: unexpected warnings %v", svc.Name, warnings)
+		}
+		payload, err := json.Marshal(changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateConfigChanges(string(payload)); err != nil {
+			t.Fatalf("service %s: re-imported payload %s: %v", svc.Name, payload, err)
+		}
+
+		want := state[svc.Name].Changes
+		if changes.Plugins != want.Plugins {
+			t.Errorf("service %s: plugins %+v, want %+v", svc.Name, changes.Plugins, want.Plugins)
+		}
+		if len(changes.Routes) != len(want.Routes) {
+			t.Fatalf("service %s: %d routes, want %d", svc.Name, len(changes.Routes), len(want.Routes))
+		}
+		for i, r := range changes.Routes {
+			if r.Name != want.Routes[i].Name || len(r.Paths) != len(want.Routes[i].Paths) || len(r.Methods) != len(want.Routes[i].Methods) {
+				t.Errorf("service %s: route %+v, want %+v", svc.Name, r, want.Routes[i])
+			}
+		}
+	}
+}
+
+func TestConfigChangesSchemaAllowsDisabledRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		valid   bool
+	}{
+		{"minute 0 while off", `{"service":{"name":"a","url":"http://a:80","port":80},"routes":[{"name":"a","paths":["/a"],"methods":null}],"plugins":{"enable_rate_limit":false,"minute":0}}`, true},
+		{"minute 0 while on", `{"service":{"name":"a","url":"http://a:80","port":80},"routes":[{"name":"a","paths":["/a"]}],"plugins":{"enable_rate_limit":true,"minute":0}}`, false},
+		{"minute missing while on", `{"service":{"name":"a","url":"http://a:80","port":80},"routes":[{"name":"a","paths":["/a"]}],"plugins":{"enable_rate_limit":true}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfigChanges(tt.payload)
+			if (err == nil) != tt.valid {
+				t.Errorf("valid = %v, err = %v", tt.valid, err)
+			}
+		})
+	}
+}
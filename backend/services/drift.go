@@ -0,0 +1,232 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+)
+
+// DriftDetector periodically compares the state built from completed CRs
+// with the live gateway and records the differences as drift findings
+type DriftDetector struct {
+	Automation *AutomationService
+	Interval   time.Duration
+	Notify     bool // Send a DRIFT_DETECTED webhook when new drift appears
+}
+
+// NewDriftDetector creates a new drift detector
+func NewDriftDetector(automation *AutomationService, interval time.Duration, notify bool) *DriftDetector {
+	return &DriftDetector{
+		Automation: automation,
+		Interval:   interval,
+		Notify:     notify,
+	}
+}
+
+// driftTarget is one gateway together with the CRs that target it
+type driftTarget struct {
+	Client        KongClient
+	Scope         GatewayScope
+	EnvironmentID *uint // Recorded on findings; nil for the default gateway
+}
+
+// targets groups environments by gateway. Environments without their own
+// Kong Admin URL share the default gateway.
+func (d *DriftDetector) targets() ([]driftTarget, error) {
+	var envs []models.Environment
+	if err := database.DB.Order("promotion_order ASC").Find(&envs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load environments: %w", err)
+	}
+
+	defaultTarget := driftTarget{Client: d.Automation.Kong, Scope: DefaultGatewayScope()}
+	var targets []driftTarget
+	for _, env := range envs {
+		envID := env.EnvironmentID
+		if env.KongAdminURL == "" {
+			defaultTarget.Scope.EnvironmentIDs = append(defaultTarget.Scope.EnvironmentIDs, envID)
+			continue
+		}
+		targets = append(targets, driftTarget{
+			Client:        NewKongAdminClient(env.KongAdminURL, env.KongAdminToken),
+			Scope:         EnvironmentScope(envID),
+			EnvironmentID: &envID,
+		})
+	}
+	if defaultTarget.Client != nil {
+		targets = append([]driftTarget{defaultTarget}, targets...)
+	}
+	return targets, nil
+}
+
+// Start runs drift checks in the background every Interval
+func (d *DriftDetector) Start() {
+	go func() {
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := d.Check(); err != nil {
+				log.Printf("Drift check failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("Drift detector started (interval %s)", d.Interval)
+}
+
+// Check runs one drift check and returns the findings that are new since the last check.
+// Findings that are no longer observed are marked resolved.
+func (d *DriftDetector) Check() ([]models.DriftFinding, error) {
+	targets, err := d.targets()
+	if err != nil {
+		return nil, err
+	}
+
+	var observed []models.DriftFinding
+	for _, target := range targets {
+		findings, err := d.detect(target)
+		if err != nil {
+			return nil, err
+		}
+		observed = append(observed, findings...)
+	}
+
+	var open []models.DriftFinding
+	if err := database.DB.Where("resolved_at IS NULL").Find(&open).Error; err != nil {
+		return nil, fmt.Errorf("failed to load open drift findings: %w", err)
+	}
+	openByKey := make(map[string]models.DriftFinding, len(open))
+	for _, f := range open {
+		openByKey[driftKey(f)] = f
+	}
+
+	now := time.Now()
+	var created []models.DriftFinding
+	for _, f := range observed {
+		key := driftKey(f)
+		if existing, ok := openByKey[key]; ok {
+			delete(openByKey, key)
+			database.DB.Model(&existing).Updates(map[string]interface{}{
+				"last_seen_at":   now,
+				"changed_fields": f.ChangedFields,
+				"expected":       f.Expected,
+				"actual":         f.Actual,
+				"source_cr_id":   f.SourceCRID,
+			})
+			continue
+		}
+
+		f.DetectedAt = now
+		f.LastSeenAt = now
+		if err := database.DB.Create(&f).Error; err != nil {
+			return nil, fmt.Errorf("failed to record drift finding: %w", err)
+		}
+		created = append(created, f)
+	}
+
+	for _, f := range openByKey {
+		database.DB.Model(&f).Update("resolved_at", now)
+	}
+
+	if len(created) > 0 {
+		log.Printf("Drift detected: %d new finding(s)", len(created))
+		if d.Notify && d.Automation != nil {
+			d.Automation.NotifyDrift(created)
+		}
+	}
+
+	return created, nil
+}
+
+// detect builds the current list of findings of one gateway without persisting them
+func (d *DriftDetector) detect(target driftTarget) ([]models.DriftFinding, error) {
+	expected, err := BuildExpectedState(target.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expected state: %w", err)
+	}
+
+	var findings []models.DriftFinding
+	for _, name := range SortedServiceNames(expected) {
+		exp := expected[name]
+		desired, err := exp.Changes.DesiredState()
+		if err != nil {
+			log.Printf("Skipping service %s in drift check: %v", name, err)
+			continue
+		}
+		current, err := FetchServiceState(target.Client, name)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceCRID := exp.SourceCRID
+		for _, change := range DiffServiceState(current, desired) {
+			findings = append(findings, models.DriftFinding{
+				ServiceName:   name,
+				EnvironmentID: target.EnvironmentID,
+				ResourceType:  change.ResourceType,
+				ResourceName:  change.Name,
+				DriftType:     driftTypeFor(change.Action),
+				ChangedFields: strings.Join(change.ChangedFields, ","),
+				Expected:      jsonOrNil(change.After),
+				Actual:        jsonOrNil(change.Before),
+				SourceCRID:    &sourceCRID,
+			})
+		}
+	}
+
+	services, err := target.Client.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateway services: %w", err)
+	}
+	for _, svc := range services {
+		svc := svc
+		if _, managed := expected[svc.Name]; managed {
+			continue
+		}
+		findings = append(findings, models.DriftFinding{
+			ServiceName:   svc.Name,
+			EnvironmentID: target.EnvironmentID,
+			ResourceType:  ResourceService,
+			ResourceName:  svc.Name,
+			DriftType:     models.DriftTypeUnmanaged,
+			Actual:        jsonOrNil(&svc),
+		})
+	}
+
+	return findings, nil
+}
+
+// driftTypeFor maps the plan action that would fix the drift to the kind of drift
+func driftTypeFor(action PlanAction) models.DriftType {
+	switch action {
+	case PlanActionCreate:
+		return models.DriftTypeMissing
+	case PlanActionDelete:
+		return models.DriftTypeUnexpected
+	}
+	return models.DriftTypeModified
+}
+
+func driftKey(f models.DriftFinding) string {
+	env := ""
+	if f.EnvironmentID != nil {
+		env = fmt.Sprint(*f.EnvironmentID)
+	}
+	return strings.Join([]string{env, f.ServiceName, f.ResourceType, f.ResourceName, string(f.DriftType)}, "|")
+}
+
+func jsonOrNil(v interface{}) *string {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	s := string(data)
+	return &s
+}
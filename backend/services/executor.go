@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"alpaka/backend/models"
+)
+
+// ErrNoGateway is returned by executors when no gateway is configured for a CR
+var ErrNoGateway = errors.New("no gateway configured for change request")
+
+// Executor applies an approved change request to the gateway
+type Executor interface {
+	Execute(cr *models.ChangeRequest) (*ExecutionResult, error)
+}
+
+// ExecutionResult describes what an executor did to the gateway
+type ExecutionResult struct {
+	// Snapshot is the state of the touched Kong service before the change,
+	// used to build rollback change requests. Nil service means it did not exist.
+	Snapshot *ServiceState
+}
+
+// KongExecutor applies change requests through the Kong Admin API.
+// The payload is treated as the desired state of one Kong service: the executor
+// computes the same plan reviewers see and applies exactly those changes, so the
+// service and its routes are upserted, routes no longer in the payload are removed
+// and the rate-limiting plugin is enabled or removed.
+type KongExecutor struct {
+	Client KongClient
+
+	// ClientFor optionally picks the client per CR (e.g. by target environment)
+	ClientFor func(cr *models.ChangeRequest) (KongClient, error)
+}
+
+// NewKongExecutor creates a new Kong executor
+func NewKongExecutor(client KongClient) *KongExecutor {
+	return &KongExecutor{Client: client}
+}
+
+// Execute translates the CR payload into Kong Admin API calls.
+// The pre-change state is returned even if applying the plan fails halfway.
+func (e *KongExecutor) Execute(cr *models.ChangeRequest) (*ExecutionResult, error) {
+	if !IsKongServiceCR(cr) {
+		return nil, ErrUnsupportedCRType
+	}
+
+	client := e.Client
+	if e.ClientFor != nil {
+		var err error
+		if client, err = e.ClientFor(cr); err != nil {
+			return nil, err
+		}
+	}
+	if client == nil {
+		return nil, ErrNoGateway
+	}
+
+	changes, err := ParseConfigChanges(cr.ConfigChangesPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := FetchServiceState(client, changes.Service.Name)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExecutionResult{Snapshot: snapshot}
+
+	desired, err := changes.DesiredState()
+	if err != nil {
+		return result, err
+	}
+
+	plan := &Plan{
+		CRID:        cr.CRID,
+		ServiceName: changes.Service.Name,
+		Changes:     DiffServiceState(snapshot, desired),
+	}
+	return result, ApplyPlan(client, plan)
+}
+
+// ApplyPlan performs the changes of a plan in order: services, routes, then plugins
+func ApplyPlan(client KongClient, plan *Plan) error {
+	for _, change := range plan.Changes {
+		if err := applyChange(client, plan.ServiceName, change); err != nil {
+			return fmt.Errorf("failed to %s %s %s: %w", change.Action, change.ResourceType, change.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyChange(client KongClient, serviceName string, change PlanChange) error {
+	switch change.ResourceType {
+	case ResourceService:
+		if change.Action == PlanActionDelete {
+			return ignoreNotFound(client.DeleteService(change.Name))
+		}
+		_, err := client.UpsertService(*change.After.(*KongService))
+		return err
+
+	case ResourceRoute:
+		if change.Action == PlanActionDelete {
+			return ignoreNotFound(client.DeleteRoute(change.Name))
+		}
+		_, err := client.UpsertRoute(*change.After.(*KongRoute))
+		return err
+
+	case ResourcePlugin:
+		if change.Action == PlanActionDelete {
+			return ignoreNotFound(client.DeletePlugin(change.ID))
+		}
+		_, err := client.UpsertServicePlugin(serviceName, *change.After.(*KongPlugin))
+		return err
+	}
+
+	return fmt.Errorf("unknown resource type %q", change.ResourceType)
+}
+
+// ignoreNotFound treats deleting an already missing entity as success
+func ignoreNotFound(err error) error {
+	if errors.Is(err, ErrKongNotFound) {
+		return nil
+	}
+	return err
+}
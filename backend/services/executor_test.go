@@ -0,0 +1,233 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+)
+
+const testPayload = `{
+	"service": {"name": "orders", "url": "http://orders.internal:8080/api", "port": 8080},
+	"routes": [
+		{"name": "orders-read", "paths": "/orders, /v1/orders", "methods": ["GET"]},
+		{"name": "orders-write", "paths": ["/orders"], "methods": ["POST", "PUT"]}
+	],
+	"plugins": {"enable_rate_limit": true, "minute": 60}
+}`
+
+// createInProgressCR stores an approved CR that was started and is waiting to be applied
+func createInProgressCR(t *testing.T, payload string) *models.ChangeRequest {
+	hash, err := HashPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &models.ChangeRequest{
+		RequesterUserID:      1,
+		RequesterTeamID:      1,
+		Title:                "Expose orders",
+		ConfigChangesPayload: payload,
+		ApprovalStatus:       models.ApprovalStatusApproved,
+		ExecutionStatus:      models.ExecutionStatusInProgress,
+		Type:                 KongServiceCRType,
+		SchemaVersion:        1,
+		Revision:             1,
+		Version:              1,
+		ApprovedPayloadHash:  hash,
+	}
+	if err := database.DB.Create(cr).Error; err != nil {
+		t.Fatal(err)
+	}
+	return cr
+}
+
+func TestKongExecutorAppliesPayload(t *testing.T) {
+	kong := newFakeKong(t)
+	executor := NewKongExecutor(NewKongAdminClient(kong.URL, "secret"))
+
+	cr := &models.ChangeRequest{CRID: 7, ConfigChangesPayload: testPayload}
+	result, err := executor.Execute(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Snapshot == nil || result.Snapshot.Service != nil {
+		t.Errorf("snapshot = %+v, want the service to be absent before the change", result.Snapshot)
+	}
+
+	svc, ok := kong.services["orders"]
+	if !ok {
+		t.Fatal("service orders was not created")
+	}
+	if svc.Protocol != "http" || svc.Host != "orders.internal" || svc.Port != 8080 || svc.Path != "/api" {
+		t.Errorf("service = %+v", svc)
+	}
+	if len(kong.routes) != 2 {
+		t.Fatalf("routes = %+v, want 2", kong.routes)
+	}
+	read := kong.routes["orders-read"]
+	if strings.Join(read.Paths, ",") != "/orders,/v1/orders" || strings.Join(read.Methods, ",") != "GET" {
+		t.Errorf("route orders-read = %+v", read)
+	}
+	if read.Service == nil || read.Service.Name != "orders" {
+		t.Errorf("route orders-read is not attached to orders: %+v", read.Service)
+	}
+	if len(kong.plugins) != 1 {
+		t.Fatalf("plugins = %+v, want 1", kong.plugins)
+	}
+	for _, plugin := range kong.plugins {
+		if plugin.Name != RateLimitingPlugin || !plugin.Enabled || plugin.Config["minute"] != float64(60) {
+			t.Errorf("plugin = %+v", plugin)
+		}
+	}
+	for _, token := range kong.tokens {
+		if token != "secret" {
+			t.Fatalf("request sent with Kong-Admin-Token %q", token)
+		}
+	}
+
+	// Applying the same payload again changes nothing
+	kong.failOn(http.MethodPut, "/services/orders", http.StatusInternalServerError)
+	kong.failOn(http.MethodPut, "/routes/orders-read", http.StatusInternalServerError)
+	if _, err := executor.Execute(cr); err != nil {
+		t.Errorf("re-applying an applied payload: %v", err)
+	}
+}
+
+func TestKongExecutorRemovesRoutesMissingFromPayload(t *testing.T) {
+	kong := newFakeKong(t)
+	executor := NewKongExecutor(NewKongAdminClient(kong.URL, ""))
+
+	if _, err := executor.Execute(&models.ChangeRequest{ConfigChangesPayload: testPayload}); err != nil {
+		t.Fatal(err)
+	}
+	reduced := `{"service": {"name": "orders", "url": "http://orders.internal:8080/api", "port": 8080},
+		"routes": [{"name": "orders-read", "paths": ["/orders"]}],
+		"plugins": {"enable_rate_limit": false}}`
+	result, err := executor.Execute(&models.ChangeRequest{ConfigChangesPayload: reduced})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Snapshot.Routes) != 2 || len(result.Snapshot.Plugins) != 1 {
+		t.Errorf("snapshot = %+v, want the state before the change", result.Snapshot)
+	}
+	if _, ok := kong.routes["orders-write"]; ok || len(kong.routes) != 1 {
+		t.Errorf("routes = %+v, want only orders-read", kong.routes)
+	}
+	if len(kong.plugins) != 0 {
+		t.Errorf("plugins = %+v, want the rate limit removed", kong.plugins)
+	}
+}
+
+func TestApplyCRRecordsOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		failMethod string
+		failPath   string
+		failStatus int
+		wantStatus models.ExecutionStatus
+	}{
+		{name: "success", wantStatus: models.ExecutionStatusCompleted},
+		{name: "kong rejects a route", failMethod: http.MethodPut, failPath: "/routes/orders-write", failStatus: http.StatusBadRequest, wantStatus: models.ExecutionStatusFailed},
+		{name: "kong is down", failMethod: http.MethodGet, failPath: "/services/orders", failStatus: http.StatusServiceUnavailable, wantStatus: models.ExecutionStatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			kong := newFakeKong(t)
+			if tt.failStatus != 0 {
+				kong.failOn(tt.failMethod, tt.failPath, tt.failStatus)
+			}
+			automation := NewAutomationService(NewKongAdminClient(kong.URL, ""))
+			cr := createInProgressCR(t, testPayload)
+
+			err := automation.ApplyCR(cr.CRID)
+			if tt.failStatus == 0 && err != nil {
+				t.Fatal(err)
+			}
+			var kongErr *KongError
+			if tt.failStatus != 0 && (!errors.As(err, &kongErr) || kongErr.StatusCode != tt.failStatus) {
+				t.Fatalf("err = %v, want a Kong %d error", err, tt.failStatus)
+			}
+
+			var stored models.ChangeRequest
+			if err := database.DB.First(&stored, cr.CRID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.ExecutionStatus != tt.wantStatus {
+				t.Errorf("execution status = %s, want %s", stored.ExecutionStatus, tt.wantStatus)
+			}
+
+			var history []models.History
+			database.DB.Where("cr_id = ?", cr.CRID).Order("history_id").Find(&history)
+			if len(history) != 1 {
+				t.Fatalf("history = %+v, want one entry", history)
+			}
+			entry := history[0]
+			if entry.NewStatus != string(tt.wantStatus) || entry.OldStatus == nil || *entry.OldStatus != string(models.ExecutionStatusInProgress) {
+				t.Errorf("history entry %s -> %s", stringValue(entry.OldStatus), entry.NewStatus)
+			}
+			if entry.Hash == "" {
+				t.Error("history entry is not chained")
+			}
+			if tt.failStatus != 0 && !strings.Contains(stringValue(entry.Details), tt.failPath) {
+				t.Errorf("history details = %q, want the Kong error", stringValue(entry.Details))
+			}
+		})
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func TestRetryKeepsFirstSnapshot(t *testing.T) {
+	useTestDB(t)
+	kong := newFakeKong(t)
+	kong.services["orders"] = KongService{ID: "svc-1", Name: "orders", Protocol: "http", Host: "orders-v1.internal", Port: 80}
+	kong.routes["orders-legacy"] = KongRoute{ID: "route-1", Name: "orders-legacy", Paths: []string{"/legacy"}, Service: &KongRef{Name: "orders"}}
+	automation := NewAutomationService(NewKongAdminClient(kong.URL, ""))
+	cr := createInProgressCR(t, testPayload)
+
+	// The first attempt updates the service, then fails on a route
+	kong.failOn(http.MethodPut, "/routes/orders-write", http.StatusBadRequest)
+	if err := automation.ApplyCR(cr.CRID); err == nil {
+		t.Fatal("first attempt succeeded")
+	}
+	if kong.services["orders"].Host != "orders.internal" {
+		t.Fatalf("first attempt did not change the service: %+v", kong.services["orders"])
+	}
+
+	kong.recover(http.MethodPut, "/routes/orders-write")
+	if err := automation.ApplyCR(cr.CRID); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.ChangeRequest
+	if err := database.DB.First(&stored, cr.CRID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ExecutionStatus != models.ExecutionStatusCompleted {
+		t.Fatalf("execution status = %s", stored.ExecutionStatus)
+	}
+	if stored.PreChangeSnapshot == nil {
+		t.Fatal("no pre-change snapshot stored")
+	}
+	var snapshot ServiceState
+	if err := json.Unmarshal([]byte(*stored.PreChangeSnapshot), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Service == nil || snapshot.Service.Host != "orders-v1.internal" {
+		t.Errorf("snapshot service = %+v, want the state before the first attempt", snapshot.Service)
+	}
+	if len(snapshot.Routes) != 1 || snapshot.Routes[0].Name != "orders-legacy" {
+		t.Errorf("snapshot routes = %+v, want only orders-legacy", snapshot.Routes)
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// fakeKong is an in-memory Kong Admin API. Only the endpoints KongAdminClient
+// uses are served; entities are keyed by name, plugins by id.
+type fakeKong struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	services map[string]KongService
+	routes   map[string]KongRoute
+	plugins  map[string]KongPlugin
+	nextID   int
+	failures map[string]int // "METHOD /path" to the status code it fails with
+	tokens   []string       // Kong-Admin-Token of every request
+}
+
+// newFakeKong starts a fake Kong Admin API that is closed when the test ends
+func newFakeKong(t *testing.T) *fakeKong {
+	k := &fakeKong{
+		services: map[string]KongService{},
+		routes:   map[string]KongRoute{},
+		plugins:  map[string]KongPlugin{},
+		failures: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /services/{name}", k.getService)
+	mux.HandleFunc("PUT /services/{name}", k.putService)
+	mux.HandleFunc("DELETE /services/{name}", k.deleteService)
+	mux.HandleFunc("GET /services/{name}/routes", k.listRoutes)
+	mux.HandleFunc("GET /services/{name}/plugins", k.listPlugins)
+	mux.HandleFunc("POST /services/{name}/plugins", k.createPlugin)
+	mux.HandleFunc("PUT /routes/{name}", k.putRoute)
+	mux.HandleFunc("DELETE /routes/{name}", k.deleteRoute)
+	mux.HandleFunc("PATCH /plugins/{id}", k.patchPlugin)
+	mux.HandleFunc("DELETE /plugins/{id}", k.deletePlugin)
+
+	k.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		k.tokens = append(k.tokens, r.Header.Get("Kong-Admin-Token"))
+		if status, ok := k.failures[r.Method+" "+r.URL.Path]; ok {
+			writeKongJSON(w, status, map[string]string{"message": fmt.Sprintf("fake kong: %s %s refused", r.Method, r.URL.Path)})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(k.Close)
+	return k
+}
+
+// failOn makes requests to a method and path fail with a status code
+func (k *fakeKong) failOn(method, path string, status int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.failures[method+" "+path] = status
+}
+
+// recover stops failing requests to a method and path
+func (k *fakeKong) recover(method, path string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.failures, method+" "+path)
+}
+
+func (k *fakeKong) newID() string {
+	k.nextID++
+	return fmt.Sprintf("id-%d", k.nextID)
+}
+
+func writeKongJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (k *fakeKong) notFound(w http.ResponseWriter) {
+	writeKongJSON(w, http.StatusNotFound, map[string]string{"message": "Not found"})
+}
+
+func (k *fakeKong) getService(w http.ResponseWriter, r *http.Request) {
+	svc, ok := k.services[r.PathValue("name")]
+	if !ok {
+		k.notFound(w)
+		return
+	}
+	writeKongJSON(w, http.StatusOK, svc)
+}
+
+func (k *fakeKong) putService(w http.ResponseWriter, r *http.Request) {
+	var svc KongService
+	if err := json.NewDecoder(r.Body).Decode(&svc); err != nil {
+		writeKongJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	svc.Name = r.PathValue("name")
+	svc.ID = k.services[svc.Name].ID
+	if svc.ID == "" {
+		svc.ID = k.newID()
+	}
+	k.services[svc.Name] = svc
+	writeKongJSON(w, http.StatusOK, svc)
+}
+
+func (k *fakeKong) deleteService(w http.ResponseWriter, r *http.Request) {
+	if _, ok := k.services[r.PathValue("name")]; !ok {
+		k.notFound(w)
+		return
+	}
+	delete(k.services, r.PathValue("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (k *fakeKong) listRoutes(w http.ResponseWriter, r *http.Request) {
+	page := kongList[KongRoute]{Data: []KongRoute{}}
+	for _, route := range k.routes {
+		if route.Service != nil && route.Service.Name == r.PathValue("name") {
+			page.Data = append(page.Data, route)
+		}
+	}
+	sort.Slice(page.Data, func(i, j int) bool { return page.Data[i].Name < page.Data[j].Name })
+	writeKongJSON(w, http.StatusOK, page)
+}
+
+func (k *fakeKong) putRoute(w http.ResponseWriter, r *http.Request) {
+	var route KongRoute
+	if err := json.NewDecoder(r.Body).Decode(&route); err != nil {
+		writeKongJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	route.Name = r.PathValue("name")
+	route.ID = k.routes[route.Name].ID
+	if route.ID == "" {
+		route.ID = k.newID()
+	}
+	k.routes[route.Name] = route
+	writeKongJSON(w, http.StatusOK, route)
+}
+
+func (k *fakeKong) deleteRoute(w http.ResponseWriter, r *http.Request) {
+	if _, ok := k.routes[r.PathValue("name")]; !ok {
+		k.notFound(w)
+		return
+	}
+	delete(k.routes, r.PathValue("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (k *fakeKong) listPlugins(w http.ResponseWriter, r *http.Request) {
+	page := kongList[KongPlugin]{Data: []KongPlugin{}}
+	for _, plugin := range k.plugins {
+		if plugin.Service != nil && plugin.Service.Name == r.PathValue("name") {
+			page.Data = append(page.Data, plugin)
+		}
+	}
+	writeKongJSON(w, http.StatusOK, page)
+}
+
+func (k *fakeKong) createPlugin(w http.ResponseWriter, r *http.Request) {
+	var plugin KongPlugin
+	if err := json.NewDecoder(r.Body).Decode(&plugin); err != nil {
+		writeKongJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	plugin.ID = k.newID()
+	plugin.Service = &KongRef{Name: r.PathValue("name")}
+	k.plugins[plugin.ID] = plugin
+	writeKongJSON(w, http.StatusCreated, plugin)
+}
+
+func (k *fakeKong) patchPlugin(w http.ResponseWriter, r *http.Request) {
+	plugin, ok := k.plugins[r.PathValue("id")]
+	if !ok {
+		k.notFound(w)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&plugin); err != nil {
+		writeKongJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	k.plugins[plugin.ID] = plugin
+	writeKongJSON(w, http.StatusOK, plugin)
+}
+
+func (k *fakeKong) deletePlugin(w http.ResponseWriter, r *http.Request) {
+	if _, ok := k.plugins[r.PathValue("id")]; !ok {
+		k.notFound(w)
+		return
+	}
+	delete(k.plugins, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
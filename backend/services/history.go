@@ -0,0 +1,269 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// historyChainID is the primary key of the only HistoryChainHead row
+const historyChainID = 1
+
+// maxUserAgent is the length of the user_agent column
+const maxUserAgent = 255
+
+// ErrHistoryChainMissing is returned when writing history before InitHistoryChain
+var ErrHistoryChainMissing = errors.New("history chain is not initialized")
+
+// NewHistory returns a history entry of an action by the actor. details may be empty.
+func (a Actor) NewHistory(crID uint, eventType, oldStatus, newStatus, details string) models.History {
+	history := models.History{
+		CRID:                      crID,
+		ChangedByUserID:           a.UserID,
+		ChangedByServiceAccountID: a.ServiceAccountID,
+		EventType:                 eventType,
+		OldStatus:                 &oldStatus,
+		NewStatus:                 newStatus,
+		IPAddress:                 a.IPAddress,
+		UserAgent:                 a.UserAgent,
+	}
+	if details != "" {
+		history.Details = &details
+	}
+	return history
+}
+
+// RecordHistory appends an entry to the hash chain of its CR and to the chain
+// over all entries. Every history entry must be written through it. db may be
+// a transaction; the chain head stays locked until it ends.
+func RecordHistory(db *gorm.DB, entry *models.History) error {
+	if len(entry.UserAgent) > maxUserAgent {
+		entry.UserAgent = entry.UserAgent[:maxUserAgent]
+	}
+	// The column has no fractional seconds; hash what is stored
+	entry.Timestamp = time.Now().Truncate(time.Second)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var head models.HistoryChainHead
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, "chain_id = ?", historyChainID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrHistoryChainMissing
+			}
+			return fmt.Errorf("failed to lock history chain: %w", err)
+		}
+
+		prevHash, err := lastCRHash(tx, entry.CRID)
+		if err != nil {
+			return err
+		}
+		entry.PrevHash = prevHash
+		entry.PrevGlobalHash = head.LastHash
+		entry.Hash = HashHistory(entry)
+
+		if err := tx.Create(entry).Error; err != nil {
+			return fmt.Errorf("failed to create history: %w", err)
+		}
+		return advanceChainHead(tx, entry)
+	})
+}
+
+// HashHistory returns the SHA-256 of an entry's content and previous hashes
+func HashHistory(entry *models.History) string {
+	content := struct {
+		CRID             uint    `json:"cr_id"`
+		ChangedByUserID  uint    `json:"changed_by_user_id"`
+		ServiceAccountID *uint   `json:"changed_by_service_account_id"`
+		EventType        string  `json:"event_type"`
+		OldStatus        *string `json:"old_status"`
+		NewStatus        string  `json:"new_status"`
+		Details          *string `json:"details"`
+		IPAddress        string  `json:"ip_address"`
+		UserAgent        string  `json:"user_agent"`
+		Timestamp        int64   `json:"timestamp"`
+		PrevHash         string  `json:"prev_hash"`
+		PrevGlobalHash   string  `json:"prev_global_hash"`
+	}{
+		CRID:             entry.CRID,
+		ChangedByUserID:  entry.ChangedByUserID,
+		ServiceAccountID: entry.ChangedByServiceAccountID,
+		EventType:        entry.EventType,
+		OldStatus:        entry.OldStatus,
+		NewStatus:        entry.NewStatus,
+		Details:          entry.Details,
+		IPAddress:        entry.IPAddress,
+		UserAgent:        entry.UserAgent,
+		Timestamp:        entry.Timestamp.Unix(),
+		PrevHash:         entry.PrevHash,
+		PrevGlobalHash:   entry.PrevGlobalHash,
+	}
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func lastCRHash(tx *gorm.DB, crID uint) (string, error) {
+	var last models.History
+	err := tx.Select("hash").Where("cr_id = ?", crID).Order("history_id DESC").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load history: %w", err)
+	}
+	return last.Hash, nil
+}
+
+func advanceChainHead(tx *gorm.DB, entry *models.History) error {
+	err := tx.Model(&models.HistoryChainHead{}).Where("chain_id = ?", historyChainID).Updates(map[string]interface{}{
+		"last_history_id": entry.HistoryID,
+		"last_hash":       entry.Hash,
+		"updated_at":      time.Now(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to advance history chain: %w", err)
+	}
+	return nil
+}
+
+// InitHistoryChain creates the chain head. The first time, entries written
+// before history was chained are sealed into the chain in their current state.
+func InitHistoryChain() error {
+	var sealed int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		head := models.HistoryChainHead{ChainID: historyChainID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&head)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create history chain: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		lastByCR := map[uint]string{}
+		var entries []models.History
+		return tx.Order("history_id ASC").FindInBatches(&entries, 500, func(batch *gorm.DB, _ int) error {
+			for i := range entries {
+				entry := &entries[i]
+				entry.PrevHash = lastByCR[entry.CRID]
+				entry.PrevGlobalHash = head.LastHash
+				entry.Hash = HashHistory(entry)
+				if err := tx.Model(entry).Updates(map[string]interface{}{
+					"prev_hash":        entry.PrevHash,
+					"prev_global_hash": entry.PrevGlobalHash,
+					"hash":             entry.Hash,
+				}).Error; err != nil {
+					return fmt.Errorf("failed to seal history entry %d: %w", entry.HistoryID, err)
+				}
+				lastByCR[entry.CRID] = entry.Hash
+				head.LastHash = entry.Hash
+				sealed++
+			}
+			if len(entries) > 0 {
+				return advanceChainHead(tx, &entries[len(entries)-1])
+			}
+			return nil
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if sealed > 0 {
+		log.Printf("Sealed %d existing history entries into the hash chain", sealed)
+	}
+	return nil
+}
+
+// HistoryBreak is the first entry that does not fit the hash chain
+type HistoryBreak struct {
+	HistoryID uint   `json:"history_id,omitempty"` // 0 when entries at the end were removed
+	CRID      uint   `json:"cr_id,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// HistoryVerification is the result of walking a hash chain
+type HistoryVerification struct {
+	Valid       bool          `json:"valid"`
+	CRID        *uint         `json:"cr_id,omitempty"` // Nil when all history was verified
+	Entries     int           `json:"entries"`
+	LastHash    string        `json:"last_hash"` // Record it elsewhere to detect rewrites of the whole chain later
+	FirstBroken *HistoryBreak `json:"first_broken,omitempty"`
+	VerifiedAt  time.Time     `json:"verified_at"`
+}
+
+// VerifyHistory walks the hash chain of one CR, or of all history when crID is
+// nil, and reports the first entry that was changed, inserted or removed.
+// Only the walk over all history detects removed entries at the end of the chain.
+func VerifyHistory(db *gorm.DB, crID *uint) (*HistoryVerification, error) {
+	result := &HistoryVerification{Valid: true, CRID: crID, VerifiedAt: time.Now()}
+
+	query := db.Order("history_id ASC")
+	if crID != nil {
+		query = query.Where("cr_id = ?", *crID)
+	}
+
+	lastByCR := map[uint]string{}
+	lastGlobal := ""
+	var entries []models.History
+	err := query.FindInBatches(&entries, 500, func(batch *gorm.DB, _ int) error {
+		for i := range entries {
+			entry := &entries[i]
+			if reason := checkHistoryEntry(entry, lastByCR[entry.CRID], lastGlobal, crID == nil); reason != "" {
+				result.fail(&HistoryBreak{HistoryID: entry.HistoryID, CRID: entry.CRID, Reason: reason})
+				return errStopWalk
+			}
+			lastByCR[entry.CRID] = entry.Hash
+			lastGlobal = entry.Hash
+			result.Entries++
+			result.LastHash = entry.Hash
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+	if !result.Valid || crID != nil {
+		return result, nil
+	}
+
+	var head models.HistoryChainHead
+	if err := db.First(&head, "chain_id = ?", historyChainID).Error; err != nil {
+		return nil, ErrHistoryChainMissing
+	}
+	if head.LastHash != lastGlobal {
+		result.fail(&HistoryBreak{Reason: fmt.Sprintf("chain head expects entry %d as the last one; entries at the end were removed", head.LastHistoryID)})
+	}
+	return result, nil
+}
+
+// errStopWalk ends a batch walk at the first break
+var errStopWalk = errors.New("stop")
+
+func (v *HistoryVerification) fail(b *HistoryBreak) {
+	v.Valid = false
+	v.FirstBroken = b
+}
+
+// checkHistoryEntry returns why an entry breaks the chain, or ""
+func checkHistoryEntry(entry *models.History, prevHash, prevGlobalHash string, global bool) string {
+	switch {
+	case entry.Hash == "":
+		return "entry has no hash"
+	case HashHistory(entry) != entry.Hash:
+		return "content does not match the hash; the entry was changed"
+	case entry.PrevHash != prevHash:
+		return "previous hash of the CR does not match; an earlier entry of the CR was removed or changed"
+	case global && entry.PrevGlobalHash != prevGlobalHash:
+		return "previous hash does not match; an earlier entry was removed or changed"
+	}
+	return ""
+}
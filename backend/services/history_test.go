@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+func TestVerifyHistoryDetectsTampering(t *testing.T) {
+	crOne, crTwo := uint(1), uint(2)
+
+	tests := []struct {
+		name       string
+		tamper     func(db *gorm.DB) error
+		crID       *uint
+		wantValid  bool
+		wantBroken uint // HistoryID of the first broken entry, 0 for removed entries at the end
+	}{
+		{name: "untouched", wantValid: true},
+		{name: "untouched CR", crID: &crOne, wantValid: true},
+		{
+			name: "edited entry",
+			tamper: func(db *gorm.DB) error {
+				return db.Model(&models.History{}).Where("history_id = ?", 3).Update("new_status", "COMPLETED").Error
+			},
+			wantBroken: 3,
+		},
+		{
+			name: "edited entry of the CR",
+			tamper: func(db *gorm.DB) error {
+				return db.Model(&models.History{}).Where("history_id = ?", 3).Update("details", "approved by someone else").Error
+			},
+			crID:       &crOne,
+			wantBroken: 3,
+		},
+		{
+			name:       "deleted entry",
+			tamper:     func(db *gorm.DB) error { return db.Delete(&models.History{}, 3).Error },
+			wantBroken: 4,
+		},
+		{
+			name:       "deleted entry of the CR",
+			tamper:     func(db *gorm.DB) error { return db.Delete(&models.History{}, 3).Error },
+			crID:       &crOne,
+			wantBroken: 5,
+		},
+		{
+			name:       "deleted last entry",
+			tamper:     func(db *gorm.DB) error { return db.Delete(&models.History{}, 5).Error },
+			wantBroken: 0,
+		},
+		{
+			name: "rehashed entry",
+			tamper: func(db *gorm.DB) error {
+				var entry models.History
+				if err := db.First(&entry, 2).Error; err != nil {
+					return err
+				}
+				entry.NewStatus = "REJECTED"
+				return db.Model(&entry).Updates(map[string]interface{}{"new_status": entry.NewStatus, "hash": HashHistory(&entry)}).Error
+			},
+			crID:       &crTwo,
+			wantBroken: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			// Entries 1, 3 and 5 belong to CR 1, entries 2 and 4 to CR 2
+			for i, crID := range []uint{crOne, crTwo, crOne, crTwo, crOne} {
+				entry := SystemActor().NewHistory(crID, "STATUS_CHANGE", "DRAFT", "IN_PROGRESS", "")
+				if i == 2 {
+					entry = Actor{UserID: 2}.NewHistory(crID, "REVIEW_ADDED", "PENDING", "PENDING", "looks good")
+				}
+				if err := RecordHistory(db, &entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tamper != nil {
+				if err := tt.tamper(db); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := VerifyHistory(db, tt.crID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Fatalf("valid = %v, want %v (first broken %+v)", result.Valid, tt.wantValid, result.FirstBroken)
+			}
+			if tt.wantValid {
+				return
+			}
+			if result.FirstBroken == nil || result.FirstBroken.HistoryID != tt.wantBroken {
+				t.Errorf("first broken = %+v, want entry %d", result.FirstBroken, tt.wantBroken)
+			}
+		})
+	}
+}
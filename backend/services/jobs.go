@@ -0,0 +1,325 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Job kinds
+const (
+	JobProcessCR       = "process_cr"       // Start an approved CR
+	JobApplyCR         = "apply_cr"         // Apply an IN_PROGRESS CR to the gateway
+	JobWebhookDelivery = "webhook_delivery" // Send a webhook delivery to its subscription
+)
+
+var (
+	// ErrJobNotFound is returned when a job does not exist
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotRetryable is returned when retrying a job that is not DEAD
+	ErrJobNotRetryable = errors.New("only dead jobs can be retried")
+)
+
+// JobHandler runs one attempt of a job. A returned error schedules a retry.
+type JobHandler func(job *models.Job) error
+
+// EnqueueJob stores a job for the workers. Pass a transaction as db to enqueue
+// the job atomically with the change that requires it.
+func EnqueueJob(db *gorm.DB, kind string, crID *uint, payload interface{}) (*models.Job, error) {
+	job := models.Job{
+		Kind:   kind,
+		CRID:   crID,
+		Status: models.JobStatusPending,
+		RunAt:  time.Now(),
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode job payload: %w", err)
+		}
+		encoded := string(data)
+		job.Payload = &encoded
+	}
+
+	if err := db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+	return &job, nil
+}
+
+// JobQueue runs jobs stored in the jobs table with a pool of workers.
+// Several instances may share the table; jobs are claimed optimistically.
+type JobQueue struct {
+	Workers      int
+	PollInterval time.Duration
+	MaxAttempts  int
+	Backoff      time.Duration // Delay before the first retry, doubled on every further attempt
+	Lease        time.Duration // RUNNING jobs not renewed for this long are run again
+
+	handlers map[string]JobHandler
+	name     string
+}
+
+// NewJobQueue creates a new job queue
+func NewJobQueue(workers int, pollInterval time.Duration, maxAttempts int, backoff, lease time.Duration) *JobQueue {
+	host, _ := os.Hostname()
+	return &JobQueue{
+		Workers:      workers,
+		PollInterval: pollInterval,
+		MaxAttempts:  maxAttempts,
+		Backoff:      backoff,
+		Lease:        lease,
+		handlers:     map[string]JobHandler{},
+		name:         fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Handle registers the handler of a job kind
+func (q *JobQueue) Handle(kind string, handler JobHandler) {
+	q.handlers[kind] = handler
+}
+
+// Start runs the workers in the background
+func (q *JobQueue) Start() {
+	for i := 0; i < q.Workers; i++ {
+		worker := fmt.Sprintf("%s/%d", q.name, i)
+		go func() {
+			ticker := time.NewTicker(q.PollInterval)
+			defer ticker.Stop()
+			for {
+				// Drain ready jobs before waiting for the next tick
+				for q.runNext(worker) {
+				}
+				<-ticker.C
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(q.Lease)
+		defer ticker.Stop()
+		for {
+			if n, err := q.RequeueExpired(); err != nil {
+				log.Printf("Job queue: failed to requeue expired jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("Job queue: requeued %d jobs of lost workers", n)
+			}
+			<-ticker.C
+		}
+	}()
+
+	log.Printf("Job queue started (%d workers)", q.Workers)
+}
+
+// runNext claims and runs one ready job. It reports whether a job was run.
+func (q *JobQueue) runNext(worker string) bool {
+	job, err := q.claim(worker)
+	if err != nil {
+		log.Printf("Job queue: failed to claim job: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	q.run(job)
+	return true
+}
+
+// claim picks the oldest ready job and marks it RUNNING. The status check in
+// the update makes sure only one worker wins a job.
+func (q *JobQueue) claim(worker string) (*models.Job, error) {
+	for {
+		var job models.Job
+		err := database.DB.
+			Where("status = ? AND run_at <= ?", models.JobStatusPending, time.Now()).
+			Order("run_at ASC").Order("job_id ASC").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		result := database.DB.Model(&models.Job{}).
+			Where("job_id = ? AND status = ?", job.JobID, models.JobStatusPending).
+			Updates(map[string]interface{}{
+				"status":    models.JobStatusRunning,
+				"locked_by": worker,
+				"locked_at": now,
+				"attempts":  gorm.Expr("attempts + 1"),
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			job.Status = models.JobStatusRunning
+			job.LockedBy = worker
+			job.LockedAt = &now
+			job.Attempts++
+			return &job, nil
+		}
+		// Another worker claimed it first
+	}
+}
+
+// run runs a claimed job and records the outcome
+func (q *JobQueue) run(job *models.Job) {
+	var err error
+	if handler, ok := q.handlers[job.Kind]; ok {
+		stop := q.heartbeat(job)
+		err = runHandler(handler, job)
+		stop()
+	} else {
+		err = fmt.Errorf("no handler for job kind %s", job.Kind)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"locked_by": "",
+		"locked_at": nil,
+	}
+	switch {
+	case err == nil:
+		updates["status"] = models.JobStatusSucceeded
+		updates["completed_at"] = now
+		updates["last_error"] = nil
+	case job.Attempts >= q.MaxAttempts:
+		updates["status"] = models.JobStatusDead
+		updates["last_error"] = err.Error()
+		log.Printf("Job queue: %s job %d is dead after %d attempts: %v", job.Kind, job.JobID, job.Attempts, err)
+	default:
+		updates["status"] = models.JobStatusPending
+		updates["run_at"] = now.Add(q.backoff(job.Attempts))
+		updates["last_error"] = err.Error()
+		log.Printf("Job queue: %s job %d failed (attempt %d): %v", job.Kind, job.JobID, job.Attempts, err)
+	}
+
+	// Once the lease expired the job may have been requeued and claimed by
+	// another worker, whose outcome must not be overwritten
+	result := database.DB.Model(job).
+		Where("status = ? AND locked_by = ?", models.JobStatusRunning, job.LockedBy).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("Job queue: failed to record outcome of job %d: %v", job.JobID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("Job queue: lost the lease of %s job %d; its outcome was discarded", job.Kind, job.JobID)
+	}
+}
+
+// heartbeat renews the lease of a running job until the returned function is
+// called, so jobs that run longer than the lease are not run twice at once
+func (q *JobQueue) heartbeat(job *models.Job) (stop func()) {
+	if q.Lease <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(q.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			result := database.DB.Model(&models.Job{}).
+				Where("job_id = ? AND status = ? AND locked_by = ?", job.JobID, models.JobStatusRunning, job.LockedBy).
+				Update("locked_at", time.Now())
+			if result.Error != nil {
+				log.Printf("Job queue: failed to renew the lease of job %d: %v", job.JobID, result.Error)
+				continue
+			}
+			if result.RowsAffected == 0 {
+				log.Printf("Job queue: lost the lease of %s job %d while running it", job.Kind, job.JobID)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// runHandler runs a handler, turning a panic into a failed attempt
+func runHandler(handler JobHandler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(job)
+}
+
+// backoff returns the delay before the attempt after the given one
+func (q *JobQueue) backoff(attempts int) time.Duration {
+	delay := q.Backoff
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// RequeueExpired returns RUNNING jobs whose lease has expired to PENDING,
+// e.g. after the process running them crashed
+func (q *JobQueue) RequeueExpired() (int64, error) {
+	result := database.DB.Model(&models.Job{}).
+		Where("status = ? AND locked_at < ?", models.JobStatusRunning, time.Now().Add(-q.Lease)).
+		Updates(map[string]interface{}{
+			"status":    models.JobStatusPending,
+			"run_at":    time.Now(),
+			"locked_by": "",
+			"locked_at": nil,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// RetryJob gives a DEAD job a fresh set of attempts
+func RetryJob(jobID uint) (*models.Job, error) {
+	var job models.Job
+	if err := database.DB.First(&job, "job_id = ?", jobID).Error; err != nil {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != models.JobStatusDead {
+		return nil, ErrJobNotRetryable
+	}
+
+	result := database.DB.Model(&job).
+		Where("status = ?", models.JobStatusDead).
+		Updates(map[string]interface{}{
+			"status":   models.JobStatusPending,
+			"run_at":   time.Now(),
+			"attempts": 0,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to retry job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrJobNotRetryable
+	}
+
+	database.DB.First(&job, "job_id = ?", jobID)
+	return &job, nil
+}
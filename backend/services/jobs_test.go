@@ -0,0 +1,76 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+)
+
+func TestJobOutcomeNeedsLease(t *testing.T) {
+	useTestDB(t)
+	q := NewJobQueue(1, time.Second, 3, time.Minute, time.Minute)
+	q.Handle("test", func(job *models.Job) error {
+		if job.LockedBy == "slow" {
+			return errors.New("finished after its lease expired")
+		}
+		return nil
+	})
+
+	queued, err := EnqueueJob(database.DB, "test", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, err := q.claim("slow")
+	if err != nil || slow == nil {
+		t.Fatalf("claim = %v, %v", slow, err)
+	}
+
+	// The lease of the slow worker expires and another worker runs the job
+	q.Lease = -time.Second
+	if n, err := q.RequeueExpired(); err != nil || n != 1 {
+		t.Fatalf("requeued %d jobs: %v", n, err)
+	}
+	if !q.runNext("fast") {
+		t.Fatal("requeued job was not run")
+	}
+
+	q.run(slow)
+
+	var job models.Job
+	if err := database.DB.First(&job, queued.JobID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.JobStatusSucceeded || job.LastError != nil {
+		t.Errorf("job status = %s, last error = %v; want the outcome of the worker holding the lease", job.Status, job.LastError)
+	}
+}
+
+func TestRunningJobKeepsLease(t *testing.T) {
+	useTestDB(t)
+	q := NewJobQueue(1, time.Second, 3, time.Minute, 150*time.Millisecond)
+	started := make(chan struct{})
+	q.Handle("test", func(job *models.Job) error {
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+		return nil
+	})
+	if _, err := EnqueueJob(database.DB, "test", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan bool)
+	go func() { done <- q.runNext("slow") }()
+	<-started
+
+	// Well past the lease the job is still being renewed
+	time.Sleep(350 * time.Millisecond)
+	if n, err := q.RequeueExpired(); err != nil || n != 0 {
+		t.Errorf("requeued %d running jobs: %v", n, err)
+	}
+	if !<-done {
+		t.Fatal("job was not run")
+	}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RateLimitingPlugin is the Kong plugin enabled by the "plugins" payload section
+const RateLimitingPlugin = "rate-limiting"
+
+// ErrKongNotFound is returned when the requested Kong entity does not exist
+var ErrKongNotFound = errors.New("kong entity not found")
+
+// KongError is a non-2xx response from the Kong Admin API
+type KongError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *KongError) Error() string {
+	return fmt.Sprintf("kong admin api %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// KongRef references another Kong entity by id or name
+type KongRef struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// KongService is a Kong service entity
+type KongService struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Path     string `json:"path,omitempty"`
+}
+
+// KongRoute is a Kong route entity
+type KongRoute struct {
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name"`
+	Paths   []string `json:"paths"`
+	Methods []string `json:"methods"`
+	Service *KongRef `json:"service,omitempty"`
+}
+
+// KongPlugin is a Kong plugin entity
+type KongPlugin struct {
+	ID      string                 `json:"id,omitempty"`
+	Name    string                 `json:"name"`
+	Enabled bool                   `json:"enabled"`
+	Config  map[string]interface{} `json:"config,omitempty"`
+	Service *KongRef               `json:"service,omitempty"`
+}
+
+// KongClient is the subset of the Kong Admin API used by the executor.
+// It is an interface so the executor can be pointed at a fake gateway.
+type KongClient interface {
+	ListServices() ([]KongService, error)
+	GetService(name string) (*KongService, error)
+	UpsertService(svc KongService) (*KongService, error)
+	DeleteService(name string) error
+
+	ListServiceRoutes(serviceName string) ([]KongRoute, error)
+	UpsertRoute(route KongRoute) (*KongRoute, error)
+	DeleteRoute(name string) error
+
+	ListServicePlugins(serviceName string) ([]KongPlugin, error)
+	UpsertServicePlugin(serviceName string, plugin KongPlugin) (*KongPlugin, error)
+	DeletePlugin(id string) error
+}
+
+// KongAdminClient talks to a Kong Admin API over HTTP
+type KongAdminClient struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewKongAdminClient creates a new Kong Admin API client
+func NewKongAdminClient(baseURL, token string) *KongAdminClient {
+	return &KongAdminClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// kongList is the paginated list envelope returned by the Admin API
+type kongList[T any] struct {
+	Data []T    `json:"data"`
+	Next string `json:"next"`
+}
+
+// ListServices lists every service on the gateway
+func (k *KongAdminClient) ListServices() ([]KongService, error) {
+	return listAll[KongService](k, "/services")
+}
+
+// GetService fetches a service by name, returning ErrKongNotFound if absent
+func (k *KongAdminClient) GetService(name string) (*KongService, error) {
+	var svc KongService
+	if err := k.do(http.MethodGet, "/services/"+url.PathEscape(name), nil, &svc); err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// UpsertService creates or replaces a service by name
+func (k *KongAdminClient) UpsertService(svc KongService) (*KongService, error) {
+	body := map[string]interface{}{
+		"protocol": svc.Protocol,
+		"host":     svc.Host,
+		"port":     svc.Port,
+	}
+	if svc.Path != "" {
+		body["path"] = svc.Path
+	}
+
+	var result KongService
+	if err := k.do(http.MethodPut, "/services/"+url.PathEscape(svc.Name), body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteService deletes a service by name
+func (k *KongAdminClient) DeleteService(name string) error {
+	return k.do(http.MethodDelete, "/services/"+url.PathEscape(name), nil, nil)
+}
+
+// ListServiceRoutes lists all routes attached to a service
+func (k *KongAdminClient) ListServiceRoutes(serviceName string) ([]KongRoute, error) {
+	return listAll[KongRoute](k, "/services/"+url.PathEscape(serviceName)+"/routes")
+}
+
+// UpsertRoute creates or replaces a route by name
+func (k *KongAdminClient) UpsertRoute(route KongRoute) (*KongRoute, error) {
+	body := map[string]interface{}{
+		"paths":   route.Paths,
+		"methods": route.Methods,
+	}
+	if route.Service != nil {
+		body["service"] = map[string]string{"name": route.Service.Name}
+	}
+
+	var result KongRoute
+	if err := k.do(http.MethodPut, "/routes/"+url.PathEscape(route.Name), body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteRoute deletes a route by name
+func (k *KongAdminClient) DeleteRoute(name string) error {
+	return k.do(http.MethodDelete, "/routes/"+url.PathEscape(name), nil, nil)
+}
+
+// ListServicePlugins lists all plugins attached to a service
+func (k *KongAdminClient) ListServicePlugins(serviceName string) ([]KongPlugin, error) {
+	return listAll[KongPlugin](k, "/services/"+url.PathEscape(serviceName)+"/plugins")
+}
+
+// UpsertServicePlugin enables a plugin on a service, updating the existing
+// instance of the same plugin if there is one
+func (k *KongAdminClient) UpsertServicePlugin(serviceName string, plugin KongPlugin) (*KongPlugin, error) {
+	existing, err := k.ListServicePlugins(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"name":    plugin.Name,
+		"enabled": plugin.Enabled,
+		"config":  plugin.Config,
+	}
+
+	var result KongPlugin
+	for _, p := range existing {
+		if p.Name == plugin.Name {
+			if err := k.do(http.MethodPatch, "/plugins/"+url.PathEscape(p.ID), body, &result); err != nil {
+				return nil, err
+			}
+			return &result, nil
+		}
+	}
+
+	if err := k.do(http.MethodPost, "/services/"+url.PathEscape(serviceName)+"/plugins", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeletePlugin deletes a plugin by id
+func (k *KongAdminClient) DeletePlugin(id string) error {
+	return k.do(http.MethodDelete, "/plugins/"+url.PathEscape(id), nil, nil)
+}
+
+// listAll follows the Admin API "next" links and returns every entity
+func listAll[T any](k *KongAdminClient, path string) ([]T, error) {
+	var all []T
+	for path != "" {
+		var page kongList[T]
+		if err := k.do(http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Data...)
+		path = page.Next
+	}
+	return all, nil
+}
+
+// do performs a request against the Admin API and decodes the JSON response into out
+func (k *KongAdminClient) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode kong request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	// "next" links are returned as absolute paths including the query string
+	req, err := http.NewRequest(method, k.BaseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build kong request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if k.Token != "" {
+		req.Header.Set("Kong-Admin-Token", k.Token)
+	}
+
+	resp, err := k.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kong admin api %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrKongNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var kongErr struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &kongErr) == nil && kongErr.Message != "" {
+			message = kongErr.Message
+		}
+		return &KongError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode kong response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned for an unknown username or a wrong password
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ldapProvider names LDAP identities in user_identities
+const ldapProvider = "ldap"
+
+// LDAPSyncChange is one membership or role added or removed by a sync
+type LDAPSyncChange struct {
+	Username string `json:"username"`
+	Team     string `json:"team,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// LDAPSyncReport lists what a sync changed
+type LDAPSyncReport struct {
+	StartedAt          time.Time        `json:"started_at"`
+	FinishedAt         time.Time        `json:"finished_at"`
+	UsersProvisioned   []string         `json:"users_provisioned"`
+	TeamsCreated       []string         `json:"teams_created"`
+	MembershipsAdded   []LDAPSyncChange `json:"memberships_added"`
+	MembershipsRemoved []LDAPSyncChange `json:"memberships_removed"`
+	RolesGranted       []LDAPSyncChange `json:"roles_granted"`
+	RolesRevoked       []LDAPSyncChange `json:"roles_revoked"`
+	Skipped            []string         `json:"skipped"` // Member DNs that could not be provisioned, with the reason
+	Error              string           `json:"error,omitempty"`
+}
+
+// ldapGroup is a directory group with the lowercased DNs of its members
+type ldapGroup struct {
+	Name    string
+	Members []string
+}
+
+// LDAPDirectory authenticates users against an LDAP directory and mirrors its
+// groups into teams and roles. Only users linked to the directory are changed
+// by a sync; local accounts keep their teams and roles.
+type LDAPDirectory struct {
+	Config   config.LDAPConfig
+	Interval time.Duration
+
+	mu         sync.Mutex
+	lastReport *LDAPSyncReport
+}
+
+// NewLDAPDirectory creates a new LDAP directory
+func NewLDAPDirectory(cfg config.LDAPConfig) *LDAPDirectory {
+	return &LDAPDirectory{Config: cfg, Interval: cfg.SyncInterval}
+}
+
+// connect opens a connection bound as the search account
+func (d *LDAPDirectory) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.Config.InsecureSkipVerify}
+	conn, err := ldap.DialURL(d.Config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP: %w", err)
+	}
+	if d.Config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if err := d.bindSearchAccount(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *LDAPDirectory) bindSearchAccount(conn *ldap.Conn) error {
+	if d.Config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(d.Config.BindDN, d.Config.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind search account: %w", err)
+	}
+	return nil
+}
+
+// Authenticate binds as the user to check the password, then provisions the
+// user and syncs their teams and roles from their groups
+func (d *LDAPDirectory) Authenticate(username, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.Config.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(d.Config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{d.Config.UsernameAttribute, d.Config.EmailAttribute}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search LDAP user: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind LDAP user: %w", err)
+	}
+
+	// Search the user's groups as the search account again
+	if err := d.bindSearchAccount(conn); err != nil {
+		return nil, err
+	}
+	groups, err := d.searchGroups(conn, fmt.Sprintf("(%s=%s)", d.Config.GroupMemberAttribute, ldap.EscapeFilter(entry.DN)))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	return ProvisionUser(d.identity(entry), d.mapping(names))
+}
+
+// identity describes a directory user entry
+func (d *LDAPDirectory) identity(entry *ldap.Entry) ExternalIdentity {
+	return ExternalIdentity{
+		Provider:      ldapProvider,
+		Issuer:        d.Config.URL,
+		Subject:       strings.ToLower(entry.DN),
+		Username:      entry.GetAttributeValue(d.Config.UsernameAttribute),
+		Email:         entry.GetAttributeValue(d.Config.EmailAttribute),
+		EmailVerified: true, // The directory is authoritative for its users
+	}
+}
+
+// mapping maps the given groups to teams of the same name, except role groups
+func (d *LDAPDirectory) mapping(groups []string) config.GroupMappingConfig {
+	mapping := config.GroupMappingConfig{
+		Teams:               map[string]string{},
+		SuperManagerGroups:  d.Config.SuperManagerGroups,
+		GatewayEditorGroups: d.Config.GatewayEditorGroups,
+	}
+	for _, g := range groups {
+		if !d.isRoleGroup(g) {
+			mapping.Teams[g] = g
+		}
+	}
+	return mapping
+}
+
+func (d *LDAPDirectory) isRoleGroup(name string) bool {
+	return containsString(d.Config.SuperManagerGroups, name) || containsString(d.Config.GatewayEditorGroups, name)
+}
+
+// searchGroups returns the groups matching the group filter and an extra filter
+func (d *LDAPDirectory) searchGroups(conn *ldap.Conn, extraFilter string) ([]ldapGroup, error) {
+	filter := d.Config.GroupFilter
+	if extraFilter != "" {
+		filter = "(&" + filter + extraFilter + ")"
+	}
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		d.Config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{d.Config.GroupNameAttribute, d.Config.GroupMemberAttribute}, nil,
+	), 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search LDAP groups: %w", err)
+	}
+
+	groups := make([]ldapGroup, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		group := ldapGroup{Name: entry.GetAttributeValue(d.Config.GroupNameAttribute)}
+		for _, member := range entry.GetAttributeValues(d.Config.GroupMemberAttribute) {
+			group.Members = append(group.Members, strings.ToLower(member))
+		}
+		if group.Name != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// Start runs a sync in the background every Interval
+func (d *LDAPDirectory) Start() {
+	go func() {
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := d.Sync(); err != nil {
+				log.Printf("LDAP sync failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("LDAP sync started (interval %s)", d.Interval)
+}
+
+// LastReport returns the report of the last sync, nil before the first one
+func (d *LDAPDirectory) LastReport() *LDAPSyncReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lastReport
+}
+
+// Sync mirrors the directory's groups: each group becomes a team of the same
+// name whose directory members are exactly the group's members, and the role
+// groups decide who is a Super Manager or Gateway Editor. Members who never
+// logged in are provisioned.
+func (d *LDAPDirectory) Sync() (*LDAPSyncReport, error) {
+	report := &LDAPSyncReport{StartedAt: time.Now()}
+	err := d.sync(report)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	d.lastReport = report
+	d.mu.Unlock()
+
+	if err == nil {
+		log.Printf("LDAP sync: %d users provisioned, %d teams created, %d memberships added, %d removed, %d roles granted, %d revoked",
+			len(report.UsersProvisioned), len(report.TeamsCreated), len(report.MembershipsAdded),
+			len(report.MembershipsRemoved), len(report.RolesGranted), len(report.RolesRevoked))
+	}
+	return report, err
+}
+
+func (d *LDAPDirectory) sync(report *LDAPSyncReport) error {
+	conn, err := d.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	groups, err := d.searchGroups(conn, "")
+	if err != nil {
+		return err
+	}
+
+	users, err := d.linkMembers(conn, groups, report)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only users linked to this directory are added or removed
+		var directoryUsers []uint
+		if err := tx.Model(&models.UserIdentity{}).
+			Where("provider = ? AND issuer = ?", ldapProvider, d.Config.URL).
+			Pluck("user_id", &directoryUsers).Error; err != nil {
+			return fmt.Errorf("failed to load directory users: %w", err)
+		}
+
+		superManagers := map[uint]bool{}
+		gatewayEditors := map[uint]bool{}
+		for _, group := range groups {
+			members := map[uint]bool{}
+			for _, dn := range group.Members {
+				if user, ok := users[dn]; ok {
+					members[user.UserID] = true
+				}
+			}
+
+			if containsString(d.Config.SuperManagerGroups, group.Name) {
+				mergeIDs(superManagers, members)
+			}
+			if containsString(d.Config.GatewayEditorGroups, group.Name) {
+				mergeIDs(gatewayEditors, members)
+			}
+			if !d.isRoleGroup(group.Name) {
+				if err := d.syncTeam(tx, group.Name, members, directoryUsers, report); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(d.Config.SuperManagerGroups) > 0 {
+			if err := syncDirectoryRole(tx, models.RoleNameSuperManager, superManagers, directoryUsers, report); err != nil {
+				return err
+			}
+		}
+		if len(d.Config.GatewayEditorGroups) > 0 {
+			if err := syncDirectoryRole(tx, models.RoleNameGatewayEditor, gatewayEditors, directoryUsers, report); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// linkMembers returns the local users of all group members by DN, provisioning those without one
+func (d *LDAPDirectory) linkMembers(conn *ldap.Conn, groups []ldapGroup, report *LDAPSyncReport) (map[string]models.User, error) {
+	var links []models.UserIdentity
+	if err := database.DB.Where("provider = ? AND issuer = ?", ldapProvider, d.Config.URL).Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to load directory users: %w", err)
+	}
+	linked := map[string]uint{}
+	for _, link := range links {
+		linked[link.Subject] = link.UserID
+	}
+
+	users := map[string]models.User{}
+	for _, group := range groups {
+		for _, dn := range group.Members {
+			if _, done := users[dn]; done {
+				continue
+			}
+
+			if userID, ok := linked[dn]; ok {
+				var user models.User
+				if err := database.DB.First(&user, "user_id = ?", userID).Error; err == nil {
+					users[dn] = user
+				}
+				continue
+			}
+
+			result, err := conn.Search(ldap.NewSearchRequest(
+				dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+				"(objectClass=*)", []string{d.Config.UsernameAttribute, d.Config.EmailAttribute}, nil,
+			))
+			if err != nil || len(result.Entries) != 1 {
+				report.Skipped = append(report.Skipped, dn+": entry not found")
+				continue
+			}
+			user, err := ProvisionUser(d.identity(result.Entries[0]), config.GroupMappingConfig{})
+			if err != nil {
+				report.Skipped = append(report.Skipped, dn+": "+err.Error())
+				continue
+			}
+			users[dn] = *user
+			report.UsersProvisioned = append(report.UsersProvisioned, user.Username)
+		}
+	}
+	return users, nil
+}
+
+// syncTeam creates the team of a group if needed and makes its directory members match the group's
+func (d *LDAPDirectory) syncTeam(tx *gorm.DB, name string, members map[uint]bool, directoryUsers []uint, report *LDAPSyncReport) error {
+	var team models.Team
+	err := tx.Where("name = ?", name).First(&team).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		team = models.Team{Name: name}
+		if err := tx.Create(&team).Error; err != nil {
+			return fmt.Errorf("failed to create team %s: %w", name, err)
+		}
+		report.TeamsCreated = append(report.TeamsCreated, name)
+		if err := recordSyncAudit(tx, ldapProvider, models.AuditTeamCreated, "team", team.TeamID, map[string]interface{}{"name": name}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to load team %s: %w", name, err)
+	}
+
+	var current []uint
+	if err := tx.Model(&models.UserTeamMembership{}).Where("team_id = ?", team.TeamID).Pluck("user_id", &current).Error; err != nil {
+		return fmt.Errorf("failed to load members of team %s: %w", name, err)
+	}
+	isMember := map[uint]bool{}
+	for _, id := range current {
+		isMember[id] = true
+	}
+
+	for _, id := range sortedIDs(members) {
+		if isMember[id] {
+			continue
+		}
+		if err := tx.Create(&models.UserTeamMembership{UserID: id, TeamID: team.TeamID}).Error; err != nil {
+			return fmt.Errorf("failed to add member to team %s: %w", name, err)
+		}
+		report.MembershipsAdded = append(report.MembershipsAdded, LDAPSyncChange{Username: username(tx, id), Team: name})
+		if err := recordSyncAudit(tx, ldapProvider, models.AuditTeamMemberAdded, "team", team.TeamID, map[string]interface{}{"user_id": id}); err != nil {
+			return err
+		}
+	}
+	for _, id := range directoryUsers {
+		if !isMember[id] || members[id] {
+			continue
+		}
+		if err := tx.Where("user_id = ? AND team_id = ?", id, team.TeamID).Delete(&models.UserTeamMembership{}).Error; err != nil {
+			return fmt.Errorf("failed to remove member from team %s: %w", name, err)
+		}
+		report.MembershipsRemoved = append(report.MembershipsRemoved, LDAPSyncChange{Username: username(tx, id), Team: name})
+		if err := recordSyncAudit(tx, ldapProvider, models.AuditTeamMemberRemoved, "team", team.TeamID, map[string]interface{}{"user_id": id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDirectoryRole grants a role to the members of its groups and revokes it from other directory users
+func syncDirectoryRole(tx *gorm.DB, role string, members map[uint]bool, directoryUsers []uint, report *LDAPSyncReport) error {
+	for _, id := range directoryUsers {
+		if members[id] {
+			_, granted, err := GrantBuiltinRole(tx, id, role)
+			if err != nil {
+				return err
+			}
+			if granted {
+				report.RolesGranted = append(report.RolesGranted, LDAPSyncChange{Username: username(tx, id), Role: role})
+				if err := recordSyncAudit(tx, ldapProvider, models.AuditRoleGranted, "user", id, map[string]interface{}{"role": role}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		revoked, err := RevokeBuiltinRole(tx, id, role)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			report.RolesRevoked = append(report.RolesRevoked, LDAPSyncChange{Username: username(tx, id), Role: role})
+			if err := recordSyncAudit(tx, ldapProvider, models.AuditRoleRevoked, "user", id, map[string]interface{}{"role": role}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func username(tx *gorm.DB, userID uint) string {
+	var user models.User
+	tx.Select("username").First(&user, "user_id = ?", userID)
+	return user.Username
+}
+
+func sortedIDs(ids map[uint]bool) []uint {
+	sorted := make([]uint, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func mergeIDs(into, from map[uint]bool) {
+	for id := range from {
+		into[id] = true
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
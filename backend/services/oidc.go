@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"alpaka/backend/config"
+	"alpaka/backend/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrOIDCNonce is returned when an ID token was not issued for the login that requested it
+var ErrOIDCNonce = errors.New("ID token nonce does not match")
+
+// OIDCLogin is the state of a login between redirecting to the provider and its callback
+type OIDCLogin struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// OIDCClient runs the authorization code flow with PKCE against an OpenID Connect provider.
+// The provider's discovery document is fetched on first use, so the API starts while it is down.
+type OIDCClient struct {
+	Config config.OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCClient creates a new OIDC client
+func NewOIDCClient(cfg config.OIDCConfig) *OIDCClient {
+	return &OIDCClient{Config: cfg}
+}
+
+// discover returns the provider, fetching its discovery document once it is reachable
+func (o *OIDCClient) discover(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, o.Config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	o.provider = provider
+	return provider, nil
+}
+
+func (o *OIDCClient) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.Config.ClientID,
+		ClientSecret: o.Config.ClientSecret,
+		RedirectURL:  o.Config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       o.Config.Scopes,
+	}
+}
+
+// AuthCodeURL starts a login. It returns the provider URL to redirect the user
+// to and the state to keep until the callback.
+func (o *OIDCClient) AuthCodeURL(ctx context.Context) (string, *OIDCLogin, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	login := &OIDCLogin{
+		State:        oauth2.GenerateVerifier(),
+		Nonce:        oauth2.GenerateVerifier(),
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}
+	url := o.oauth2Config(provider).AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce),
+		oauth2.S256ChallengeOption(login.CodeVerifier))
+	return url, login, nil
+}
+
+// Exchange redeems the authorization code of a callback and validates the ID
+// token (signature, issuer, audience, expiry and nonce)
+func (o *OIDCClient) Exchange(ctx context.Context, code string, login *OIDCLogin) (*ExternalIdentity, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := o.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: o.Config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, ErrOIDCNonce
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode ID token claims: %w", err)
+	}
+	return o.identity(idToken.Issuer, idToken.Subject, claims), nil
+}
+
+// identity reads the configured claims of an ID token
+func (o *OIDCClient) identity(issuer, subject string, claims map[string]interface{}) *ExternalIdentity {
+	identity := &ExternalIdentity{
+		Provider: "oidc",
+		Issuer:   issuer,
+		Subject:  subject,
+	}
+	identity.Username, _ = claims[o.Config.UsernameClaim].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+
+	switch groups := claims[o.Config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	case string:
+		identity.Groups = []string{groups}
+	}
+	return identity
+}
+
+// Login provisions the user of a validated identity
+func (o *OIDCClient) Login(identity *ExternalIdentity) (*models.User, error) {
+	return ProvisionUser(*identity, o.Config.GroupMapping)
+}
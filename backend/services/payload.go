@@ -0,0 +1,184 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ConfigChanges is the structured form of ChangeRequest.ConfigChangesPayload.
+// The shape follows the sections of the frontend form definition (apiProps.json).
+type ConfigChanges struct {
+	Service ServiceConfig `json:"service"`
+	Routes  []RouteConfig `json:"routes,omitempty"`
+	Plugins PluginsConfig `json:"plugins"`
+
+	// Remove deletes the service with its routes and rate-limiting plugin.
+	// Only rollback CRs of a CR that created the service use it.
+	Remove bool `json:"remove,omitempty"`
+}
+
+// ServiceConfig is the "service" section of the payload
+type ServiceConfig struct {
+	Name string  `json:"name"`
+	URL  string  `json:"url,omitempty"` // Empty, like Port, in payloads that remove the service
+	Port FlexInt `json:"port,omitempty"`
+}
+
+// RouteConfig is a single entry of the repeatable "routes" section
+type RouteConfig struct {
+	Name    string     `json:"name"`
+	Paths   StringList `json:"paths"`
+	Methods StringList `json:"methods,omitempty"`
+}
+
+// PluginsConfig is the "plugins" section of the payload
+type PluginsConfig struct {
+	EnableRateLimit bool    `json:"enable_rate_limit"`
+	Minute          FlexInt `json:"minute,omitempty"` // 0 while rate limiting is off
+}
+
+// FlexInt accepts a JSON number, a numeric string or an empty string.
+// Number inputs in the form are sent as "" until the user types a value.
+type FlexInt int
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *FlexInt) UnmarshalJSON(data []byte) error {
+	raw := strings.TrimSpace(string(data))
+	if raw == "null" {
+		*f = 0
+		return nil
+	}
+
+	if strings.HasPrefix(raw, `"`) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			*f = 0
+			return nil
+		}
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", string(data))
+	}
+	*f = FlexInt(v)
+	return nil
+}
+
+// StringList accepts either a JSON array of strings or a comma-separated string
+// (the form sends route paths as "/users, /api/v1/users").
+type StringList []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var items []string
+	if err := json.Unmarshal(data, &items); err != nil {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("expected string or array of strings, got %s", string(data))
+		}
+		items = strings.Split(s, ",")
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	*l = result
+	return nil
+}
+
+// ParseConfigChanges decodes a ConfigChangesPayload into its structured form
+func ParseConfigChanges(payload string) (*ConfigChanges, error) {
+	var changes ConfigChanges
+	if err := json.Unmarshal([]byte(payload), &changes); err != nil {
+		return nil, fmt.Errorf("invalid config changes payload: %w", err)
+	}
+
+	if strings.TrimSpace(changes.Service.Name) == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	if changes.Remove {
+		return &changes, nil
+	}
+	if strings.TrimSpace(changes.Service.URL) == "" {
+		return nil, fmt.Errorf("service url is required")
+	}
+	for i, route := range changes.Routes {
+		if strings.TrimSpace(route.Name) == "" {
+			return nil, fmt.Errorf("routes[%d]: name is required", i)
+		}
+		if len(route.Paths) == 0 {
+			return nil, fmt.Errorf("routes[%d]: at least one path is required", i)
+		}
+	}
+	if changes.Plugins.EnableRateLimit && changes.Plugins.Minute <= 0 {
+		return nil, fmt.Errorf("plugins: requests per minute must be positive when rate limiting is enabled")
+	}
+
+	return &changes, nil
+}
+
+// KongService converts the service section into a Kong service object
+func (c *ConfigChanges) KongService() (KongService, error) {
+	u, err := url.Parse(c.Service.URL)
+	if err != nil || u.Scheme == "" || u.Hostname() == "" {
+		return KongService{}, fmt.Errorf("invalid service url %q", c.Service.URL)
+	}
+
+	svc := KongService{
+		Name:     c.Service.Name,
+		Protocol: u.Scheme,
+		Host:     u.Hostname(),
+		Path:     u.Path,
+	}
+
+	// An explicit port in the form wins over the one embedded in the URL
+	switch {
+	case c.Service.Port > 0:
+		svc.Port = int(c.Service.Port)
+	case u.Port() != "":
+		svc.Port, _ = strconv.Atoi(u.Port())
+	case u.Scheme == "https":
+		svc.Port = 443
+	default:
+		svc.Port = 80
+	}
+
+	return svc, nil
+}
+
+// KongRoutes converts the routes section into Kong route objects
+func (c *ConfigChanges) KongRoutes() []KongRoute {
+	routes := make([]KongRoute, 0, len(c.Routes))
+	for _, r := range c.Routes {
+		routes = append(routes, KongRoute{
+			Name:    r.Name,
+			Paths:   []string(r.Paths),
+			Methods: []string(r.Methods),
+			Service: &KongRef{Name: c.Service.Name},
+		})
+	}
+	return routes
+}
+
+// KongRateLimitPlugin returns the rate-limiting plugin requested by the payload,
+// or nil if rate limiting is disabled
+func (c *ConfigChanges) KongRateLimitPlugin() *KongPlugin {
+	if !c.Plugins.EnableRateLimit {
+		return nil
+	}
+	return &KongPlugin{
+		Name:    RateLimitingPlugin,
+		Enabled: true,
+		Config:  map[string]interface{}{"minute": int(c.Plugins.Minute)},
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrPayloadNotApproved is returned when a CR's payload is not the one that was approved
+var ErrPayloadNotApproved = errors.New("payload differs from the approved one")
+
+// CanonicalPayload returns the canonical form of a JSON payload: object keys
+// sorted, no insignificant whitespace, strings and numbers as written. Payloads
+// that only differ in formatting have the same canonical form.
+func CanonicalPayload(payload string) ([]byte, error) {
+	value, err := decodePayload(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// HashPayload returns the hex SHA-256 of the canonical form of a payload
+func HashPayload(payload string) (string, error) {
+	canonical, err := CanonicalPayload(payload)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CheckApprovedPayload returns an error wrapping ErrPayloadNotApproved unless
+// the CR's payload hashes to the hash recorded when it was approved
+func CheckApprovedPayload(cr *models.ChangeRequest) error {
+	if cr.ApprovedPayloadHash == "" {
+		return fmt.Errorf("%w: no payload hash was recorded at approval", ErrPayloadNotApproved)
+	}
+	hash, err := HashPayload(cr.ConfigChangesPayload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPayloadNotApproved, err)
+	}
+	if hash != cr.ApprovedPayloadHash {
+		return fmt.Errorf("%w: payload hash is %s, approved was %s", ErrPayloadNotApproved, hash, cr.ApprovedPayloadHash)
+	}
+	return nil
+}
+
+// payloadApproved refuses to execute a payload that changed after approval
+func payloadApproved(db *gorm.DB, cr *models.ChangeRequest, actor Actor) (string, error) {
+	if err := CheckApprovedPayload(cr); err != nil {
+		return err.Error(), ErrPayloadNotApproved
+	}
+	return "", nil
+}
+
+// SeedApprovedPayloadHashes records the current payload as the approved one of
+// CRs approved before approval hashes were kept. Their payload could not be
+// edited after approval, so it is the one that was approved.
+func SeedApprovedPayloadHashes() error {
+	var sealed int
+	var crs []models.ChangeRequest
+	err := database.DB.Select("cr_id", "config_changes_payload").
+		Where("approval_status = ? AND approved_payload_hash = ''", models.ApprovalStatusApproved).
+		FindInBatches(&crs, 500, func(tx *gorm.DB, _ int) error {
+			for _, cr := range crs {
+				hash, err := HashPayload(cr.ConfigChangesPayload)
+				if err != nil {
+					// Left without a hash, so it is refused until a Gateway Editor cancels it
+					log.Printf("Cannot hash the approved payload of CR %d: %v", cr.CRID, err)
+					continue
+				}
+				if err := database.DB.Model(&models.ChangeRequest{}).Where("cr_id = ?", cr.CRID).
+					UpdateColumn("approved_payload_hash", hash).Error; err != nil {
+					return fmt.Errorf("failed to record approved payload hash of CR %d: %w", cr.CRID, err)
+				}
+				sealed++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to seed approved payload hashes: %w", err)
+	}
+	if sealed > 0 {
+		log.Printf("Recorded the approved payload hash of %d existing change requests", sealed)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"alpaka/backend/models"
+)
+
+// PlanAction is what applying a CR does to a single Kong entity
+type PlanAction string
+
+const (
+	PlanActionCreate PlanAction = "create"
+	PlanActionUpdate PlanAction = "update"
+	PlanActionDelete PlanAction = "delete"
+)
+
+// Kong entity kinds that appear in a plan
+const (
+	ResourceService = "service"
+	ResourceRoute   = "route"
+	ResourcePlugin  = "plugin"
+)
+
+// PlanChange is a single create/update/delete of a Kong entity
+type PlanChange struct {
+	ResourceType  string      `json:"resource_type"`
+	Name          string      `json:"name"`
+	Action        PlanAction  `json:"action"`
+	ChangedFields []string    `json:"changed_fields,omitempty"`
+	Before        interface{} `json:"before,omitempty"`
+	After         interface{} `json:"after,omitempty"`
+
+	// ID is the Kong id of the existing entity (needed to delete plugins)
+	ID string `json:"-"`
+}
+
+// PlanSummary counts the changes of a plan by action
+type PlanSummary struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+// Plan is the Terraform-style list of changes a CR will make on the gateway
+type Plan struct {
+	CRID        uint         `json:"cr_id,omitempty"`
+	ServiceName string       `json:"service_name"`
+	Changes     []PlanChange `json:"changes"`
+	Summary     PlanSummary  `json:"summary"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
+
+// HasChanges reports whether applying the plan would touch the gateway
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// ServiceState is the set of Kong entities that belong to one service
+type ServiceState struct {
+	Service *KongService `json:"service"`
+	Routes  []KongRoute  `json:"routes"`
+	Plugins []KongPlugin `json:"plugins"`
+}
+
+// Planner computes plans by diffing CR payloads against the live gateway
+type Planner struct {
+	Client KongClient
+}
+
+// NewPlanner creates a new planner
+func NewPlanner(client KongClient) *Planner {
+	return &Planner{Client: client}
+}
+
+// PlanChangeRequest computes the plan for a change request
+func (p *Planner) PlanChangeRequest(cr *models.ChangeRequest) (*Plan, error) {
+	if !IsKongServiceCR(cr) {
+		return nil, fmt.Errorf("change requests of type %s have no gateway plan", cr.Type)
+	}
+
+	changes, err := ParseConfigChanges(cr.ConfigChangesPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := p.Plan(changes)
+	if err != nil {
+		return nil, err
+	}
+	plan.CRID = cr.CRID
+	return plan, nil
+}
+
+// Plan computes the changes needed to bring the gateway to the payload's state
+func (p *Planner) Plan(changes *ConfigChanges) (*Plan, error) {
+	desired, err := changes.DesiredState()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := FetchServiceState(p.Client, changes.Service.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		ServiceName: changes.Service.Name,
+		Changes:     DiffServiceState(current, desired),
+		GeneratedAt: time.Now(),
+	}
+	for _, c := range plan.Changes {
+		switch c.Action {
+		case PlanActionCreate:
+			plan.Summary.Create++
+		case PlanActionUpdate:
+			plan.Summary.Update++
+		case PlanActionDelete:
+			plan.Summary.Delete++
+		}
+	}
+	return plan, nil
+}
+
+// DesiredState returns the Kong entities the payload asks for.
+// A payload with "remove" set desires an empty state.
+func (c *ConfigChanges) DesiredState() (*ServiceState, error) {
+	if c.Remove {
+		return &ServiceState{}, nil
+	}
+
+	svc, err := c.KongService()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ServiceState{
+		Service: &svc,
+		Routes:  c.KongRoutes(),
+	}
+	if plugin := c.KongRateLimitPlugin(); plugin != nil {
+		state.Plugins = []KongPlugin{*plugin}
+	}
+	return state, nil
+}
+
+// FetchServiceState reads a service and its routes and plugins from Kong.
+// A service that does not exist yields an empty state.
+func FetchServiceState(client KongClient, name string) (*ServiceState, error) {
+	state := &ServiceState{}
+
+	svc, err := client.GetService(name)
+	if errors.Is(err, ErrKongNotFound) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service %s: %w", name, err)
+	}
+	state.Service = svc
+
+	if state.Routes, err = client.ListServiceRoutes(name); err != nil {
+		return nil, fmt.Errorf("failed to read routes of service %s: %w", name, err)
+	}
+	if state.Plugins, err = client.ListServicePlugins(name); err != nil {
+		return nil, fmt.Errorf("failed to read plugins of service %s: %w", name, err)
+	}
+	return state, nil
+}
+
+// DiffServiceState lists the changes turning current into desired.
+// Only the rate-limiting plugin is managed; other plugins on the service are left alone.
+func DiffServiceState(current, desired *ServiceState) []PlanChange {
+	changes := []PlanChange{}
+
+	// Service
+	switch {
+	case current.Service == nil && desired.Service != nil:
+		changes = append(changes, PlanChange{ResourceType: ResourceService, Name: desired.Service.Name, Action: PlanActionCreate, After: desired.Service})
+	case current.Service != nil && desired.Service != nil:
+		if fields := diffService(current.Service, desired.Service); len(fields) > 0 {
+			changes = append(changes, PlanChange{ResourceType: ResourceService, Name: desired.Service.Name, Action: PlanActionUpdate, ChangedFields: fields, Before: current.Service, After: desired.Service, ID: current.Service.ID})
+		}
+	}
+
+	// Routes
+	existingRoutes := make(map[string]KongRoute, len(current.Routes))
+	for _, r := range current.Routes {
+		existingRoutes[routeKey(r)] = r
+	}
+	wantedRoutes := make(map[string]bool, len(desired.Routes))
+	for _, r := range desired.Routes {
+		r := r
+		wantedRoutes[r.Name] = true
+		before, ok := existingRoutes[r.Name]
+		if !ok {
+			changes = append(changes, PlanChange{ResourceType: ResourceRoute, Name: r.Name, Action: PlanActionCreate, After: &r})
+			continue
+		}
+		if fields := diffRoute(&before, &r); len(fields) > 0 {
+			changes = append(changes, PlanChange{ResourceType: ResourceRoute, Name: r.Name, Action: PlanActionUpdate, ChangedFields: fields, Before: &before, After: &r, ID: before.ID})
+		}
+	}
+	for _, r := range current.Routes {
+		r := r
+		if !wantedRoutes[routeKey(r)] {
+			changes = append(changes, PlanChange{ResourceType: ResourceRoute, Name: routeKey(r), Action: PlanActionDelete, Before: &r, ID: r.ID})
+		}
+	}
+
+	// Plugins
+	existingPlugins := make(map[string]KongPlugin)
+	for _, p := range current.Plugins {
+		if p.Name == RateLimitingPlugin {
+			existingPlugins[p.Name] = p
+		}
+	}
+	wantedPlugins := make(map[string]bool)
+	for _, p := range desired.Plugins {
+		p := p
+		wantedPlugins[p.Name] = true
+		before, ok := existingPlugins[p.Name]
+		if !ok {
+			changes = append(changes, PlanChange{ResourceType: ResourcePlugin, Name: p.Name, Action: PlanActionCreate, After: &p})
+			continue
+		}
+		if fields := diffPlugin(&before, &p); len(fields) > 0 {
+			changes = append(changes, PlanChange{ResourceType: ResourcePlugin, Name: p.Name, Action: PlanActionUpdate, ChangedFields: fields, Before: &before, After: &p, ID: before.ID})
+		}
+	}
+	for name, p := range existingPlugins {
+		p := p
+		if !wantedPlugins[name] {
+			changes = append(changes, PlanChange{ResourceType: ResourcePlugin, Name: name, Action: PlanActionDelete, Before: &p, ID: p.ID})
+		}
+	}
+
+	// A service can only be deleted once its routes are gone, so it comes last
+	if current.Service != nil && desired.Service == nil {
+		changes = append(changes, PlanChange{ResourceType: ResourceService, Name: current.Service.Name, Action: PlanActionDelete, Before: current.Service, ID: current.Service.ID})
+	}
+
+	return changes
+}
+
+func routeKey(r KongRoute) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID
+}
+
+func diffService(before, after *KongService) []string {
+	var fields []string
+	if before.Protocol != after.Protocol {
+		fields = append(fields, "protocol")
+	}
+	if before.Host != after.Host {
+		fields = append(fields, "host")
+	}
+	if before.Port != after.Port {
+		fields = append(fields, "port")
+	}
+	if before.Path != after.Path {
+		fields = append(fields, "path")
+	}
+	return fields
+}
+
+func diffRoute(before, after *KongRoute) []string {
+	var fields []string
+	if !sameStringSet(before.Paths, after.Paths) {
+		fields = append(fields, "paths")
+	}
+	if !sameStringSet(before.Methods, after.Methods) {
+		fields = append(fields, "methods")
+	}
+	return fields
+}
+
+// diffPlugin compares only the config keys the payload sets;
+// Kong fills in defaults for every other key.
+func diffPlugin(before, after *KongPlugin) []string {
+	var fields []string
+	if before.Enabled != after.Enabled {
+		fields = append(fields, "enabled")
+	}
+	keys := make([]string, 0, len(after.Config))
+	for key := range after.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !sameJSONValue(before.Config[key], after.Config[key]) {
+			fields = append(fields, "config."+key)
+		}
+	}
+	return fields
+}
+
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	return reflect.DeepEqual(as, bs)
+}
+
+// sameJSONValue compares values that may have been decoded from JSON
+// (numbers arrive as float64) with values built in Go
+func sameJSONValue(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
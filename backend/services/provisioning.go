@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"alpaka/backend/config"
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExternalIdentity is a user as asserted by an identity provider
+type ExternalIdentity struct {
+	Provider      string // e.g. "oidc"
+	Issuer        string
+	Subject       string // Stable ID of the user at the provider
+	Username      string
+	Email         string
+	EmailVerified bool
+	Groups        []string
+}
+
+// ProvisionUser returns the user linked to an external identity, creating it on
+// first login, and syncs the teams and roles configured in mapping.
+// An existing local user is only linked by a verified email address.
+func ProvisionUser(identity ExternalIdentity, mapping config.GroupMappingConfig) (*models.User, error) {
+	if identity.Subject == "" {
+		return nil, errors.New("identity provider did not return a subject")
+	}
+	if identity.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("provider = ? AND issuer = ? AND subject = ?", identity.Provider, identity.Issuer, identity.Subject).
+			First(&link).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, "user_id = ?", link.UserID).Error; err != nil {
+				return fmt.Errorf("failed to load linked user: %w", err)
+			}
+			if err := tx.Model(&link).Update("last_login_at", time.Now()).Error; err != nil {
+				return fmt.Errorf("failed to update identity: %w", err)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := findOrCreateUser(tx, identity, &user); err != nil {
+				return err
+			}
+			link = models.UserIdentity{
+				UserID:   user.UserID,
+				Provider: identity.Provider,
+				Issuer:   identity.Issuer,
+				Subject:  identity.Subject,
+			}
+			if err := tx.Create(&link).Error; err != nil {
+				return fmt.Errorf("failed to link identity: %w", err)
+			}
+			log.Printf("Provisioning: linked %s identity %s to user %s", identity.Provider, identity.Subject, user.Username)
+		default:
+			return fmt.Errorf("failed to load identity: %w", err)
+		}
+
+		return syncGroups(tx, identity.Provider, user.UserID, identity.Groups, mapping)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// findOrCreateUser loads the local user with the identity's verified email or creates a user without a password
+func findOrCreateUser(tx *gorm.DB, identity ExternalIdentity, user *models.User) error {
+	err := tx.Where("email = ?", identity.Email).First(user).Error
+	if err == nil {
+		if !identity.EmailVerified {
+			return fmt.Errorf("a user with email %s already exists and the identity provider has not verified it", identity.Email)
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	username, err := availableUsername(tx, identity)
+	if err != nil {
+		return err
+	}
+	*user = models.User{Username: username, Email: identity.Email}
+	if err := tx.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	log.Printf("Provisioning: created user %s from %s", username, identity.Provider)
+	return nil
+}
+
+// availableUsername picks the identity's username, or the local part of its
+// email, with a numeric suffix if it is taken
+func availableUsername(tx *gorm.DB, identity ExternalIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if len(base) > 45 {
+		base = base[:45]
+	}
+
+	candidate := base
+	for i := 2; i < 100; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", fmt.Errorf("no free username for %s", base)
+}
+
+// syncGroups makes the user's memberships of mapped teams and their roles
+// follow the provider's groups. Unmapped teams and unconfigured roles are left alone.
+func syncGroups(tx *gorm.DB, provider string, userID uint, groups []string, mapping config.GroupMappingConfig) error {
+	inGroup := map[string]bool{}
+	for _, g := range groups {
+		inGroup[g] = true
+	}
+
+	// A team may be mapped from several groups; membership of any one counts
+	wantTeams := map[string]bool{}
+	for group, teamName := range mapping.Teams {
+		wantTeams[teamName] = wantTeams[teamName] || inGroup[group]
+	}
+	for teamName, want := range wantTeams {
+		var team models.Team
+		if err := tx.Where("name = ?", teamName).First(&team).Error; err != nil {
+			log.Printf("Provisioning: mapped team %q does not exist", teamName)
+			continue
+		}
+		membership := models.UserTeamMembership{UserID: userID, TeamID: team.TeamID}
+		var result *gorm.DB
+		action := models.AuditTeamMemberAdded
+		if want {
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&membership)
+		} else {
+			result = tx.Where("user_id = ? AND team_id = ?", userID, team.TeamID).Delete(&models.UserTeamMembership{})
+			action = models.AuditTeamMemberRemoved
+		}
+		if result.Error != nil {
+			return fmt.Errorf("failed to sync membership of team %s: %w", teamName, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			if err := recordSyncAudit(tx, provider, action, "team", team.TeamID, map[string]interface{}{"user_id": userID}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(mapping.SuperManagerGroups) > 0 {
+		if err := syncRole(tx, provider, userID, models.RoleNameSuperManager, anyGroup(inGroup, mapping.SuperManagerGroups)); err != nil {
+			return err
+		}
+	}
+	if len(mapping.GatewayEditorGroups) > 0 {
+		if err := syncRole(tx, provider, userID, models.RoleNameGatewayEditor, anyGroup(inGroup, mapping.GatewayEditorGroups)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncRole grants or revokes the unrestricted binding of a built-in role
+func syncRole(tx *gorm.DB, provider string, userID uint, roleName string, want bool) error {
+	var changed bool
+	var err error
+	action := models.AuditRoleGranted
+	if want {
+		_, changed, err = GrantBuiltinRole(tx, userID, roleName)
+	} else {
+		changed, err = RevokeBuiltinRole(tx, userID, roleName)
+		action = models.AuditRoleRevoked
+	}
+	if err != nil || !changed {
+		return err
+	}
+	return recordSyncAudit(tx, provider, action, "user", userID, map[string]interface{}{"role": roleName})
+}
+
+func anyGroup(inGroup map[string]bool, groups []string) bool {
+	for _, g := range groups {
+		if inGroup[g] {
+			return true
+		}
+	}
+	return false
+}
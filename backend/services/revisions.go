@@ -0,0 +1,198 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of PayloadChange
+const (
+	PayloadChangeAdded   = "added"
+	PayloadChangeRemoved = "removed"
+	PayloadChangeChanged = "changed"
+)
+
+// PayloadChange is a difference between two payloads at one JSON path
+type PayloadChange struct {
+	Path string      `json:"path"` // e.g. routes[1].paths; empty for the whole payload
+	Type string      `json:"type"` // added, removed or changed
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// PayloadDiffSummary counts the changes of a diff by type
+type PayloadDiffSummary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+// SummarizePayloadChanges counts changes by type
+func SummarizePayloadChanges(changes []PayloadChange) PayloadDiffSummary {
+	var summary PayloadDiffSummary
+	for _, change := range changes {
+		switch change.Type {
+		case PayloadChangeAdded:
+			summary.Added++
+		case PayloadChangeRemoved:
+			summary.Removed++
+		case PayloadChangeChanged:
+			summary.Changed++
+		}
+	}
+	return summary
+}
+
+// DiffPayloads compares two JSON payloads value by value. Objects are compared
+// by key and arrays by index, so an element inserted into an array shows up as
+// changes to the elements after it.
+func DiffPayloads(from, to string) ([]PayloadChange, error) {
+	a, err := decodePayload(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid old payload: %w", err)
+	}
+	b, err := decodePayload(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new payload: %w", err)
+	}
+
+	changes := []PayloadChange{}
+	diffValues("", a, b, &changes)
+	return changes, nil
+}
+
+func decodePayload(payload string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(payload))
+	// Keep numbers as written, so 1 and 1.0 or large IDs are not mangled
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffValues(path string, a, b interface{}, changes *[]PayloadChange) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				oldValue, inA := av[k]
+				newValue, inB := bv[k]
+				switch {
+				case !inA:
+					*changes = append(*changes, PayloadChange{Path: keyPath(path, k), Type: PayloadChangeAdded, New: newValue})
+				case !inB:
+					*changes = append(*changes, PayloadChange{Path: keyPath(path, k), Type: PayloadChangeRemoved, Old: oldValue})
+				default:
+					diffValues(keyPath(path, k), oldValue, newValue, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			for i := 0; i < len(av) || i < len(bv); i++ {
+				elemPath := path + "[" + strconv.Itoa(i) + "]"
+				switch {
+				case i >= len(av):
+					*changes = append(*changes, PayloadChange{Path: elemPath, Type: PayloadChangeAdded, New: bv[i]})
+				case i >= len(bv):
+					*changes = append(*changes, PayloadChange{Path: elemPath, Type: PayloadChangeRemoved, Old: av[i]})
+				default:
+					diffValues(elemPath, av[i], bv[i], changes)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, PayloadChange{Path: path, Type: PayloadChangeChanged, Old: a, New: b})
+	}
+}
+
+// keyPath appends an object key to a path in the notation of validation errors
+func keyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// RecordPayloadRevision stores the CR's payload as its next revision, unless
+// it equals the latest one. It returns the stored revision and its changes
+// from the previous one, or nil if nothing was stored.
+func RecordPayloadRevision(db *gorm.DB, cr *models.ChangeRequest, userID uint) (*models.PayloadRevision, []PayloadChange, error) {
+	var latest models.PayloadRevision
+	err := db.Where("cr_id = ?", cr.CRID).Order("number DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("failed to load payload revisions: %w", err)
+	}
+
+	var changes []PayloadChange
+	if latest.Number > 0 {
+		changes, err = DiffPayloads(latest.ConfigChangesPayload, cr.ConfigChangesPayload)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(changes) == 0 {
+			return nil, nil, nil
+		}
+	}
+
+	// Rework is reviewed in the next round, once the CR is resubmitted
+	round := cr.Revision
+	if cr.ApprovalStatus == models.ApprovalStatusNeedsRework {
+		round++
+	}
+
+	revision := models.PayloadRevision{
+		CRID:                 cr.CRID,
+		Number:               latest.Number + 1,
+		Revision:             round,
+		ConfigChangesPayload: cr.ConfigChangesPayload,
+		CreatedByUserID:      userID,
+	}
+	if err := db.Create(&revision).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to store payload revision: %w", err)
+	}
+	return &revision, changes, nil
+}
+
+// SeedPayloadRevisions stores the current payload as the first revision of CRs
+// created before payload revisions were kept
+func SeedPayloadRevisions() error {
+	result := database.DB.Exec(`INSERT INTO cr_payload_revisions (cr_id, number, revision, config_changes_payload, created_by_user_id, created_at)
+		SELECT cr_id, 1, revision, config_changes_payload, requester_user_id, created_at FROM change_requests
+		WHERE cr_id NOT IN (SELECT cr_id FROM cr_payload_revisions)`)
+	if result.Error != nil {
+		return fmt.Errorf("failed to seed payload revisions: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Stored the payload of %d existing change requests as their first revision", result.RowsAffected)
+	}
+	return nil
+}
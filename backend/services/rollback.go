@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"alpaka/backend/models"
+)
+
+// ErrSnapshotNotRestorable is returned for snapshots a payload cannot express:
+// services without routes and routes matching only by host or header
+var ErrSnapshotNotRestorable = errors.New("the pre-change snapshot cannot be restored by a rollback change request")
+
+// BuildRollbackPayload returns the config changes payload that restores the
+// gateway to the snapshot taken before the CR was executed
+func BuildRollbackPayload(cr *models.ChangeRequest) (string, error) {
+	if cr.PreChangeSnapshot == nil || *cr.PreChangeSnapshot == "" {
+		return "", fmt.Errorf("change request %d has no pre-change snapshot", cr.CRID)
+	}
+
+	var snapshot ServiceState
+	if err := json.Unmarshal([]byte(*cr.PreChangeSnapshot), &snapshot); err != nil {
+		return "", fmt.Errorf("invalid pre-change snapshot: %w", err)
+	}
+
+	changes, err := ParseConfigChanges(cr.ConfigChangesPayload)
+	if err != nil {
+		return "", err
+	}
+
+	rollback, err := SnapshotToConfigChanges(changes.Service.Name, &snapshot)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(rollback)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode rollback payload: %w", err)
+	}
+	return string(payload), nil
+}
+
+// SnapshotToConfigChanges converts a Kong service state back into a payload.
+// A snapshot without a service produces a payload that removes the service.
+// Routes are not dropped, since applying the payload would delete them from
+// Kong; snapshots with routes a payload cannot hold return ErrSnapshotNotRestorable.
+func SnapshotToConfigChanges(serviceName string, snapshot *ServiceState) (*ConfigChanges, error) {
+	if snapshot.Service == nil {
+		return &ConfigChanges{
+			Service: ServiceConfig{Name: serviceName},
+			Remove:  true,
+		}, nil
+	}
+
+	svc := snapshot.Service
+	u := url.URL{
+		Scheme: svc.Protocol,
+		Host:   svc.Host + ":" + strconv.Itoa(svc.Port),
+		Path:   svc.Path,
+	}
+	changes := &ConfigChanges{
+		Service: ServiceConfig{
+			Name: svc.Name,
+			URL:  u.String(),
+			Port: FlexInt(svc.Port),
+		},
+		Routes: []RouteConfig{},
+	}
+
+	if len(snapshot.Routes) == 0 {
+		return nil, fmt.Errorf("%w: service %s had no routes", ErrSnapshotNotRestorable, svc.Name)
+	}
+	var pathless []string
+	for _, r := range snapshot.Routes {
+		if len(r.Paths) == 0 {
+			pathless = append(pathless, routeKey(r))
+			continue
+		}
+		changes.Routes = append(changes.Routes, RouteConfig{
+			Name:    routeKey(r),
+			Paths:   StringList(r.Paths),
+			Methods: StringList(r.Methods),
+		})
+	}
+
+	if len(pathless) > 0 {
+		return nil, fmt.Errorf("%w: routes without paths: %s", ErrSnapshotNotRestorable, strings.Join(pathless, ", "))
+	}
+
+	for _, p := range snapshot.Plugins {
+		if p.Name != RateLimitingPlugin || !p.Enabled {
+			continue
+		}
+		changes.Plugins.EnableRateLimit = true
+		if minute, ok := toFloat(p.Config["minute"]); ok {
+			changes.Plugins.Minute = FlexInt(minute)
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"alpaka/backend/models"
+)
+
+func TestSnapshotToConfigChanges(t *testing.T) {
+	snapshot := &ServiceState{
+		Service: &KongService{Name: "orders", Protocol: "https", Host: "orders.internal", Port: 8443, Path: "/api"},
+		Routes: []KongRoute{
+			{ID: "r1", Name: "orders-read", Paths: []string{"/orders"}, Methods: []string{"GET"}},
+			{ID: "r2", Paths: []string{"/o"}},
+		},
+		Plugins: []KongPlugin{{ID: "p1", Name: RateLimitingPlugin, Enabled: true, Config: map[string]interface{}{"minute": 30.0}}},
+	}
+	changes, err := SnapshotToConfigChanges("orders", snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes.Remove || changes.Service.URL != "https://orders.internal:8443/api" || changes.Service.Port != 8443 {
+		t.Errorf("service = %+v", changes.Service)
+	}
+	want := []RouteConfig{
+		{Name: "orders-read", Paths: StringList{"/orders"}, Methods: StringList{"GET"}},
+		{Name: "r2", Paths: StringList{"/o"}},
+	}
+	if !reflect.DeepEqual(changes.Routes, want) {
+		t.Errorf("routes = %+v, want %+v", changes.Routes, want)
+	}
+	if !changes.Plugins.EnableRateLimit || changes.Plugins.Minute != 30 {
+		t.Errorf("plugins = %+v", changes.Plugins)
+	}
+
+	// A service that did not exist is removed
+	if changes, err := SnapshotToConfigChanges("orders", &ServiceState{}); err != nil || !changes.Remove || changes.Service.Name != "orders" {
+		t.Errorf("changes = %+v, want the service removed", changes)
+	}
+}
+
+func TestRollbackRestoresSnapshot(t *testing.T) {
+	kong := newFakeKong(t)
+	kong.services["orders"] = KongService{ID: "svc-1", Name: "orders", Protocol: "http", Host: "orders-v1.internal", Port: 80}
+	kong.routes["orders-legacy"] = KongRoute{ID: "route-1", Name: "orders-legacy", Paths: []string{"/legacy"}, Service: &KongRef{Name: "orders"}}
+	executor := NewKongExecutor(NewKongAdminClient(kong.URL, ""))
+
+	cr := &models.ChangeRequest{CRID: 7, ConfigChangesPayload: testPayload}
+	if err := applySnapshotted(executor, cr); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := BuildRollbackPayload(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Execute(&models.ChangeRequest{ConfigChangesPayload: payload}); err != nil {
+		t.Fatalf("rollback payload %s: %v", payload, err)
+	}
+
+	if svc := kong.services["orders"]; svc.Host != "orders-v1.internal" || svc.Port != 80 {
+		t.Errorf("service = %+v, want the state before the change", svc)
+	}
+	if _, ok := kong.routes["orders-legacy"]; !ok || len(kong.routes) != 1 {
+		t.Errorf("routes = %+v, want only orders-legacy", kong.routes)
+	}
+	if len(kong.plugins) != 0 {
+		t.Errorf("plugins = %+v, want none", kong.plugins)
+	}
+
+	// Rolling back the creation of a service removes it
+	created := &models.ChangeRequest{CRID: 8, ConfigChangesPayload: `{"service": {"name": "billing", "url": "http://billing.internal:80", "port": 80}, "routes": [{"name": "billing", "paths": ["/billing"]}]}`}
+	if err := applySnapshotted(executor, created); err != nil {
+		t.Fatal(err)
+	}
+	if payload, err = BuildRollbackPayload(created); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.Execute(&models.ChangeRequest{ConfigChangesPayload: payload}); err != nil {
+		t.Fatalf("rollback payload %s: %v", payload, err)
+	}
+	if _, ok := kong.services["billing"]; ok {
+		t.Error("service billing was not removed")
+	}
+	if _, ok := kong.routes["billing"]; ok {
+		t.Error("route billing was not removed")
+	}
+}
+
+// applySnapshotted executes a CR and keeps its pre-change snapshot, as the automation does
+func applySnapshotted(executor *KongExecutor, cr *models.ChangeRequest) error {
+	result, err := executor.Execute(cr)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(result.Snapshot)
+	if err != nil {
+		return err
+	}
+	s := string(snapshot)
+	cr.PreChangeSnapshot = &s
+	return nil
+}
+
+func TestSnapshotToConfigChangesValidates(t *testing.T) {
+	service := &KongService{Name: "orders", Protocol: "http", Host: "orders.internal", Port: 8080}
+	routes := []KongRoute{
+		{ID: "r1", Name: "orders-read", Paths: []string{"/orders"}, Methods: []string{"GET"}},
+		{ID: "r2", Name: "orders-any", Paths: []string{"/o"}},
+	}
+
+	tests := []struct {
+		name       string
+		snapshot   *ServiceState
+		restorable bool
+	}{
+		{"service with routes and a disabled rate limit", &ServiceState{
+			Service: service,
+			Routes:  routes,
+			Plugins: []KongPlugin{{ID: "p1", Name: RateLimitingPlugin, Enabled: false, Config: map[string]interface{}{"minute": 5.0}}},
+		}, true},
+		{"service that did not exist", &ServiceState{}, true},
+		// Routes matching only by host or header cannot be expressed in a payload
+		{"route without paths", &ServiceState{Service: service, Routes: append(routes, KongRoute{ID: "r3", Name: "by-host"})}, false},
+		{"service without routes", &ServiceState{Service: service}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := SnapshotToConfigChanges("orders", tt.snapshot)
+			if !tt.restorable {
+				if !errors.Is(err, ErrSnapshotNotRestorable) {
+					t.Errorf("err = %v, want ErrSnapshotNotRestorable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, err := json.Marshal(changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateConfigChanges(string(payload)); err != nil {
+				t.Errorf("payload %s: %v", payload, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrExecutionDeferred is returned when an approved CR may not run yet
+	ErrExecutionDeferred = errors.New("execution deferred")
+	// ErrChangeFreeze is returned when a freeze period blocks execution
+	ErrChangeFreeze = fmt.Errorf("%w: change freeze in effect", ErrExecutionDeferred)
+)
+
+// environmentScope restricts a query to rows matching the CR's environment.
+// Rows without an environment match every CR.
+func environmentScope(db *gorm.DB, cr *models.ChangeRequest) *gorm.DB {
+	if cr.EnvironmentID == nil {
+		return db.Where("environment_id IS NULL")
+	}
+	return db.Where("(environment_id IS NULL OR environment_id = ?)", *cr.EnvironmentID)
+}
+
+// ActiveFreeze returns the freeze period covering the CR at t, or nil
+func ActiveFreeze(db *gorm.DB, cr *models.ChangeRequest, t time.Time) (*models.FreezePeriod, error) {
+	var freeze models.FreezePeriod
+	err := environmentScope(db, cr).
+		Where("starts_at <= ? AND ends_at > ?", t, t).
+		Order("ends_at DESC").
+		First(&freeze).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load freeze periods: %w", err)
+	}
+	return &freeze, nil
+}
+
+// InChangeWindow reports whether t falls in a change window of the CR's environment.
+// Environments without change windows are always open.
+func InChangeWindow(cr *models.ChangeRequest, t time.Time) (bool, error) {
+	var windows []models.ChangeWindow
+	if err := environmentScope(database.DB, cr).Find(&windows).Error; err != nil {
+		return false, fmt.Errorf("failed to load change windows: %w", err)
+	}
+	if len(windows) == 0 {
+		return true, nil
+	}
+
+	for _, w := range windows {
+		if WindowContains(w, t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WindowContains reports whether t falls in a change window
+func WindowContains(w models.ChangeWindow, t time.Time) bool {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false
+	}
+	start, err := ParseWindowTime(w.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := ParseWindowTime(w.EndTime)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	return int(local.Weekday()) == w.Weekday && minute >= start && minute < end
+}
+
+// ParseWindowTime parses an HH:MM time of day into minutes since midnight
+func ParseWindowTime(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ExecutionDue checks that an approved CR may run at t: its scheduled time has
+// passed, no freeze period is active and a change window is open. Otherwise it
+// returns an error wrapping ErrExecutionDeferred (ErrChangeFreeze for a freeze).
+func ExecutionDue(cr *models.ChangeRequest, t time.Time) error {
+	if cr.ScheduledFor != nil && t.Before(*cr.ScheduledFor) {
+		return fmt.Errorf("%w: scheduled for %s", ErrExecutionDeferred, cr.ScheduledFor.Format(time.RFC3339))
+	}
+
+	freeze, err := ActiveFreeze(database.DB, cr, t)
+	if err != nil {
+		return err
+	}
+	if freeze != nil {
+		return freezeError(freeze)
+	}
+
+	open, err := InChangeWindow(cr, t)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return fmt.Errorf("%w: outside change windows", ErrExecutionDeferred)
+	}
+	return nil
+}
+
+func freezeError(freeze *models.FreezePeriod) error {
+	return fmt.Errorf("%w: %s until %s", ErrChangeFreeze, freeze.Name, freeze.EndsAt.Format(time.RFC3339))
+}
+
+// RecordExecutionRefused writes a history entry for a manual execution refused during a freeze
+func RecordExecutionRefused(cr *models.ChangeRequest, actor Actor, reason string) {
+	status := string(cr.ExecutionStatus)
+	history := actor.NewHistory(cr.CRID, "EXECUTION_REFUSED", status, status, reason)
+	if err := RecordHistory(database.DB, &history); err != nil {
+		log.Printf("Failed to record EXECUTION_REFUSED for CR %d: %v", cr.CRID, err)
+	}
+}
+
+// Scheduler periodically hands approved CRs whose time has come to automation
+type Scheduler struct {
+	Automation *AutomationService
+	Interval   time.Duration
+}
+
+// NewScheduler creates a new scheduler
+func NewScheduler(automation *AutomationService, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		Automation: automation,
+		Interval:   interval,
+	}
+}
+
+// Start runs the scheduler in the background every Interval
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.RunDue(); err != nil {
+				log.Printf("Scheduler run failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("Scheduler started (interval %s)", s.Interval)
+}
+
+// RunDue processes approved CRs that have not started and whose scheduled time
+// has passed. CRs still blocked by a freeze or change window are left for a later run.
+func (s *Scheduler) RunDue() ([]uint, error) {
+	var crs []models.ChangeRequest
+	if err := database.DB.
+		Where("approval_status = ? AND execution_status = ?", models.ApprovalStatusApproved, models.ExecutionStatusDraft).
+		Where("(scheduled_for IS NULL OR scheduled_for <= ?)", time.Now()).
+		Order("scheduled_for ASC").Order("cr_id ASC").
+		Find(&crs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load scheduled change requests: %w", err)
+	}
+
+	started := []uint{}
+	for _, cr := range crs {
+		// Refused for good until a Gateway Editor cancels it; recorded once by the process job
+		if err := CheckApprovedPayload(&cr); err != nil {
+			log.Printf("Scheduler: CR %d skipped: %v", cr.CRID, err)
+			continue
+		}
+		err := s.Automation.ProcessApprovedCR(cr.CRID, SystemActor())
+		if errors.Is(err, ErrExecutionDeferred) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Scheduler: CR %d failed: %v", cr.CRID, err)
+			continue
+		}
+		started = append(started, cr.CRID)
+	}
+	return started, nil
+}
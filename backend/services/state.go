@@ -0,0 +1,77 @@
+package services
+
+import (
+	"log"
+	"sort"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+)
+
+// ExpectedService is the approved configuration of one Kong service
+type ExpectedService struct {
+	Changes    *ConfigChanges
+	SourceCRID uint // Last completed CR that touched the service
+}
+
+// GatewayScope selects the change requests that target one gateway
+type GatewayScope struct {
+	IncludeDefault bool   // CRs without a target environment
+	EnvironmentIDs []uint // CRs targeting these environments
+}
+
+// DefaultGatewayScope selects CRs without a target environment
+func DefaultGatewayScope() GatewayScope {
+	return GatewayScope{IncludeDefault: true}
+}
+
+// EnvironmentScope selects CRs targeting a single environment
+func EnvironmentScope(environmentID uint) GatewayScope {
+	return GatewayScope{EnvironmentIDs: []uint{environmentID}}
+}
+
+// BuildExpectedState reconstructs the gateway state the approval workflow
+// produced by replaying the payloads of all COMPLETED change requests in the
+// scope in completion order. Later CRs for the same service replace earlier
+// ones and services removed by a rollback are dropped.
+func BuildExpectedState(scope GatewayScope) (map[string]*ExpectedService, error) {
+	query := database.DB.Where("execution_status = ? AND type = ?", models.ExecutionStatusCompleted, KongServiceCRType)
+	switch {
+	case scope.IncludeDefault && len(scope.EnvironmentIDs) > 0:
+		query = query.Where("(environment_id IS NULL OR environment_id IN ?)", scope.EnvironmentIDs)
+	case scope.IncludeDefault:
+		query = query.Where("environment_id IS NULL")
+	default:
+		query = query.Where("environment_id IN ?", scope.EnvironmentIDs)
+	}
+
+	var crs []models.ChangeRequest
+	if err := query.Order("completed_at ASC").Order("cr_id ASC").Find(&crs).Error; err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]*ExpectedService)
+	for _, cr := range crs {
+		changes, err := ParseConfigChanges(cr.ConfigChangesPayload)
+		if err != nil {
+			log.Printf("Skipping CR %d while building expected state: %v", cr.CRID, err)
+			continue
+		}
+		if changes.Remove {
+			delete(state, changes.Service.Name)
+			continue
+		}
+		state[changes.Service.Name] = &ExpectedService{Changes: changes, SourceCRID: cr.CRID}
+	}
+	return state, nil
+}
+
+// SortedServiceNames returns the service names of an expected state in a stable order
+func SortedServiceNames(state map[string]*ExpectedService) []string {
+	names := make([]string, 0, len(state))
+	for name := range state {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// useTestDB points database.DB at an empty in-memory SQLite database for the
+// rest of the test, with the tables the CR lifecycle writes to and team memberships
+func useTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each connection would get its own in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	tables := []interface{}{
+		&models.ChangeRequest{},
+		&models.SuperManagerReview{},
+		&models.PayloadRevision{},
+		&models.History{},
+		&models.HistoryChainHead{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.Job{},
+		&models.FreezePeriod{},
+		&models.ChangeWindow{},
+		&models.UserTeamMembership{},
+	}
+	// The models declare MySQL column types; SQLite has no enums and only
+	// auto-increments INTEGER primary keys
+	for _, table := range tables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			switch {
+			case field.PrimaryKey && field.AutoIncrement:
+				field.DataType = schema.Int
+			case strings.HasPrefix(string(field.DataType), "enum("):
+				field.DataType = schema.String
+			}
+		}
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+
+	if err := InitHistoryChain(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTransitionNotAllowed is returned when a transition cannot leave the CR's current state
+	ErrTransitionNotAllowed = errors.New("transition not allowed in current state")
+	// ErrTransitionForbidden is returned when the actor lacks a role the transition requires
+	ErrTransitionForbidden = errors.New("transition requires another role")
+)
+
+// TransitionError explains why a transition was refused
+type TransitionError struct {
+	Action models.TransitionAction
+	Reason string
+	Err    error // ErrTransitionNotAllowed, ErrTransitionForbidden or the error of a guard
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot %s change request: %s", e.Action, e.Reason)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// VersionConflictError is returned when a CR was written by someone else
+// after it was loaded, so a write based on it would overwrite their change
+type VersionConflictError struct {
+	CRID    uint
+	Version int // The version the CR was loaded with
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("change request %d was changed after version %d was loaded", e.CRID, e.Version)
+}
+
+// Actor is the user or automation performing a transition
+type Actor struct {
+	UserID           uint // 0 for automation and service accounts
+	ServiceAccountID *uint
+	Grants           Grants // Role bindings of UserID
+	System           bool   // Automation, or a policy decision triggered by UserID
+	IPAddress        string // Client of the request the actor acted through, recorded in the history
+	UserAgent        string
+}
+
+// SystemActor is the automation service acting on its own
+func SystemActor() Actor {
+	return Actor{System: true}
+}
+
+// LoadActor loads the role bindings of a user
+func LoadActor(userID uint) (Actor, error) {
+	grants, err := LoadGrants(database.DB, userID)
+	if err != nil {
+		return Actor{UserID: userID}, err
+	}
+	return Actor{UserID: userID, Grants: grants}, nil
+}
+
+// RolesFor returns the roles the actor holds for a CR. Holders of cr.approve
+// and cr.execute in the CR's scope act as Super Manager and Gateway Editor.
+func (a Actor) RolesFor(cr *models.ChangeRequest) []models.Role {
+	var roles []models.Role
+	if a.System {
+		roles = append(roles, models.RoleSystem)
+	}
+	if a.UserID != 0 && cr.RequesterUserID == a.UserID {
+		roles = append(roles, models.RoleRequester)
+	}
+	scope := CRScope(cr)
+	if a.Grants.Allows(models.PermCRApprove, scope) {
+		roles = append(roles, models.RoleSuperManager)
+	}
+	if a.Grants.Allows(models.PermCRExecute, scope) {
+		roles = append(roles, models.RoleGatewayEditor)
+	}
+	return roles
+}
+
+// transitionGuard is a condition beyond state and role. It returns the reason
+// a transition is refused and the error to report it with, or "".
+type transitionGuard func(db *gorm.DB, cr *models.ChangeRequest, actor Actor) (string, error)
+
+var transitionGuards = map[models.TransitionAction][]transitionGuard{
+	models.ActionReview:         {notYetReviewed},
+	models.ActionRequestChanges: {notYetReviewed},
+	models.ActionStart:          {payloadApproved, notFrozen},
+	models.ActionRetry:          {payloadApproved, notFrozen},
+}
+
+// notYetReviewed allows one review per Super Manager, revision and payload.
+// Reviews of an edited payload are outdated, so their authors may review again;
+// reviews without a hash predate hashing and still count, as in EvaluateApproval.
+func notYetReviewed(db *gorm.DB, cr *models.ChangeRequest, actor Actor) (string, error) {
+	payloadHash, err := HashPayload(cr.ConfigChangesPayload)
+	if err != nil {
+		return "the payload cannot be hashed", err
+	}
+
+	var count int64
+	if err := db.Model(&models.SuperManagerReview{}).
+		Where("cr_id = ? AND sm_user_id = ? AND revision = ?", cr.CRID, actor.UserID, cr.Revision).
+		Where("payload_hash IN ?", []string{payloadHash, ""}).
+		Count(&count).Error; err != nil {
+		return "previous reviews cannot be loaded", err
+	}
+	if count > 0 {
+		return "you have already reviewed this revision of the payload", ErrTransitionNotAllowed
+	}
+	return "", nil
+}
+
+// notFrozen refuses to start execution while a freeze period covers the CR
+func notFrozen(db *gorm.DB, cr *models.ChangeRequest, actor Actor) (string, error) {
+	freeze, err := ActiveFreeze(db, cr, time.Now())
+	if err != nil {
+		return err.Error(), err
+	}
+	if freeze != nil {
+		return freezeError(freeze).Error(), ErrChangeFreeze
+	}
+	return "", nil
+}
+
+// CheckTransition checks that the actor may perform an action on the CR in its current state
+func CheckTransition(cr *models.ChangeRequest, action models.TransitionAction, actor Actor) (models.Transition, error) {
+	return checkTransition(database.DB, cr, action, actor)
+}
+
+func checkTransition(db *gorm.DB, cr *models.ChangeRequest, action models.TransitionAction, actor Actor) (models.Transition, error) {
+	t, ok := models.FindTransition(action)
+	if !ok {
+		return t, &TransitionError{Action: action, Reason: "unknown action", Err: ErrTransitionNotAllowed}
+	}
+
+	if !t.AppliesTo(cr.ApprovalStatus, cr.ExecutionStatus) {
+		return t, &TransitionError{
+			Action: action,
+			Reason: fmt.Sprintf("not allowed while %s/%s", cr.ApprovalStatus, cr.ExecutionStatus),
+			Err:    ErrTransitionNotAllowed,
+		}
+	}
+
+	if !t.AllowsAny(actor.RolesFor(cr)) {
+		return t, &TransitionError{Action: action, Reason: fmt.Sprintf("requires one of %v", t.Roles), Err: ErrTransitionForbidden}
+	}
+
+	for _, guard := range transitionGuards[action] {
+		if reason, guardErr := guard(db, cr, actor); reason != "" {
+			return t, &TransitionError{Action: action, Reason: reason, Err: guardErr}
+		}
+	}
+
+	return t, nil
+}
+
+// AvailableTransitions lists the transitions the actor may perform next
+func AvailableTransitions(cr *models.ChangeRequest, actor Actor) []models.Transition {
+	available := []models.Transition{}
+	for _, t := range models.Transitions {
+		if _, err := CheckTransition(cr, t.Action, actor); err == nil {
+			available = append(available, t)
+		}
+	}
+	return available
+}
+
+// ApplyTransition checks and performs a transition: it moves the CR's statuses
+// and records the history entry declared for the transition. db may be a transaction.
+// It returns a *VersionConflictError if the CR was written since it was loaded.
+func ApplyTransition(db *gorm.DB, cr *models.ChangeRequest, action models.TransitionAction, actor Actor, details string) error {
+	t, err := checkTransition(db, cr, action, actor)
+	if err != nil {
+		return err
+	}
+
+	oldStatus, newStatus := string(cr.ApprovalStatus), string(cr.ApprovalStatus)
+	// Every transition bumps the version, provided the CR is still at the one
+	// it was loaded with; writes of the caller in the same transaction are
+	// thereby checked too
+	updates := map[string]interface{}{"version": gorm.Expr("version + 1")}
+	if t.ToApproval != "" {
+		updates["approval_status"] = t.ToApproval
+		newStatus = string(t.ToApproval)
+	}
+	// Execution is bound to the payload as it was approved
+	approvedHash := ""
+	if t.ToApproval == models.ApprovalStatusApproved {
+		if approvedHash, err = HashPayload(cr.ConfigChangesPayload); err != nil {
+			return err
+		}
+		updates["approved_payload_hash"] = approvedHash
+	}
+	if t.ToExecution != "" {
+		updates["execution_status"] = t.ToExecution
+		oldStatus, newStatus = string(cr.ExecutionStatus), string(t.ToExecution)
+		if t.ToExecution == models.ExecutionStatusCompleted {
+			now := time.Now()
+			cr.CompletedAt = &now
+			updates["completed_at"] = now
+		}
+	}
+
+	result := db.Model(&models.ChangeRequest{}).Where("cr_id = ? AND version = ?", cr.CRID, cr.Version).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update change request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return &VersionConflictError{CRID: cr.CRID, Version: cr.Version}
+	}
+	cr.Version++
+	if t.ToApproval != "" {
+		cr.ApprovalStatus = t.ToApproval
+	}
+	if approvedHash != "" {
+		cr.ApprovedPayloadHash = approvedHash
+	}
+	if t.ToExecution != "" {
+		cr.ExecutionStatus = t.ToExecution
+	}
+
+	history := actor.NewHistory(cr.CRID, t.EventType, oldStatus, newStatus, details)
+	if err := RecordHistory(db, &history); err != nil {
+		return err
+	}
+
+	if t.WebhookEvent != "" {
+		data := map[string]interface{}{"action": t.Action}
+		if details != "" {
+			data["details"] = details
+		}
+		if err := PublishEvent(db, t.WebhookEvent, cr, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecutionActionFor returns the action that moves a CR to the requested execution status
+func ExecutionActionFor(cr *models.ChangeRequest, target models.ExecutionStatus) (models.TransitionAction, bool) {
+	for _, t := range models.Transitions {
+		if t.ToExecution == target && t.AppliesTo(cr.ApprovalStatus, cr.ExecutionStatus) {
+			return t.Action, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+)
+
+// createCRIn stores a CR of team 1, requested by user 1, in the given states
+func createCRIn(t *testing.T, approval models.ApprovalStatus, execution models.ExecutionStatus) *models.ChangeRequest {
+	cr := createInProgressCR(t, testPayload)
+	if err := database.DB.Model(cr).Updates(map[string]interface{}{"approval_status": approval, "execution_status": execution}).Error; err != nil {
+		t.Fatal(err)
+	}
+	cr.ApprovalStatus, cr.ExecutionStatus = approval, execution
+	return cr
+}
+
+// grantActor is a user holding permissions through one binding, limited to a team if teamID is set
+func grantActor(userID uint, teamID *uint, perms ...models.Permission) Actor {
+	return Actor{UserID: userID, Grants: Grants{{
+		UserID: userID,
+		TeamID: teamID,
+		Role:   models.RoleDefinition{Permissions: perms},
+	}}}
+}
+
+func TestApplyTransitionRoleGuards(t *testing.T) {
+	team, otherTeam := uint(1), uint(2)
+	requester := Actor{UserID: 1}
+	superManager := grantActor(2, nil, models.PermCRRead, models.PermCRApprove)
+	otherTeamManager := grantActor(3, &otherTeam, models.PermCRApprove)
+	gatewayEditor := grantActor(4, &team, models.PermCRRead, models.PermCRExecute)
+
+	pending, approved := models.ApprovalStatusPending, models.ApprovalStatusApproved
+	draft, inProgress := models.ExecutionStatusDraft, models.ExecutionStatusInProgress
+
+	tests := []struct {
+		name          string
+		approval      models.ApprovalStatus
+		execution     models.ExecutionStatus
+		action        models.TransitionAction
+		actor         Actor
+		wantErr       error
+		wantApproval  models.ApprovalStatus
+		wantExecution models.ExecutionStatus
+	}{
+		{"requester updates", pending, draft, models.ActionUpdate, requester, nil, pending, draft},
+		{"super manager cannot update", pending, draft, models.ActionUpdate, superManager, ErrTransitionForbidden, pending, draft},
+		{"super manager reviews", pending, draft, models.ActionReview, superManager, nil, pending, draft},
+		{"requester cannot review", pending, draft, models.ActionReview, requester, ErrTransitionForbidden, pending, draft},
+		{"manager of another team cannot review", pending, draft, models.ActionReview, otherTeamManager, ErrTransitionForbidden, pending, draft},
+		{"super manager requests changes", pending, draft, models.ActionRequestChanges, superManager, nil, models.ApprovalStatusNeedsRework, draft},
+		{"system approves", pending, draft, models.ActionApprove, SystemActor(), nil, approved, draft},
+		{"super manager cannot approve directly", pending, draft, models.ActionApprove, superManager, ErrTransitionForbidden, pending, draft},
+		{"gateway editor starts", approved, draft, models.ActionStart, gatewayEditor, nil, approved, inProgress},
+		{"requester cannot start", approved, draft, models.ActionStart, requester, ErrTransitionForbidden, approved, draft},
+		{"pending CR cannot start", pending, draft, models.ActionStart, gatewayEditor, ErrTransitionNotAllowed, pending, draft},
+		{"system completes", approved, inProgress, models.ActionComplete, SystemActor(), nil, approved, models.ExecutionStatusCompleted},
+		{"gateway editor cancels", approved, inProgress, models.ActionCancel, gatewayEditor, nil, approved, models.ExecutionStatusCanceled},
+		{"system cannot cancel", approved, inProgress, models.ActionCancel, SystemActor(), ErrTransitionForbidden, approved, inProgress},
+		{"unknown action", pending, draft, "publish", SystemActor(), ErrTransitionNotAllowed, pending, draft},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			cr := createCRIn(t, tt.approval, tt.execution)
+
+			err := ApplyTransition(database.DB, cr, tt.action, tt.actor, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var stored models.ChangeRequest
+			if err := database.DB.First(&stored, cr.CRID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.ApprovalStatus != tt.wantApproval || stored.ExecutionStatus != tt.wantExecution {
+				t.Errorf("state = %s/%s, want %s/%s", stored.ApprovalStatus, stored.ExecutionStatus, tt.wantApproval, tt.wantExecution)
+			}
+			wantEntries := int64(1)
+			if tt.wantErr != nil {
+				wantEntries = 0
+			}
+			var entries int64
+			database.DB.Model(&models.History{}).Where("cr_id = ?", cr.CRID).Count(&entries)
+			if entries != wantEntries {
+				t.Errorf("%d history entries, want %d", entries, wantEntries)
+			}
+		})
+	}
+}
+
+func TestReviewOncePerPayload(t *testing.T) {
+	useTestDB(t)
+	superManager := grantActor(2, nil, models.PermCRApprove)
+	cr := createCRIn(t, models.ApprovalStatusPending, models.ExecutionStatusDraft)
+	hash, err := HashPayload(cr.ConfigChangesPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := models.SuperManagerReview{CRID: cr.CRID, SMUserID: superManager.UserID, Revision: cr.Revision, PayloadHash: hash, ReviewDecision: models.ReviewDecisionApproved}
+	if err := database.DB.Create(&review).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CheckTransition(cr, models.ActionReview, superManager); !errors.Is(err, ErrTransitionNotAllowed) {
+		t.Errorf("second review: err = %v, want ErrTransitionNotAllowed", err)
+	}
+	// Reviews of an edited payload are outdated
+	cr.ConfigChangesPayload = `{"service": {"name": "orders", "url": "http://orders.internal:9090", "port": 9090}, "routes": [{"name": "orders", "paths": ["/orders"]}]}`
+	if _, err := CheckTransition(cr, models.ActionReview, superManager); err != nil {
+		t.Errorf("review of the edited payload: %v", err)
+	}
+}
+
+func TestStartRequiresApprovedPayload(t *testing.T) {
+	useTestDB(t)
+	gatewayEditor := grantActor(4, nil, models.PermCRExecute)
+	cr := createCRIn(t, models.ApprovalStatusApproved, models.ExecutionStatusDraft)
+	cr.ConfigChangesPayload = `{"service": {"name": "orders", "url": "http://evil.internal:80", "port": 80}, "routes": [{"name": "orders", "paths": ["/orders"]}]}`
+
+	if err := ApplyTransition(database.DB, cr, models.ActionStart, gatewayEditor, ""); !errors.Is(err, ErrPayloadNotApproved) {
+		t.Errorf("err = %v, want ErrPayloadNotApproved", err)
+	}
+}
+
+func TestTransitionsAreDeclaredOnce(t *testing.T) {
+	seen := map[models.TransitionAction]bool{}
+	for _, tr := range models.Transitions {
+		if seen[tr.Action] {
+			t.Errorf("action %s is declared twice", tr.Action)
+		}
+		seen[tr.Action] = true
+		if len(tr.Roles) == 0 || tr.EventType == "" {
+			t.Errorf("action %s has no roles or no history event type", tr.Action)
+		}
+		if len(tr.FromApproval) == 0 || len(tr.FromExecution) == 0 {
+			t.Errorf("action %s applies to no state", tr.Action)
+		}
+		if tr.ToExecution != "" && (len(tr.FromApproval) != 1 || tr.FromApproval[0] != models.ApprovalStatusApproved) {
+			t.Errorf("action %s moves execution of CRs that are not approved", tr.Action)
+		}
+	}
+}
+
+func TestApplyTransitionRefusesStaleVersion(t *testing.T) {
+	useTestDB(t)
+	gatewayEditor := grantActor(4, nil, models.PermCRExecute)
+	cr := createCRIn(t, models.ApprovalStatusApproved, models.ExecutionStatusInProgress)
+	stale := *cr
+
+	if err := ApplyTransition(database.DB, cr, models.ActionComplete, SystemActor(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if cr.Version != stale.Version+1 {
+		t.Errorf("version = %d, want %d", cr.Version, stale.Version+1)
+	}
+
+	// A cancel based on the CR as it was loaded before completion
+	err := ApplyTransition(database.DB, &stale, models.ActionCancel, gatewayEditor, "")
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Version != cr.Version-1 {
+		t.Fatalf("err = %v, want a version conflict", err)
+	}
+
+	var stored models.ChangeRequest
+	if err := database.DB.First(&stored, cr.CRID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ExecutionStatus != models.ExecutionStatusCompleted || stored.Version != cr.Version {
+		t.Errorf("stored = %s at version %d, want COMPLETED at %d", stored.ExecutionStatus, stored.Version, cr.Version)
+	}
+	var entries int64
+	database.DB.Model(&models.History{}).Where("cr_id = ?", cr.CRID).Count(&entries)
+	if entries != 1 {
+		t.Errorf("%d history entries, want only the completion", entries)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/config_changes.schema.json
+var configChangesSchemaJSON string
+
+var configChangesSchema = jsonschema.MustCompileString("config_changes.schema.json", configChangesSchemaJSON)
+
+// groupingError matches messages of schema units that only wrap other failures
+var groupingError = regexp.MustCompile(`^(doesn't validate with .*|(oneOf|anyOf|allOf|if-then|if-else) failed)$`)
+
+// FieldError is a validation failure of a single payload field
+type FieldError struct {
+	Path    string `json:"path"` // e.g. "routes[1].paths", empty for the whole payload
+	Message string `json:"message"`
+}
+
+// PayloadValidationError lists every field of a payload that failed validation
+type PayloadValidationError struct {
+	Errors []FieldError
+}
+
+func (e *PayloadValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Path == "" {
+			parts = append(parts, fe.Message)
+		} else {
+			parts = append(parts, fe.Path+": "+fe.Message)
+		}
+	}
+	return "invalid config changes payload: " + strings.Join(parts, "; ")
+}
+
+// validateAgainstSchema validates a JSON document and converts the failures into field errors
+func validateAgainstSchema(schema *jsonschema.Schema, payload string) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(payload)))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return &PayloadValidationError{Errors: []FieldError{{Message: fmt.Sprintf("invalid JSON: %v", err)}}}
+	}
+
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+
+	result := &PayloadValidationError{}
+	seen := make(map[FieldError]bool)
+	for _, unit := range verr.BasicOutput().Errors {
+		// Units of combinators only group their causes
+		if unit.Error == "" || groupingError.MatchString(unit.Error) {
+			continue
+		}
+		fe := FieldError{Path: pointerToPath(unit.InstanceLocation), Message: unit.Error}
+		if !seen[fe] {
+			seen[fe] = true
+			result.Errors = append(result.Errors, fe)
+		}
+	}
+	if len(result.Errors) == 0 {
+		result.Errors = append(result.Errors, FieldError{Path: pointerToPath(verr.InstanceLocation), Message: verr.Message})
+	}
+	return result
+}
+
+// pointerToPath turns a JSON pointer like /routes/1/paths into routes[1].paths
+func pointerToPath(pointer string) string {
+	var b strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if isIndex(token) {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+func isIndex(token string) bool {
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return token != ""
+}
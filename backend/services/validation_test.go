@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateConfigChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		wantPaths []string // Paths of the field errors, nil for a valid payload
+	}{
+		{name: "valid", payload: testPayload},
+		{name: "removal", payload: `{"service": {"name": "orders"}, "remove": true}`},
+		{name: "invalid JSON", payload: `{"service": `, wantPaths: []string{""}},
+		{name: "no routes", payload: `{"service": {"name": "orders", "url": "http://orders:80", "port": 80}}`, wantPaths: []string{""}},
+		{
+			name:      "relative path",
+			payload:   `{"service": {"name": "orders", "url": "http://orders:80", "port": 80}, "routes": [{"name": "a", "paths": ["/a"]}, {"name": "b", "paths": ["b"]}]}`,
+			wantPaths: []string{"routes[1].paths", "routes[1].paths[0]"},
+		},
+		{
+			name:      "unknown method and port",
+			payload:   `{"service": {"name": "orders", "url": "http://orders:80", "port": 70000}, "routes": [{"name": "a", "paths": "/a", "methods": ["FETCH"]}]}`,
+			wantPaths: []string{"service.port", "routes[0].methods[0]"},
+		},
+		{
+			name:      "rate limit without minute",
+			payload:   `{"service": {"name": "orders", "url": "http://orders:80", "port": 80}, "routes": [{"name": "a", "paths": "/a"}], "plugins": {"enable_rate_limit": true}}`,
+			wantPaths: []string{"plugins"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfigChanges(tt.payload)
+			if tt.wantPaths == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var validationErr *PayloadValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("err = %v, want a *PayloadValidationError", err)
+			}
+			paths := map[string]bool{}
+			for _, fe := range validationErr.Errors {
+				paths[fe.Path] = true
+			}
+			for _, path := range tt.wantPaths {
+				if !paths[path] {
+					t.Errorf("errors %+v, want one for %q", validationErr.Errors, path)
+				}
+			}
+		})
+	}
+}
+
+func TestPointerToPath(t *testing.T) {
+	tests := map[string]string{
+		"":                   "",
+		"/service/name":      "service.name",
+		"/routes/1/paths":    "routes[1].paths",
+		"/routes/0/paths/2":  "routes[0].paths[2]",
+		"/plugins/a~1b~0c/1": "plugins.a/b~c[1]",
+	}
+	for pointer, want := range tests {
+		if got := pointerToPath(pointer); got != want {
+			t.Errorf("pointerToPath(%q) = %q, want %q", pointer, got, want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alpaka/backend/database"
+	"alpaka/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Headers sent with every webhook request
+const (
+	WebhookEventHeader     = "X-Alpaka-Event"
+	WebhookDeliveryHeader  = "X-Alpaka-Delivery"
+	WebhookTimestampHeader = "X-Alpaka-Timestamp"
+	WebhookSignatureHeader = "X-Alpaka-Signature" // "sha256=" + hex HMAC of "<timestamp>.<body>"
+)
+
+// maxResponseBody is how much of a subscriber's response is stored on the delivery
+const maxResponseBody = 1024
+
+// ErrDeliveryNotFound is returned when a webhook delivery does not exist
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// ValidWebhookEvent reports whether subscriptions can filter on an event
+func ValidWebhookEvent(event models.WebhookEvent) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionMatches reports whether a subscription wants an event of a CR (nil for events without one)
+func subscriptionMatches(sub models.WebhookSubscription, event models.WebhookEvent, cr *models.ChangeRequest) bool {
+	if sub.TeamID != nil && (cr == nil || cr.RequesterTeamID != *sub.TeamID) {
+		return false
+	}
+	if len(sub.Events) == 0 {
+		return true
+	}
+	for _, e := range sub.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// crWebhookPayload describes a CR in webhook payloads
+func crWebhookPayload(cr *models.ChangeRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"cr_id":             cr.CRID,
+		"title":             cr.Title,
+		"type":              cr.Type,
+		"schema_version":    cr.SchemaVersion,
+		"config_changes":    cr.ConfigChangesPayload,
+		"approval_status":   cr.ApprovalStatus,
+		"execution_status":  cr.ExecutionStatus,
+		"requester_user_id": cr.RequesterUserID,
+		"requester_team_id": cr.RequesterTeamID,
+		"environment_id":    cr.EnvironmentID,
+	}
+}
+
+// PublishEvent records a delivery for every active subscription matching the
+// event and queues it. cr is nil for events that are not about a CR. Pass the
+// transaction of the change being announced so nothing is sent if it rolls back.
+func PublishEvent(db *gorm.DB, event models.WebhookEvent, cr *models.ChangeRequest, data map[string]interface{}) error {
+	var subs []models.WebhookSubscription
+	if err := db.Where("active = ?", true).Find(&subs).Error; err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"event":     event,
+		"timestamp": time.Now().Unix(),
+	}
+	var crID *uint
+	if cr != nil {
+		id := cr.CRID
+		crID = &id
+		body["change_request"] = crWebhookPayload(cr)
+	}
+	for k, v := range data {
+		body[k] = v
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	for _, sub := range subs {
+		if !subscriptionMatches(sub, event, cr) {
+			continue
+		}
+		delivery := models.WebhookDelivery{
+			SubscriptionID: sub.SubscriptionID,
+			Event:          event,
+			CRID:           crID,
+			Payload:        string(payload),
+			Status:         models.DeliveryStatusPending,
+		}
+		if err := queueDelivery(db, &delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueDelivery stores a delivery and the job that sends it
+func queueDelivery(db *gorm.DB, delivery *models.WebhookDelivery) error {
+	if err := db.Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	_, err := EnqueueJob(db, JobWebhookDelivery, delivery.CRID, map[string]uint{"delivery_id": delivery.DeliveryID})
+	return err
+}
+
+// SignWebhook returns the signature header value of a request body
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhookJob sends the delivery a webhook_delivery job refers to
+func deliverWebhookJob(job *models.Job) error {
+	var ref struct {
+		DeliveryID uint `json:"delivery_id"`
+	}
+	if job.Payload == nil || json.Unmarshal([]byte(*job.Payload), &ref) != nil {
+		return fmt.Errorf("invalid webhook delivery job payload")
+	}
+	return DeliverWebhook(ref.DeliveryID)
+}
+
+// DeliverWebhook sends a delivery to its subscription and records the response.
+// Network errors and non-2xx responses are returned so the job retries.
+func DeliverWebhook(deliveryID uint) error {
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, "delivery_id = ?", deliveryID).Error; err != nil {
+		return ErrDeliveryNotFound
+	}
+	if delivery.Status == models.DeliveryStatusDelivered {
+		return nil
+	}
+
+	var sub models.WebhookSubscription
+	if err := database.DB.First(&sub, "subscription_id = ?", delivery.SubscriptionID).Error; err != nil {
+		// Subscription deleted since; nothing left to send to
+		msg := "subscription no longer exists"
+		database.DB.Model(&delivery).Updates(map[string]interface{}{"status": models.DeliveryStatusFailed, "error": msg})
+		return nil
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return recordDeliveryAttempt(&delivery, nil, nil, fmt.Errorf("invalid subscription URL: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "alpaka-webhooks")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.DeliveryID), 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	if sub.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, timestamp, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return recordDeliveryAttempt(&delivery, nil, nil, fmt.Errorf("failed to send webhook: %w", err))
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	code := resp.StatusCode
+	respText := string(respBody)
+	if code < 200 || code >= 300 {
+		return recordDeliveryAttempt(&delivery, &code, &respText, fmt.Errorf("webhook returned status %d", code))
+	}
+	return recordDeliveryAttempt(&delivery, &code, &respText, nil)
+}
+
+// recordDeliveryAttempt stores the outcome of an attempt and returns sendErr
+func recordDeliveryAttempt(delivery *models.WebhookDelivery, code *int, body *string, sendErr error) error {
+	updates := map[string]interface{}{
+		"attempts":      gorm.Expr("attempts + 1"),
+		"response_code": code,
+		"response_body": body,
+	}
+	if sendErr != nil {
+		updates["status"] = models.DeliveryStatusFailed
+		updates["error"] = sendErr.Error()
+	} else {
+		updates["status"] = models.DeliveryStatusDelivered
+		updates["error"] = nil
+		updates["delivered_at"] = time.Now()
+	}
+	if err := database.DB.Model(delivery).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return sendErr
+}
+
+// Redeliver queues a new delivery with the payload of an earlier one
+func Redeliver(deliveryID uint) (*models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := database.DB.First(&original, "delivery_id = ?", deliveryID).Error; err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	delivery := models.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		Event:          original.Event,
+		CRID:           original.CRID,
+		Payload:        original.Payload,
+		Status:         models.DeliveryStatusPending,
+		RedeliveryOf:   &original.DeliveryID,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return queueDelivery(tx, &delivery)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// SeedWebhookSubscription turns the legacy WEBHOOK_URL setting into a subscription
+// for the events it used to receive, unless one for the URL already exists
+func SeedWebhookSubscription(url string) error {
+	if url == "" {
+		return nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.WebhookSubscription{}).Where("url = ?", url).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	sub := models.WebhookSubscription{
+		Name:   "WEBHOOK_URL",
+		URL:    url,
+		Events: []models.WebhookEvent{models.WebhookEventExecutionStarted, models.WebhookEventDriftDetected},
+		Active: true,
+	}
+	if err := database.DB.Create(&sub).Error; err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"CR_APPROVED"}`)
+	const want = "sha256=109930a4f6e257e47556bf55fdb34f14004744fc92bd5e36b3e6098333996880"
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		matches   bool
+	}{
+		{"same request", "whsec_test", 1700000000, body, true},
+		{"other secret", "whsec_other", 1700000000, body, false},
+		{"replayed later", "whsec_test", 1700000060, body, false},
+		{"changed body", "whsec_test", 1700000000, []byte(`{"event":"CR_REJECTED"}`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhook(tt.secret, tt.timestamp, tt.body); (got == want) != tt.matches {
+				t.Errorf("SignWebhook = %s, matches %s: %v, want %v", got, want, got == want, tt.matches)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 
 	"alpaka/backend/middleware"
@@ -8,20 +11,38 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID uint, username, secretKey string) (string, error) {
+// GenerateToken generates a short-lived access token for a user's session.
+// It returns the token and when it expires.
+func GenerateToken(userID uint, username, sessionID string) (string, time.Time, error) {
+	keys := middleware.GetJWTKeys()
+	now := time.Now()
+	expiresAt := now.Add(keys.AccessTokenTTL)
 	claims := &middleware.Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	token, err := keys.Sign(claims)
+	return token, expiresAt, err
 }
 
+// GenerateOpaqueToken returns a random hex token, e.g. a refresh token or session ID
+func GenerateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
 
+// HashToken returns the stored hash of an opaque token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
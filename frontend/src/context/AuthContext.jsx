@@ -54,6 +54,20 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  // Finish a single sign-on login once its tokens are stored
+  const completeOidcLogin = async (hash) => {
+    if (!authAPI.completeOidcLogin(hash)) {
+      return { success: false, error: 'Single sign-on did not return a token' };
+    }
+    try {
+      const userData = await authAPI.getCurrentUser();
+      setUser(userData);
+      return { success: true };
+    } catch (error) {
+      return { success: false, error: error.message };
+    }
+  };
+
   const logout = () => {
     authAPI.logout();
     setUser(null);
@@ -64,6 +78,7 @@ export const AuthProvider = ({ children }) => {
     loading,
     login,
     register,
+    completeOidcLogin,
     logout,
     isAuthenticated: !!user,
     isSuperManager: user?.is_super_manager || false,
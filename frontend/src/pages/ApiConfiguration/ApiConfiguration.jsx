@@ -292,7 +292,7 @@ const ApiConfiguration = () => {
     try {
       setSaving(true);
       const configPayload = JSON.stringify(formData);
-      await changeRequestsAPI.update(changeRequest.cr_id, changeRequest.title, configPayload);
+      await changeRequestsAPI.update(changeRequest.cr_id, changeRequest.title, configPayload, changeRequest.version);
       
       // Refresh change request data
       const updatedCR = await changeRequestsAPI.get(apiId);
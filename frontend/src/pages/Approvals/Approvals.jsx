@@ -30,10 +30,11 @@ const Approvals = () => {
     }
   };
 
-  const handleReview = async (crId) => {
+  const handleReview = async (crId, version) => {
     try {
       setReviewingId(crId);
-      await changeRequestsAPI.review(crId, reviewDecision);
+      // Review the version shown; fails if the payload was edited meanwhile
+      await changeRequestsAPI.review(crId, reviewDecision, version);
       
       // Add comment if provided
       if (reviewComment.trim()) {
@@ -137,7 +138,7 @@ const Approvals = () => {
                     <div className="review-actions">
                       <button
                         className="btn btn-primary"
-                        onClick={() => handleReview(cr.cr_id)}
+                        onClick={() => handleReview(cr.cr_id, cr.version)}
                       >
                         Submit Review
                       </button>
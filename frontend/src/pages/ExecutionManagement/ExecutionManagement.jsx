@@ -33,10 +33,10 @@ const ExecutionManagement = () => {
     }
   };
 
-  const handleUpdateStatus = async (crId, newStatus) => {
+  const handleUpdateStatus = async (crId, newStatus, version) => {
     try {
       setUpdatingId(crId);
-      await changeRequestsAPI.updateExecutionStatus(crId, newStatus);
+      await changeRequestsAPI.updateExecutionStatus(crId, newStatus, version);
       fetchChangeRequests();
       alert('Execution status updated successfully');
     } catch (err) {
@@ -140,7 +140,7 @@ const ExecutionManagement = () => {
                   {cr.execution_status === 'DRAFT' && (
                     <button
                       className="btn btn-primary"
-                      onClick={() => handleUpdateStatus(cr.cr_id, 'IN_PROGRESS')}
+                      onClick={() => handleUpdateStatus(cr.cr_id, 'IN_PROGRESS', cr.version)}
                       disabled={updatingId === cr.cr_id}
                     >
                       {updatingId === cr.cr_id ? 'Updating...' : 'Start Execution'}
@@ -150,14 +150,14 @@ const ExecutionManagement = () => {
                     <>
                       <button
                         className="btn btn-success"
-                        onClick={() => handleUpdateStatus(cr.cr_id, 'COMPLETED')}
+                        onClick={() => handleUpdateStatus(cr.cr_id, 'COMPLETED', cr.version)}
                         disabled={updatingId === cr.cr_id}
                       >
                         {updatingId === cr.cr_id ? 'Updating...' : 'Mark Complete'}
                       </button>
                       <button
                         className="btn btn-warning"
-                        onClick={() => handleUpdateStatus(cr.cr_id, 'CANCELED')}
+                        onClick={() => handleUpdateStatus(cr.cr_id, 'CANCELED', cr.version)}
                         disabled={updatingId === cr.cr_id}
                       >
                         {updatingId === cr.cr_id ? 'Updating...' : 'Cancel'}
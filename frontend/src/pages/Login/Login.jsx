@@ -1,6 +1,7 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
 import { useAuth } from '../../context/AuthContext';
+import { authAPI } from '../../services/api';
 import './Login.css';
 
 const Login = () => {
@@ -8,9 +9,32 @@ const Login = () => {
   const [password, setPassword] = useState('');
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
-  const { login } = useAuth();
+  const [providers, setProviders] = useState({ local_login: true, ldap: false, oidc: false });
+  const { login, completeOidcLogin } = useAuth();
   const navigate = useNavigate();
 
+  useEffect(() => {
+    authAPI.getProviders().then(setProviders).catch(() => {});
+  }, []);
+
+  // The SSO callback redirects here with the tokens in the URL fragment
+  useEffect(() => {
+    if (!window.location.hash.includes('token=')) {
+      return;
+    }
+    const hash = window.location.hash;
+    window.history.replaceState(null, '', window.location.pathname);
+    setLoading(true);
+    completeOidcLogin(hash).then((result) => {
+      setLoading(false);
+      if (result.success) {
+        navigate('/');
+      } else {
+        setError(result.error || 'Single sign-on failed. Please try again.');
+      }
+    });
+  }, [completeOidcLogin, navigate]);
+
   const handleSubmit = async (e) => {
     e.preventDefault();
     setError('');
@@ -34,52 +58,64 @@ const Login = () => {
           <h2 className="auth-subtitle">Sign in to your account</h2>
         </div>
 
-        <form onSubmit={handleSubmit} className="auth-form">
-          {error && <div className="auth-error">{error}</div>}
+        {providers.oidc && (
+          <a href={authAPI.oidcLoginURL} className="auth-button auth-sso-button">
+            Sign in with SSO
+          </a>
+        )}
 
-          <div className="form-group">
-            <label htmlFor="username">Username</label>
-            <input
-              id="username"
-              type="text"
-              value={username}
-              onChange={(e) => setUsername(e.target.value)}
-              required
-              placeholder="Enter your username"
-              disabled={loading}
-            />
-          </div>
+        {providers.local_login && (
+          <form onSubmit={handleSubmit} className="auth-form">
+            {error && <div className="auth-error">{error}</div>}
 
-          <div className="form-group">
-            <label htmlFor="password">Password</label>
-            <input
-              id="password"
-              type="password"
-              value={password}
-              onChange={(e) => setPassword(e.target.value)}
-              required
-              placeholder="Enter your password"
+            <div className="form-group">
+              <label htmlFor="username">Username</label>
+              <input
+                id="username"
+                type="text"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                required
+                placeholder="Enter your username"
+                disabled={loading}
+              />
+            </div>
+
+            <div className="form-group">
+              <label htmlFor="password">Password</label>
+              <input
+                id="password"
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                required
+                placeholder="Enter your password"
+                disabled={loading}
+              />
+            </div>
+
+            <button 
+              type="submit" 
+              className="auth-button" 
               disabled={loading}
-            />
-          </div>
+            >
+              {loading ? 'Signing in...' : 'Sign in'}
+            </button>
+          </form>
+        )}
 
-          <button 
-            type="submit" 
-            className="auth-button" 
-            disabled={loading}
-          >
-            {loading ? 'Signing in...' : 'Sign in'}
-          </button>
-        </form>
+        {!providers.local_login && error && <div className="auth-error">{error}</div>}
 
-        <div className="auth-footer">
-          <p>
-            Don't have an account?{' '}
-            <Link to="/register" className="auth-link">
-              Sign up
-            </Link>
-          </p>
-        </div>
+        {providers.local_login && !providers.ldap && (
+          <div className="auth-footer">
+            <p>
+              Don't have an account?{' '}
+              <Link to="/register" className="auth-link">
+                Sign up
+              </Link>
+            </p>
+          </div>
+        )}
       </div>
     </div>
   );
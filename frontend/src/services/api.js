@@ -10,13 +10,56 @@ const setToken = (token) => {
   localStorage.setItem('token', token);
 };
 
-// Remove token from localStorage
+// Remove tokens from localStorage
 const removeToken = () => {
   localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
 };
 
+// Store the access and refresh tokens of a login, register or refresh response
+const setSession = (data) => {
+  if (data.token) {
+    setToken(data.token);
+  }
+  if (data.refresh_token) {
+    localStorage.setItem('refresh_token', data.refresh_token);
+  }
+};
+
+// Exchange the refresh token for new tokens; concurrent callers share one request
+let refreshing = null;
+const refreshSession = () => {
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (!refreshToken) {
+    return Promise.resolve(false);
+  }
+  if (!refreshing) {
+    refreshing = fetch(`${API_BASE_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    })
+      .then(async (response) => {
+        if (!response.ok) {
+          removeToken();
+          return false;
+        }
+        setSession(await response.json());
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// If-Match header for a write based on a version of a change request
+const ifMatch = (version) => (version === undefined ? {} : { 'If-Match': `"${version}"` });
+
 // API request helper
-const apiRequest = async (endpoint, options = {}) => {
+const apiRequest = async (endpoint, options = {}, retried = false) => {
   const token = getToken();
   const headers = {
     'Content-Type': 'application/json',
@@ -32,6 +75,11 @@ const apiRequest = async (endpoint, options = {}) => {
     headers,
   });
 
+  // Access tokens are short-lived; refresh once and retry
+  if (response.status === 401 && token && !retried && (await refreshSession())) {
+    return apiRequest(endpoint, options, true);
+  }
+
   if (!response.ok) {
     const errorData = await response.json().catch(() => ({ error: 'Request failed' }));
     throw new Error(errorData.error || errorData.message || `HTTP error! status: ${response.status}`);
@@ -47,9 +95,7 @@ export const authAPI = {
       method: 'POST',
       body: JSON.stringify({ username, email, password }),
     });
-    if (data.token) {
-      setToken(data.token);
-    }
+    setSession(data);
     return data;
   },
 
@@ -58,9 +104,7 @@ export const authAPI = {
       method: 'POST',
       body: JSON.stringify({ username, password }),
     });
-    if (data.token) {
-      setToken(data.token);
-    }
+    setSession(data);
     return data;
   },
 
@@ -68,7 +112,33 @@ export const authAPI = {
     return apiRequest('/auth/me');
   },
 
-  logout: () => {
+  // Sign-in methods offered by the server: {local_login, oidc}
+  getProviders: async () => {
+    return apiRequest('/auth/providers');
+  },
+
+  // Single sign-on starts with a full page redirect to the identity provider
+  oidcLoginURL: `${API_BASE_URL}/auth/oidc/login`,
+
+  // Store the tokens the SSO callback passes in the URL fragment; returns false if there are none
+  completeOidcLogin: (hash) => {
+    const params = new URLSearchParams(hash.replace(/^#/, ''));
+    if (!params.get('token')) {
+      return false;
+    }
+    setSession({ token: params.get('token'), refresh_token: params.get('refresh_token') });
+    return true;
+  },
+
+  logout: async () => {
+    if (getToken()) {
+      await apiRequest('/auth/logout', { method: 'POST' }).catch(() => {});
+    }
+    removeToken();
+  },
+
+  logoutAll: async () => {
+    await apiRequest('/auth/logout-all', { method: 'POST' });
     removeToken();
   },
 };
@@ -103,9 +173,10 @@ export const changeRequestsAPI = {
     });
   },
 
-  update: async (id, title, configChangesPayload) => {
+  update: async (id, title, configChangesPayload, version) => {
     return apiRequest(`/change-requests/${id}`, {
       method: 'PUT',
+      headers: ifMatch(version),
       body: JSON.stringify({
         title,
         config_changes_payload: configChangesPayload,
@@ -113,16 +184,18 @@ export const changeRequestsAPI = {
     });
   },
 
-  review: async (id, reviewDecision) => {
+  review: async (id, reviewDecision, version) => {
     return apiRequest(`/change-requests/${id}/review`, {
       method: 'POST',
+      headers: ifMatch(version),
       body: JSON.stringify({ review_decision: reviewDecision }),
     });
   },
 
-  updateExecutionStatus: async (id, executionStatus) => {
+  updateExecutionStatus: async (id, executionStatus, version) => {
     return apiRequest(`/change-requests/${id}/execution-status`, {
       method: 'PUT',
+      headers: ifMatch(version),
       body: JSON.stringify({ execution_status: executionStatus }),
     });
   },